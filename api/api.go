@@ -6,27 +6,102 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type GetRunResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Status      RunStatus `json:"status"`
-	LastUpdated time.Time `json:"lastUpdated"`
+	ID          uuid.UUID                 `json:"id"`
+	Status      RunStatus                 `json:"status"`
+	LastUpdated time.Time                 `json:"lastUpdated"`
+	Scrapers    []Scraper                 `json:"scrapers,omitempty"`
+	Results     map[Scraper]ScraperResult `json:"results,omitempty"`
+	RunOptions
 }
 
+type ScraperResult string
+
+const (
+	ScraperResultSuccess ScraperResult = "success"
+	ScraperResultFailed  ScraperResult = "failed"
+	ScraperResultSkipped ScraperResult = "skipped: circuit open"
+)
+
 type RunStatus string
 
 const (
+	RunStatusQueued     RunStatus = "queued"
 	RunStatusInProgress RunStatus = "in progress"
 	RunStatusSuccess    RunStatus = "success"
 	RunStatusFailed     RunStatus = "failed"
+	RunStatusCancelled  RunStatus = "cancelled"
+)
+
+func (s RunStatus) Terminal() bool {
+	switch s {
+	case RunStatusSuccess, RunStatusFailed, RunStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+type ListRunsResponse struct {
+	Runs []GetRunResponse `json:"runs"`
+}
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
 )
 
 type PostRunRequest struct {
-	Scrapers []Scraper `json:"scrapers"`
+	Scrapers       []Scraper `json:"scrapers"`
+	CallbackURL    string    `json:"callbackURL,omitempty"`
+	CallbackSecret string    `json:"callbackSecret,omitempty"`
+	RunOptions
+}
+
+type RunOptions struct {
+	Timeout  Duration          `json:"timeout,omitempty"`
+	MaxPages int               `json:"maxPages,omitempty"`
+	MaxDepth int               `json:"maxDepth,omitempty"`
+	DryRun   bool              `json:"dryRun,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func (o RunOptions) HasLabels(selector map[string]string) bool {
+	for key, val := range selector {
+		if actual, ok := o.Labels[key]; !ok || actual != val {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
 }
 
 type Scraper string
@@ -52,6 +127,75 @@ const (
 	ScraperTruphae   Scraper = "truphae"
 )
 
+type GetScraperHealthResponse struct {
+	Scrapers []ScraperHealth `json:"scrapers"`
+}
+
+type ScraperHealth struct {
+	Scraper             Scraper    `json:"scraper"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	OpenUntil           *time.Time `json:"openUntil,omitempty"`
+}
+
 type PostRunResponse struct {
 	RunID uuid.UUID `json:"runID"`
 }
+
+type GetProductsResponse struct {
+	Products   []Product `json:"products"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+type Product struct {
+	Source       string              `json:"source"`
+	Name         string              `json:"name"`
+	URL          string              `json:"url"`
+	Price        float64             `json:"price,omitempty"`
+	Availability ProductAvailability `json:"availability,omitempty"`
+	FirstSeen    time.Time           `json:"firstSeen"`
+	LastSeen     time.Time           `json:"lastSeen"`
+}
+
+type ProductAvailability string
+
+const (
+	ProductAvailabilityInStock ProductAvailability = "in_stock"
+	ProductAvailabilitySoldOut ProductAvailability = "sold_out"
+)
+
+func (a ProductAvailability) Valid() bool {
+	switch a {
+	case ProductAvailabilityInStock, ProductAvailabilitySoldOut:
+		return true
+	default:
+		return false
+	}
+}
+
+type RunEventType string
+
+const (
+	RunEventScraperStarted  RunEventType = "scraper_started"
+	RunEventPageVisited     RunEventType = "page_visited"
+	RunEventProductRecorded RunEventType = "product_recorded"
+	RunEventRequestRetried  RunEventType = "request_retried"
+	RunEventScraperError    RunEventType = "scraper_error"
+	RunEventScraperFinished RunEventType = "scraper_finished"
+	RunEventScraperSkipped  RunEventType = "scraper_skipped"
+	RunEventRunFinished     RunEventType = "run_finished"
+)
+
+type RunEvent struct {
+	ID      uint64       `json:"id"`
+	Type    RunEventType `json:"type"`
+	RunID   uuid.UUID    `json:"runID"`
+	Source  string       `json:"source,omitempty"`
+	URL     string       `json:"url,omitempty"`
+	Product string       `json:"product,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Status  RunStatus    `json:"status,omitempty"`
+	Time    time.Time    `json:"time"`
+}
@@ -0,0 +1,474 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/google/uuid"
+)
+
+func NewClient(opts ...Option) (*Client, error) {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	base, err := url.Parse(cfg.ServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server URL: %w", err)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		tlsCfg, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsCfg,
+			},
+		}
+	}
+
+	return &Client{
+		base: base,
+		http: httpClient,
+		cfg:  cfg,
+	}, nil
+}
+
+type Client struct {
+	base *url.URL
+	http *http.Client
+	cfg  Config
+}
+
+func (c *Client) CreateRun(ctx context.Context, req api.PostRunRequest) (api.PostRunResponse, error) {
+	var res api.PostRunResponse
+
+	if err := c.do(ctx, http.MethodPost, "/run/", nil, req, &res); err != nil {
+		return api.PostRunResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) CreateRunWithIdempotencyKey(ctx context.Context, key string, req api.PostRunRequest) (api.PostRunResponse, error) {
+	var res api.PostRunResponse
+
+	header := http.Header{}
+	header.Set(api.HeaderIdempotencyKey, key)
+
+	if err := c.do(ctx, http.MethodPost, "/run/", header, req, &res); err != nil {
+		return api.PostRunResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) GetRun(ctx context.Context, id uuid.UUID) (api.GetRunResponse, error) {
+	var res api.GetRunResponse
+
+	if err := c.do(ctx, http.MethodGet, "/run/"+id.String(), nil, nil, &res); err != nil {
+		return api.GetRunResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) ListRuns(ctx context.Context, labels ...string) (api.ListRunsResponse, error) {
+	var res api.ListRunsResponse
+
+	path := "/run/"
+	if len(labels) > 0 {
+		path += "?" + url.Values{"label": labels}.Encode()
+	}
+
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &res); err != nil {
+		return api.ListRunsResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) ScraperHealth(ctx context.Context) (api.GetScraperHealthResponse, error) {
+	var res api.GetScraperHealthResponse
+
+	if err := c.do(ctx, http.MethodGet, "/health/scrapers", nil, nil, &res); err != nil {
+		return api.GetScraperHealthResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) CancelRun(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodPost, "/run/"+id.String()+"/cancel", nil, nil, nil)
+}
+
+func (c *Client) WaitRun(ctx context.Context, id uuid.UUID) (api.GetRunResponse, error) {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		run, err := c.GetRun(ctx, id)
+		if err != nil {
+			return api.GetRunResponse{}, err
+		}
+
+		if run.Status.Terminal() {
+			return run, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// StreamRunEvents calls fn with each event of a run until the run finishes.
+// Streams which end early, e.g. because the server dropped a slow client or
+// the connection was lost, are resumed after the last received event.
+func (c *Client) StreamRunEvents(ctx context.Context, id uuid.UUID, fn func(api.RunEvent) error) error {
+	var (
+		lastID   uint64
+		finished bool
+		fnErr    error
+	)
+
+	handle := func(event api.RunEvent) error {
+		lastID = event.ID
+		finished = event.Type == api.RunEventRunFinished
+		fnErr = fn(event)
+
+		return fnErr
+	}
+
+	for attempts := 1; ; attempts++ {
+		resumeFrom := lastID
+
+		err := c.streamRunEvents(ctx, id, lastID, handle)
+
+		var statusErr *StatusError
+
+		switch {
+		case fnErr != nil:
+			return fnErr
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case finished:
+			return nil
+		case errors.As(err, &statusErr):
+			return err
+		}
+
+		if lastID != resumeFrom {
+			attempts = 1
+		}
+		if attempts >= maxStreamAttempts {
+			if err != nil {
+				return err
+			}
+
+			return errStreamEnded
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// maxStreamAttempts bounds reconnects which deliver no new events.
+const maxStreamAttempts = 5
+
+var errStreamEnded = errors.New("event stream ended before the run finished")
+
+func (c *Client) streamRunEvents(ctx context.Context, id uuid.UUID, lastID uint64, fn func(api.RunEvent) error) error {
+	header := http.Header{}
+	header.Set("Accept", "text/event-stream")
+
+	if lastID > 0 {
+		header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+
+	res, err := c.send(ctx, http.MethodGet, "/run/"+id.String()+"/events", header, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var data strings.Builder
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			var event api.RunEvent
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				return fmt.Errorf("decoding event: %w", err)
+			}
+
+			data.Reset()
+
+			if err := fn(event); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading events: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body, out any) error {
+	res, err := c.send(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body any) (*http.Response, error) {
+	var reqBody io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding request: %w", err)
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("parsing path: %w", err)
+	}
+
+	target := c.base.JoinPath(ref.Path)
+	target.RawQuery = ref.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		return nil, &StatusError{
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(data)),
+		}
+	}
+
+	return res, nil
+}
+
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("server responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+type Config struct {
+	ServerURL          string
+	HTTPClient         *http.Client
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	PollInterval       time.Duration
+	ReconnectDelay     time.Duration
+	Token              string
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureClient(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.ServerURL == "" {
+		c.ServerURL = "https://localhost:8080"
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.ReconnectDelay <= 0 {
+		c.ReconnectDelay = time.Second
+	}
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+type Option interface {
+	ConfigureClient(*Config)
+}
+
+type WithServerURL string
+
+func (w WithServerURL) ConfigureClient(c *Config) {
+	c.ServerURL = string(w)
+}
+
+type WithHTTPClient struct {
+	Client *http.Client
+}
+
+func (w WithHTTPClient) ConfigureClient(c *Config) {
+	c.HTTPClient = w.Client
+}
+
+type WithCAFile string
+
+func (w WithCAFile) ConfigureClient(c *Config) {
+	c.CAFile = string(w)
+}
+
+type WithClientCertificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+func (w WithClientCertificate) ConfigureClient(c *Config) {
+	c.CertFile = w.CertFile
+	c.KeyFile = w.KeyFile
+}
+
+type WithInsecureSkipVerify bool
+
+func (w WithInsecureSkipVerify) ConfigureClient(c *Config) {
+	c.InsecureSkipVerify = bool(w)
+}
+
+type WithPollInterval time.Duration
+
+func (w WithPollInterval) ConfigureClient(c *Config) {
+	c.PollInterval = time.Duration(w)
+}
+
+type WithReconnectDelay time.Duration
+
+func (w WithReconnectDelay) ConfigureClient(c *Config) {
+	c.ReconnectDelay = time.Duration(w)
+}
+
+type WithToken string
+
+func (w WithToken) ConfigureClient(c *Config) {
+	c.Token = string(w)
+}
@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/ajpantuso/pen-finder/internal/server"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRunLifecycle(t *testing.T) {
+	srv := server.NewDefaultServer(server.WithRunner{Runner: blockingRunner{}})
+
+	ts := httptest.NewTLSServer(srv.Handler())
+	defer ts.Close()
+
+	c, err := NewClient(
+		WithServerURL(ts.URL),
+		WithHTTPClient{Client: ts.Client()},
+		WithPollInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := c.CreateRun(ctx, api.PostRunRequest{})
+	require.NoError(t, err)
+
+	run, err := c.GetRun(ctx, created.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, api.RunStatusInProgress, run.Status)
+
+	list, err := c.ListRuns(ctx)
+	require.NoError(t, err)
+	require.Len(t, list.Runs, 1)
+	assert.Equal(t, created.RunID, list.Runs[0].ID)
+
+	require.NoError(t, c.CancelRun(ctx, created.RunID))
+
+	run, err = c.WaitRun(ctx, created.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, api.RunStatusCancelled, run.Status)
+
+	var statusErr *StatusError
+
+	require.ErrorAs(t, c.CancelRun(ctx, created.RunID), &statusErr)
+	assert.Equal(t, 409, statusErr.StatusCode)
+}
+
+func TestClientStreamRunEvents(t *testing.T) {
+	srv := server.NewDefaultServer(server.WithRunner{Runner: eventRunner{}})
+
+	ts := httptest.NewTLSServer(srv.Handler())
+	defer ts.Close()
+
+	c, err := NewClient(
+		WithServerURL(ts.URL),
+		WithHTTPClient{Client: ts.Client()},
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := c.CreateRun(ctx, api.PostRunRequest{})
+	require.NoError(t, err)
+
+	var types []api.RunEventType
+
+	require.NoError(t, c.StreamRunEvents(ctx, created.RunID, func(event api.RunEvent) error {
+		assert.Equal(t, created.RunID, event.RunID)
+
+		types = append(types, event.Type)
+
+		return nil
+	}))
+
+	assert.Equal(t, []api.RunEventType{
+		api.RunEventScraperStarted,
+		api.RunEventPageVisited,
+		api.RunEventProductRecorded,
+		api.RunEventScraperFinished,
+		api.RunEventRunFinished,
+	}, types)
+}
+
+func TestClientStreamRunEventsReconnects(t *testing.T) {
+	runID := uuid.New()
+
+	var lastEventIDs []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		// every stream ends early after one event
+		id := len(lastEventIDs)
+
+		typ := api.RunEventPageVisited
+		if id == 3 {
+			typ = api.RunEventRunFinished
+		}
+
+		data, err := json.Marshal(api.RunEvent{ID: uint64(id), RunID: runID, Type: typ})
+		require.NoError(t, err)
+
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, typ, data)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(WithServerURL(ts.URL), WithReconnectDelay(time.Millisecond))
+	require.NoError(t, err)
+
+	var ids []uint64
+
+	require.NoError(t, c.StreamRunEvents(context.Background(), runID, func(event api.RunEvent) error {
+		ids = append(ids, event.ID)
+
+		return nil
+	}))
+
+	assert.Equal(t, []uint64{1, 2, 3}, ids)
+	assert.Equal(t, []string{"", "1", "2"}, lastEventIDs, "streams resume after the last received event")
+}
+
+func TestClientStreamRunEventsGivesUp(t *testing.T) {
+	var requests int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+
+		w.Header().Set("Content-Type", "text/event-stream")
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(WithServerURL(ts.URL), WithReconnectDelay(time.Millisecond))
+	require.NoError(t, err)
+
+	err = c.StreamRunEvents(context.Background(), uuid.New(), func(api.RunEvent) error { return nil })
+	assert.ErrorIs(t, err, errStreamEnded)
+	assert.Equal(t, maxStreamAttempts, requests)
+}
+
+type eventRunner struct{}
+
+func (eventRunner) Run(_ context.Context, opts ...scraper.RunOption) error {
+	var runCfg scraper.RunConfig
+
+	runCfg.Options(opts...)
+
+	var cfg scraper.ScrapeConfig
+
+	cfg.Options(runCfg.ScrapeOptions...)
+	cfg.Default()
+
+	for _, typ := range []scraper.EventType{
+		scraper.EventScraperStarted,
+		scraper.EventPageVisited,
+		scraper.EventProductRecorded,
+		scraper.EventScraperFinished,
+	} {
+		cfg.Events.HandleEvent(scraper.Event{Type: typ, Source: "test", Time: time.Now()})
+	}
+
+	return nil
+}
+
+type blockingRunner struct{}
+
+func (blockingRunner) Run(ctx context.Context, _ ...scraper.RunOption) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+type Role string
+
+const (
+	RoleReader   Role = "reader"
+	RoleOperator Role = "operator"
+)
+
+func (r Role) Valid() bool {
+	return r == RoleReader || r == RoleOperator
+}
+
+func (r Role) Allows(required Role) bool {
+	switch r {
+	case RoleOperator:
+		return required == RoleOperator || required == RoleReader
+	case RoleReader:
+		return required == RoleReader
+	default:
+		return false
+	}
+}
+
+type Token struct {
+	ID        string    `yaml:"id"`
+	Name      string    `yaml:"name"`
+	Role      Role      `yaml:"role"`
+	Hash      string    `yaml:"hash"`
+	CreatedAt time.Time `yaml:"createdAt"`
+}
+
+type tokenFile struct {
+	Tokens []Token `yaml:"tokens"`
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{
+		path: path,
+		lock: &sync.RWMutex{},
+	}
+}
+
+type FileTokenStore struct {
+	path   string
+	lock   *sync.RWMutex
+	tokens []Token
+	// info describes the file tokens were last read from
+	info os.FileInfo
+}
+
+func (s *FileTokenStore) Authenticate(secret string) (Token, error) {
+	if err := s.refresh(); err != nil {
+		return Token{}, err
+	}
+
+	sum := hashSecret(secret)
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(sum)) == 1 {
+			return token, nil
+		}
+	}
+
+	return Token{}, ErrInvalidToken
+}
+
+func (s *FileTokenStore) List() ([]Token, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return slices.Clone(s.tokens), nil
+}
+
+func (s *FileTokenStore) Mint(name string, role Role) (string, Token, error) {
+	if !role.Valid() {
+		return "", Token{}, fmt.Errorf("unknown role %q", role)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Token{}, fmt.Errorf("generating token: %w", err)
+	}
+
+	// the ID is shown and logged so it must not reveal any of the secret
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", Token{}, fmt.Errorf("generating token ID: %w", err)
+	}
+
+	secret := "pf_" + base64.RawURLEncoding.EncodeToString(raw)
+	token := Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Role:      role,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.update(func(tokens []Token) ([]Token, error) {
+		return append(tokens, token), nil
+	}); err != nil {
+		return "", Token{}, err
+	}
+
+	return secret, token, nil
+}
+
+func (s *FileTokenStore) Revoke(id string) error {
+	return s.update(func(tokens []Token) ([]Token, error) {
+		idx := slices.IndexFunc(tokens, func(t Token) bool { return t.ID == id })
+		if idx < 0 {
+			return nil, ErrTokenNotFound
+		}
+
+		return slices.Delete(tokens, idx, idx+1), nil
+	})
+}
+
+func (s *FileTokenStore) refresh() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.lock.Lock()
+		s.tokens, s.info = nil, nil
+		s.lock.Unlock()
+
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("inspecting token file: %w", err)
+	}
+
+	s.lock.RLock()
+	current := unchanged(s.info, info)
+	s.lock.RUnlock()
+
+	if current {
+		return nil
+	}
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.tokens, s.info = tokens, info
+	s.lock.Unlock()
+
+	return nil
+}
+
+// unchanged compares the file, size and modification time since
+// modification times alone are too coarse on some filesystems to notice a
+// token file replaced within the same tick.
+func unchanged(old, next os.FileInfo) bool {
+	return old != nil &&
+		os.SameFile(old, next) &&
+		old.Size() == next.Size() &&
+		old.ModTime().Equal(next.ModTime())
+}
+
+func (s *FileTokenStore) read() ([]Token, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+
+	var file tokenFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding token file: %w", err)
+	}
+
+	return file.Tokens, nil
+}
+
+func (s *FileTokenStore) update(fn func([]Token) ([]Token, error)) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	tokens, err = fn(tokens)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(tokenFile{Tokens: tokens})
+	if err != nil {
+		return fmt.Errorf("encoding token file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing token file: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replacing token file: %w", err)
+	}
+
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, token)
+}
+
+func TokenFrom(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(contextKey{}).(Token)
+
+	return token, ok
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTokenStoreMint(t *testing.T) {
+	store := NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.yaml"))
+
+	secret, token, err := store.Mint("ci", RoleOperator)
+	require.NoError(t, err)
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(secret, "pf_"))
+	require.NoError(t, err)
+
+	assert.Len(t, token.ID, 8)
+	assert.NotContains(t, hex.EncodeToString(raw), token.ID, "ID does not reveal the secret")
+
+	authenticated, err := store.Authenticate(secret)
+	require.NoError(t, err)
+	assert.Equal(t, token, authenticated)
+
+	_, err = store.Authenticate("pf_wrong")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestFileTokenStoreRefresh(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.yaml")
+
+	store := NewFileTokenStore(path)
+
+	oldSecret, oldToken, err := store.Mint("ci", RoleReader)
+	require.NoError(t, err)
+
+	_, err = store.Authenticate(oldSecret)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// replace the file with one of the same size and modification time as
+	// another process rotating the secret within the same tick would
+	newSecret := "pf_rotated"
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	data = []byte(strings.Replace(string(data), oldToken.Hash, hashSecret(newSecret), 1))
+
+	tmp := filepath.Join(dir, "tokens.yaml.new")
+	require.NoError(t, os.WriteFile(tmp, data, 0o600))
+	require.NoError(t, os.Chtimes(tmp, info.ModTime(), info.ModTime()))
+	require.NoError(t, os.Rename(tmp, path))
+
+	_, err = store.Authenticate(newSecret)
+	require.NoError(t, err, "replaced file is read again")
+
+	_, err = store.Authenticate(oldSecret)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, os.Remove(path))
+
+	_, err = store.Authenticate(newSecret)
+	assert.ErrorIs(t, err, ErrInvalidToken, "removed file revokes every token")
+}
@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const Version = 1
+
+var (
+	ErrInteractionNotFound = errors.New("no recorded interaction")
+	ErrUnsupportedVersion  = errors.New("unsupported cassette version")
+	ErrPathRequired        = errors.New("path is required")
+)
+
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("decoding cassette %s: %w", path, err)
+	}
+
+	if c.Version != Version {
+		return nil, fmt.Errorf("%s has version %d: %w", path, c.Version, ErrUnsupportedVersion)
+	}
+
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating cassette directory: %w", err)
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func (c *Cassette) find(method, url string) (Interaction, bool) {
+	for _, i := range c.Interactions {
+		if i.Request.Method == method && i.Request.URL == url {
+			return i, true
+		}
+	}
+
+	return Interaction{}, false
+}
+
+type Mode string
+
+const (
+	ModeReplay Mode = "replay"
+	ModeRecord Mode = "record"
+)
+
+func NewTransport(opts ...Option) (*Transport, error) {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	if cfg.Path == "" {
+		return nil, ErrPathRequired
+	}
+
+	t := &Transport{
+		cfg:      cfg,
+		cassette: &Cassette{Version: Version},
+		lock:     &sync.Mutex{},
+	}
+
+	switch cfg.Mode {
+	case ModeReplay:
+		c, err := Load(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		t.cassette = c
+	case ModeRecord:
+	default:
+		return nil, fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+
+	return t, nil
+}
+
+type Transport struct {
+	cfg      Config
+	cassette *Cassette
+	lock     *sync.Mutex
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.Mode == ModeRecord {
+		return t.record(req)
+	}
+
+	t.lock.Lock()
+	i, ok := t.cassette.find(req.Method, req.URL.String())
+	t.lock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrInteractionNotFound)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.Status, http.StatusText(i.Response.Status)),
+		StatusCode:    i.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(i.Response.Body))),
+		ContentLength: int64(len(i.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	res, err := t.cfg.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	// bodies are stored decoded so the original framing no longer applies
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Del("Set-Cookie")
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.cassette.find(req.Method, req.URL.String()); !ok {
+		t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+			Request: Request{
+				Method: req.Method,
+				URL:    req.URL.String(),
+			},
+			Response: Response{
+				Status: res.StatusCode,
+				Header: header,
+				Body:   string(body),
+			},
+		})
+	}
+
+	return res, nil
+}
+
+func (t *Transport) Save() error {
+	if t.cfg.Mode != ModeRecord {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.cassette.Save(t.cfg.Path)
+}
+
+type Config struct {
+	Path      string
+	Mode      Mode
+	Transport http.RoundTripper
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureTransport(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Mode == "" {
+		c.Mode = ModeReplay
+	}
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+}
+
+type Option interface {
+	ConfigureTransport(*Config)
+}
+
+type WithPath string
+
+func (w WithPath) ConfigureTransport(c *Config) {
+	c.Path = string(w)
+}
+
+type WithMode Mode
+
+func (w WithMode) ConfigureTransport(c *Config) {
+	c.Mode = Mode(w)
+}
+
+type WithTransport struct {
+	Transport http.RoundTripper
+}
+
+func (w WithTransport) ConfigureTransport(c *Config) {
+	c.Transport = w.Transport
+}
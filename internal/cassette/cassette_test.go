@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "page "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "shop.json")
+
+	get := func(client *http.Client, url string) (string, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+
+		return string(body), err
+	}
+
+	recorder, err := NewTransport(WithPath(path), WithMode(ModeRecord))
+	require.NoError(t, err)
+
+	for range 2 {
+		body, err := get(&http.Client{Transport: recorder}, srv.URL+"/collections/pens")
+		require.NoError(t, err)
+		assert.Equal(t, "page /collections/pens", body)
+	}
+
+	require.NoError(t, recorder.Save())
+
+	saved, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, Version, saved.Version)
+	assert.Len(t, saved.Interactions, 1, "repeated requests are recorded once")
+
+	srv.Close()
+
+	replayer, err := NewTransport(WithPath(path))
+	require.NoError(t, err)
+
+	body, err := get(&http.Client{Transport: replayer}, srv.URL+"/collections/pens")
+	require.NoError(t, err)
+	assert.Equal(t, "page /collections/pens", body)
+	assert.Equal(t, 2, requests, "replay does not touch the network")
+
+	_, err = get(&http.Client{Transport: replayer}, srv.URL+"/collections/inks")
+	assert.ErrorIs(t, err, ErrInteractionNotFound)
+}
+
+func TestLoadUnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shop.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99, "interactions": []}`), 0o600))
+
+	_, err := NewTransport(WithPath(path))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
@@ -0,0 +1,303 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package catalog
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Catalog interface {
+	recorder.Recorder
+	Search(Query) (Page, error)
+}
+
+type Entry struct {
+	Source       string
+	Name         string
+	URL          string
+	Price        float64
+	Availability recorder.Availability
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+func (e Entry) key() string {
+	return e.Source + "|" + e.URL
+}
+
+type Query struct {
+	Text            string
+	Sources         []string
+	FirstSeenAfter  time.Time
+	FirstSeenBefore time.Time
+	// MinPrice and MaxPrice bound the price when non-zero. Entries with an
+	// unknown price never match a price bound.
+	MinPrice     float64
+	MaxPrice     float64
+	Availability []recorder.Availability
+	Sort         Sort
+	Cursor       string
+	Limit        int
+}
+
+func (q *Query) Default() {
+	if q.Sort == "" {
+		q.Sort = SortFirstSeenDesc
+	}
+	if q.Limit < 1 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+}
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+type Sort string
+
+const (
+	SortName          Sort = "name"
+	SortNameDesc      Sort = "-name"
+	SortFirstSeen     Sort = "firstSeen"
+	SortFirstSeenDesc Sort = "-firstSeen"
+	SortLastSeen      Sort = "lastSeen"
+	SortLastSeenDesc  Sort = "-lastSeen"
+)
+
+func (s Sort) Valid() bool {
+	switch s {
+	case SortName, SortNameDesc, SortFirstSeen, SortFirstSeenDesc, SortLastSeen, SortLastSeenDesc:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s Sort) compare(a, b Entry) int {
+	var res int
+
+	switch s {
+	case SortName, SortNameDesc:
+		res = cmp.Compare(a.Name, b.Name)
+	case SortFirstSeen, SortFirstSeenDesc:
+		res = a.FirstSeen.Compare(b.FirstSeen)
+	case SortLastSeen, SortLastSeenDesc:
+		res = a.LastSeen.Compare(b.LastSeen)
+	}
+
+	if strings.HasPrefix(string(s), "-") {
+		res = -res
+	}
+	if res == 0 {
+		res = cmp.Compare(a.key(), b.key())
+	}
+
+	return res
+}
+
+type Page struct {
+	Entries    []Entry
+	NextCursor string
+}
+
+func NewThreadSafeCatalog() *ThreadSafeCatalog {
+	return &ThreadSafeCatalog{
+		data: make(map[string]Entry),
+		lock: &sync.RWMutex{},
+	}
+}
+
+type ThreadSafeCatalog struct {
+	data map[string]Entry
+	lock *sync.RWMutex
+}
+
+func (c *ThreadSafeCatalog) RecordProduct(product recorder.Product) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	entry := Entry{
+		Source:       product.Source,
+		Name:         product.Name,
+		URL:          product.URL,
+		Price:        product.Price,
+		Availability: product.Availability,
+		FirstSeen:    now,
+		LastSeen:     now,
+	}
+
+	if existing, ok := c.data[entry.key()]; ok {
+		entry.FirstSeen = existing.FirstSeen
+
+		// sources which cannot see price or stock keep what others last saw
+		if entry.Price == 0 {
+			entry.Price = existing.Price
+		}
+		if entry.Availability == recorder.AvailabilityUnknown {
+			entry.Availability = existing.Availability
+		}
+	}
+
+	c.data[entry.key()] = entry
+
+	return nil
+}
+
+func (c *ThreadSafeCatalog) Search(query Query) (Page, error) {
+	query.Default()
+
+	if !query.Sort.Valid() {
+		return Page{}, fmt.Errorf("unknown sort %q", query.Sort)
+	}
+
+	var (
+		after    *Entry
+		hasAfter bool
+	)
+
+	if query.Cursor != "" {
+		entry, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+
+		after, hasAfter = &entry, true
+	}
+
+	terms := tokenize(query.Text)
+
+	c.lock.RLock()
+
+	matches := make([]Entry, 0, len(c.data))
+	for _, entry := range c.data {
+		if query.matches(entry, terms) {
+			matches = append(matches, entry)
+		}
+	}
+
+	c.lock.RUnlock()
+
+	slices.SortFunc(matches, query.Sort.compare)
+
+	if hasAfter {
+		idx, _ := slices.BinarySearchFunc(matches, *after, query.Sort.compare)
+		if idx < len(matches) && matches[idx].key() == after.key() {
+			idx++
+		}
+
+		matches = matches[idx:]
+	}
+
+	var page Page
+
+	if len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+
+		cursor, err := encodeCursor(matches[len(matches)-1])
+		if err != nil {
+			return Page{}, err
+		}
+
+		page.NextCursor = cursor
+	}
+
+	page.Entries = matches
+
+	return page, nil
+}
+
+func (q Query) matches(entry Entry, terms []string) bool {
+	if len(q.Sources) > 0 && !slices.Contains(q.Sources, entry.Source) {
+		return false
+	}
+	if !q.FirstSeenAfter.IsZero() && entry.FirstSeen.Before(q.FirstSeenAfter) {
+		return false
+	}
+	if !q.FirstSeenBefore.IsZero() && !entry.FirstSeen.Before(q.FirstSeenBefore) {
+		return false
+	}
+	if (q.MinPrice > 0 || q.MaxPrice > 0) && entry.Price == 0 {
+		return false
+	}
+	if q.MinPrice > 0 && entry.Price < q.MinPrice {
+		return false
+	}
+	if q.MaxPrice > 0 && entry.Price > q.MaxPrice {
+		return false
+	}
+	if len(q.Availability) > 0 && !slices.Contains(q.Availability, entry.Availability) {
+		return false
+	}
+	if len(terms) == 0 {
+		return true
+	}
+
+	name := tokenize(entry.Name)
+	for _, term := range terms {
+		if !slices.ContainsFunc(name, func(word string) bool {
+			return strings.HasPrefix(word, term)
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	})
+}
+
+type cursor struct {
+	Source       string                `json:"s"`
+	Name         string                `json:"n"`
+	URL          string                `json:"u"`
+	Price        float64               `json:"p,omitempty"`
+	Availability recorder.Availability `json:"a,omitempty"`
+	FirstSeen    time.Time             `json:"f"`
+	LastSeen     time.Time             `json:"l"`
+}
+
+func encodeCursor(entry Entry) (string, error) {
+	data, err := json.Marshal(cursor(entry))
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw string) (Entry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return Entry{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Entry{}, ErrInvalidCursor
+	}
+
+	return Entry(c), nil
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package catalog
+
+import (
+	"testing"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadSafeCatalogSearch(t *testing.T) {
+	c := NewThreadSafeCatalog()
+
+	for _, p := range []recorder.Product{
+		{Source: "truphae", Name: "pelikan-m800-green-striated", URL: "https://truphaeinc.com/products/pelikan-m800-green-striated"},
+		{Source: "truphae", Name: "pelikan-m400-tortoise", URL: "https://truphaeinc.com/products/pelikan-m400-tortoise"},
+		{Source: "fountain_pen_hospital", Name: "pilot-custom-823", URL: "https://fountainpenhospital.com/products/pilot-custom-823"},
+	} {
+		require.NoError(t, c.RecordProduct(p))
+	}
+
+	page, err := c.Search(Query{Text: "Pelikan", Sort: SortName})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, "pelikan-m400-tortoise", page.Entries[0].Name)
+	assert.Empty(t, page.NextCursor)
+
+	page, err = c.Search(Query{Sources: []string{"fountain_pen_hospital"}})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "pilot-custom-823", page.Entries[0].Name)
+
+	var names []string
+
+	query := Query{Sort: SortName, Limit: 2}
+	for {
+		page, err := c.Search(query)
+		require.NoError(t, err)
+
+		for _, e := range page.Entries {
+			names = append(names, e.Name)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		query.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, []string{"pelikan-m400-tortoise", "pelikan-m800-green-striated", "pilot-custom-823"}, names)
+
+	_, err = c.Search(Query{Cursor: "!!"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestThreadSafeCatalogPriceAndAvailability(t *testing.T) {
+	c := NewThreadSafeCatalog()
+
+	for _, p := range []recorder.Product{
+		{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800", Price: 980, Availability: recorder.AvailabilityInStock},
+		{Source: "truphae", Name: "pelikan-m400", URL: "https://truphaeinc.com/products/pelikan-m400", Price: 320, Availability: recorder.AvailabilitySoldOut},
+		{Source: "classifieds", Name: "pelikan-m1000", URL: "https://forum.example/topic/1"},
+	} {
+		require.NoError(t, c.RecordProduct(p))
+	}
+
+	names := func(query Query) []string {
+		page, err := c.Search(query)
+		require.NoError(t, err)
+
+		var names []string
+		for _, e := range page.Entries {
+			names = append(names, e.Name)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"pelikan-m400", "pelikan-m800"}, names(Query{Sort: SortName, MinPrice: 1}), "unknown prices never match a price bound")
+	assert.Equal(t, []string{"pelikan-m400"}, names(Query{Sort: SortName, MaxPrice: 500}))
+	assert.Equal(t, []string{"pelikan-m800"}, names(Query{Sort: SortName, MinPrice: 500, MaxPrice: 1000}))
+	assert.Equal(t, []string{"pelikan-m800"}, names(Query{Sort: SortName, Availability: []recorder.Availability{recorder.AvailabilityInStock}}))
+
+	require.NoError(t, c.RecordProduct(recorder.Product{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800"}))
+	assert.Equal(t, []string{"pelikan-m800"}, names(Query{MaxPrice: 1000, Availability: []recorder.Availability{recorder.AvailabilityInStock}}), "unknown details keep what was last seen")
+}
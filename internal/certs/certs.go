@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	CAFileName         = "ca.crt"
+	CAKeyFileName      = "ca.key"
+	ServerCertFileName = "server.crt"
+	ServerKeyFileName  = "server.key"
+)
+
+var DefaultSANs = []string{"localhost", "127.0.0.1", "::1"}
+
+type Paths struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+func PathsFor(dir string) Paths {
+	return Paths{
+		CAFile:   filepath.Join(dir, CAFileName),
+		CertFile: filepath.Join(dir, ServerCertFileName),
+		KeyFile:  filepath.Join(dir, ServerKeyFileName),
+	}
+}
+
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "pen-finder", "dev-tls"), nil
+}
+
+func NewGenerator(opts ...Option) *Generator {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &Generator{
+		cfg: cfg,
+	}
+}
+
+type Generator struct {
+	cfg Config
+}
+
+func (g *Generator) Ensure() (Paths, error) {
+	paths := PathsFor(g.cfg.Dir)
+
+	if !g.cfg.Force && g.serverCertUsable(paths) {
+		return paths, nil
+	}
+
+	return g.Generate()
+}
+
+func (g *Generator) Generate() (Paths, error) {
+	if err := os.MkdirAll(g.cfg.Dir, 0o700); err != nil {
+		return Paths{}, fmt.Errorf("creating directory: %w", err)
+	}
+
+	ca, caKey, err := g.loadOrCreateCA()
+	if err != nil {
+		return Paths{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Paths{}, fmt.Errorf("generating server key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return Paths{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "pen-finder"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(g.cfg.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, san := range g.cfg.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, san)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return Paths{}, fmt.Errorf("creating server certificate: %w", err)
+	}
+
+	paths := PathsFor(g.cfg.Dir)
+
+	if err := writeKey(paths.KeyFile, key); err != nil {
+		return Paths{}, err
+	}
+	if err := writeCert(paths.CertFile, der); err != nil {
+		return Paths{}, err
+	}
+
+	return paths, nil
+}
+
+func (g *Generator) loadOrCreateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caFile := filepath.Join(g.cfg.Dir, CAFileName)
+	caKeyFile := filepath.Join(g.cfg.Dir, CAKeyFileName)
+
+	if !g.cfg.Force {
+		ca, key, err := loadKeyPair(caFile, caKeyFile)
+		if err == nil && time.Now().Add(g.cfg.Validity).Before(ca.NotAfter) {
+			return ca, key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating CA key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "pen-finder development CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10 * g.cfg.Validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating CA certificate: %w", err)
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+
+	if err := writeKey(caKeyFile, key); err != nil {
+		return nil, nil, err
+	}
+	if err := writeCert(caFile, der); err != nil {
+		return nil, nil, err
+	}
+
+	return ca, key, nil
+}
+
+func (g *Generator) serverCertUsable(paths Paths) bool {
+	leaf, _, err := loadKeyPair(paths.CertFile, paths.KeyFile)
+	if err != nil {
+		return false
+	}
+
+	if time.Now().Add(g.cfg.Validity / 10).After(leaf.NotAfter) {
+		return false
+	}
+
+	if _, err := os.Stat(paths.CAFile); err != nil {
+		return false
+	}
+
+	return slices.IndexFunc(g.cfg.SANs, func(san string) bool {
+		return leaf.VerifyHostname(san) != nil
+	}) < 0
+}
+
+func loadKeyPair(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", pair.PrivateKey)
+	}
+
+	return leaf, key, nil
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+
+	return serial, nil
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encoding key: %w", err)
+	}
+
+	return writePEM(path, "EC PRIVATE KEY", der, 0o600)
+}
+
+func writeCert(path string, der []byte) error {
+	return writePEM(path, "CERTIFICATE", der, 0o644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return multierr.Combine(fmt.Errorf("replacing %s: %w", path, err), os.Remove(tmp))
+	}
+
+	return nil
+}
+
+type Config struct {
+	Dir      string
+	SANs     []string
+	Validity time.Duration
+	Force    bool
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureGenerator(c)
+	}
+}
+
+func (c *Config) Default() {
+	if len(c.SANs) == 0 {
+		c.SANs = DefaultSANs
+	}
+	if c.Validity <= 0 {
+		c.Validity = 90 * 24 * time.Hour
+	}
+}
+
+type Option interface {
+	ConfigureGenerator(*Config)
+}
+
+type WithDir string
+
+func (w WithDir) ConfigureGenerator(c *Config) {
+	c.Dir = string(w)
+}
+
+type WithSANs []string
+
+func (w WithSANs) ConfigureGenerator(c *Config) {
+	c.SANs = append(c.SANs, w...)
+}
+
+type WithValidity time.Duration
+
+func (w WithValidity) ConfigureGenerator(c *Config) {
+	c.Validity = time.Duration(w)
+}
+
+type WithForce bool
+
+func (w WithForce) ConfigureGenerator(c *Config) {
+	c.Force = bool(w)
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package certs
+
+import (
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorEnsure(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := NewGenerator(WithDir(dir)).Ensure()
+	require.NoError(t, err)
+
+	leaf, _, err := loadKeyPair(paths.CertFile, paths.KeyFile)
+	require.NoError(t, err)
+
+	caPEM, err := os.ReadFile(paths.CAFile)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: pool})
+	require.NoError(t, err)
+
+	_, err = NewGenerator(WithDir(dir)).Ensure()
+	require.NoError(t, err)
+
+	reused, _, err := loadKeyPair(paths.CertFile, paths.KeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, leaf.SerialNumber, reused.SerialNumber)
+
+	_, err = NewGenerator(WithDir(dir), WithSANs{"pen-finder.internal"}).Ensure()
+	require.NoError(t, err)
+
+	regenerated, _, err := loadKeyPair(paths.CertFile, paths.KeyFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, leaf.SerialNumber, regenerated.SerialNumber)
+	assert.NoError(t, regenerated.VerifyHostname("pen-finder.internal"))
+	assert.Equal(t, leaf.Issuer, regenerated.Issuer)
+}
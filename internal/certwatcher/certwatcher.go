@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func NewCertWatcher(opts ...Option) (*CertWatcher, error) {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	w := &CertWatcher{
+		cfg:  cfg,
+		lock: &sync.RWMutex{},
+	}
+
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+type CertWatcher struct {
+	cfg     Config
+	lock    *sync.RWMutex
+	cert    *tls.Certificate
+	version fileVersion
+}
+
+func (w *CertWatcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	return w.cert, nil
+}
+
+func (w *CertWatcher) Watch(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			version, err := w.currentVersion()
+			if err != nil {
+				w.cfg.Logger.Error(err, "checking certificate files")
+
+				continue
+			}
+
+			w.lock.RLock()
+			changed := version != w.version
+			w.lock.RUnlock()
+
+			if !changed {
+				continue
+			}
+
+			if err := w.reload(); err != nil {
+				w.cfg.Logger.Error(err, "reloading certificate")
+
+				continue
+			}
+
+			w.cfg.Logger.Info("reloaded certificate", "certFile", w.cfg.CertFile)
+		}
+	}
+}
+
+func (w *CertWatcher) reload() error {
+	version, err := w.currentVersion()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(w.cfg.CertFile, w.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.cert = &cert
+	w.version = version
+
+	return nil
+}
+
+type fileVersion struct {
+	certModTime time.Time
+	certSize    int64
+	keyModTime  time.Time
+	keySize     int64
+}
+
+func (w *CertWatcher) currentVersion() (fileVersion, error) {
+	certInfo, err := os.Stat(w.cfg.CertFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("inspecting certificate: %w", err)
+	}
+
+	keyInfo, err := os.Stat(w.cfg.KeyFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("inspecting key: %w", err)
+	}
+
+	return fileVersion{
+		certModTime: certInfo.ModTime(),
+		certSize:    certInfo.Size(),
+		keyModTime:  keyInfo.ModTime(),
+		keySize:     keyInfo.Size(),
+	}, nil
+}
+
+type Config struct {
+	CertFile string
+	KeyFile  string
+	Interval time.Duration
+	Logger   logr.Logger
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureCertWatcher(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.Logger.GetSink() == nil {
+		c.Logger = logr.Discard()
+	}
+}
+
+type Option interface {
+	ConfigureCertWatcher(*Config)
+}
+
+type WithCertFile string
+
+func (w WithCertFile) ConfigureCertWatcher(c *Config) {
+	c.CertFile = string(w)
+}
+
+type WithKeyFile string
+
+func (w WithKeyFile) ConfigureCertWatcher(c *Config) {
+	c.KeyFile = string(w)
+}
+
+type WithInterval time.Duration
+
+func (w WithInterval) ConfigureCertWatcher(c *Config) {
+	c.Interval = time.Duration(w)
+}
+
+type WithLogger struct {
+	Logger logr.Logger
+}
+
+func (w WithLogger) ConfigureCertWatcher(c *Config) {
+	c.Logger = w.Logger
+}
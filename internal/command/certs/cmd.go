@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package certs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/certs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Manages development TLS certificates",
+	}
+	cmd.AddCommand(newGenerateCommand())
+
+	return cmd
+}
+
+func newGenerateCommand() *cobra.Command {
+	flags := flags{
+		SANs:     certs.DefaultSANs,
+		Validity: 90 * 24 * time.Hour,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generates a self-signed CA and server certificate",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			dir := flags.Dir
+			if dir == "" {
+				var err error
+
+				dir, err = certs.DefaultDir()
+				if err != nil {
+					return err
+				}
+			}
+
+			paths, err := certs.NewGenerator(
+				certs.WithDir(dir),
+				certs.WithSANs(flags.SANs),
+				certs.WithValidity(flags.Validity),
+				certs.WithForce(flags.Force),
+			).Ensure()
+			if err != nil {
+				return fmt.Errorf("generating certificates: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "CA certificate:     %s\n", paths.CAFile)
+			fmt.Fprintf(out, "Server certificate: %s\n", paths.CertFile)
+			fmt.Fprintf(out, "Server key:         %s\n", paths.KeyFile)
+
+			return nil
+		},
+	}
+	flags.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+type flags struct {
+	Dir      string
+	SANs     []string
+	Validity time.Duration
+	Force    bool
+}
+
+func (f *flags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.Dir, "dir", f.Dir, "Directory to write certificates to (defaults to the user cache directory)")
+	flags.StringSliceVar(&f.SANs, "san", f.SANs, "DNS names and IP addresses the server certificate is valid for")
+	flags.DurationVar(&f.Validity, "validity", f.Validity, "Validity period of the server certificate")
+	flags.BoolVar(&f.Force, "force", f.Force, "Regenerate certificates even if valid ones exist")
+}
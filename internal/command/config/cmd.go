@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	appconfig "github.com/ajpantuso/pen-finder/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspects configuration",
+	}
+	cmd.AddCommand(newValidateCommand())
+
+	return cmd
+}
+
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate CONFIG_FILE",
+		Short: "Validates a configuration file combined with PEN_FINDER_* environment variables",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := appconfig.Load(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = cfg.Validate()
+
+			var verrs appconfig.ValidationErrors
+			if errors.As(err, &verrs) {
+				for _, verr := range verrs {
+					fmt.Fprintln(cmd.ErrOrStderr(), verr)
+				}
+
+				return fmt.Errorf("found %d configuration error(s)", len(verrs))
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", args[0])
+
+			return nil
+		},
+	}
+}
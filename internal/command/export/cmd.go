@@ -0,0 +1,420 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/parquet"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/recorder/file"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCommand() *cobra.Command {
+	flags := flags{
+		RecordFile: "products.jsonl",
+		Format:     formatCSV,
+		Mode:       modeCatalog,
+		Output:     "-",
+	}
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports recorded products from file archives",
+		RunE:  run(&flags),
+	}
+	flags.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func run(flags *flags) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		filter, err := flags.filter()
+		if err != nil {
+			return err
+		}
+
+		inputs := flags.Inputs
+		if len(inputs) == 0 {
+			inputs, err = file.ArchivePaths(flags.RecordFile)
+			if err != nil {
+				return fmt.Errorf("finding archives: %w", err)
+			}
+		}
+
+		if len(inputs) == 0 {
+			return fmt.Errorf("no archives found for %s", flags.RecordFile)
+		}
+
+		var records []file.Record
+
+		for _, input := range inputs {
+			if err := file.ReadRecords(input, func(r file.Record) error {
+				r = canonicalRecord(r)
+
+				if filter.matches(r) {
+					records = append(records, r)
+				}
+
+				return nil
+			}); err != nil {
+				return fmt.Errorf("reading %s: %w", input, err)
+			}
+		}
+
+		export := func(out io.Writer) error {
+			switch flags.Mode {
+			case modeHistory:
+				return writeHistory(out, flags.Format, records)
+			case modeCatalog:
+				return writeCatalog(out, flags.Format, summarize(records))
+			default:
+				return fmt.Errorf("unknown mode %q", flags.Mode)
+			}
+		}
+
+		if flags.Output == "-" {
+			return export(cmd.OutOrStdout())
+		}
+
+		f, err := os.Create(flags.Output)
+		if err != nil {
+			return fmt.Errorf("creating output: %w", err)
+		}
+
+		if err := export(f); err != nil {
+			f.Close()
+
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("closing output: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// canonicalRecord migrates records written before products were identified
+// by their canonical URL so that they are exported as the same product as
+// later records. URLs which cannot be parsed are kept.
+func canonicalRecord(r file.Record) file.Record {
+	if canonical, err := scraper.Canonicalize(r.URL); err == nil {
+		r.URL = canonical
+	}
+
+	return r
+}
+
+type filter struct {
+	sources []string
+	since   time.Time
+	until   time.Time
+	watch   []*regexp.Regexp
+}
+
+func (f filter) matches(r file.Record) bool {
+	if len(f.sources) > 0 && !slices.Contains(f.sources, r.Source) {
+		return false
+	}
+	if !f.since.IsZero() && r.RecordedAt.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !r.RecordedAt.Before(f.until) {
+		return false
+	}
+	if len(f.watch) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(f.watch, func(re *regexp.Regexp) bool {
+		return re.MatchString(r.Name) || re.MatchString(r.URL)
+	})
+}
+
+type entry struct {
+	Source    string    `json:"source"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	TimesSeen int       `json:"timesSeen"`
+	// FirstPrice and LastPrice are the earliest and latest known prices
+	// while Availability is the latest known availability.
+	FirstPrice   float64               `json:"firstPrice,omitempty"`
+	LastPrice    float64               `json:"lastPrice,omitempty"`
+	Availability recorder.Availability `json:"availability,omitempty"`
+
+	firstPriceAt   time.Time
+	lastPriceAt    time.Time
+	availabilityAt time.Time
+}
+
+func summarize(records []file.Record) []entry {
+	index := make(map[string]int)
+
+	var entries []entry
+
+	for _, r := range records {
+		// the case of paths may differ between records of one product
+		id, err := scraper.CanonicalKey(r.URL)
+		if err != nil {
+			id = r.URL
+		}
+
+		key := r.Source + "|" + id
+
+		i, ok := index[key]
+		if !ok {
+			i = len(entries)
+			index[key] = i
+			entries = append(entries, entry{
+				Source:    r.Source,
+				Name:      r.Name,
+				URL:       r.URL,
+				FirstSeen: r.RecordedAt,
+				LastSeen:  r.RecordedAt,
+			})
+		}
+
+		e := &entries[i]
+		e.TimesSeen++
+
+		if r.RecordedAt.Before(e.FirstSeen) {
+			e.FirstSeen = r.RecordedAt
+		}
+		if r.RecordedAt.After(e.LastSeen) {
+			// products are listed the way they were last recorded
+			e.LastSeen, e.Name, e.URL = r.RecordedAt, r.Name, r.URL
+		}
+
+		// archives are not necessarily read in the order they were recorded
+		if r.Price != 0 {
+			if e.firstPriceAt.IsZero() || r.RecordedAt.Before(e.firstPriceAt) {
+				e.FirstPrice, e.firstPriceAt = r.Price, r.RecordedAt
+			}
+			if !r.RecordedAt.Before(e.lastPriceAt) {
+				e.LastPrice, e.lastPriceAt = r.Price, r.RecordedAt
+			}
+		}
+		if r.Availability != recorder.AvailabilityUnknown && !r.RecordedAt.Before(e.availabilityAt) {
+			e.Availability, e.availabilityAt = r.Availability, r.RecordedAt
+		}
+	}
+
+	return entries
+}
+
+var historyColumns = []parquet.Column{
+	{Name: "source", Type: parquet.TypeString},
+	{Name: "name", Type: parquet.TypeString},
+	{Name: "url", Type: parquet.TypeString},
+	{Name: "recorded_at", Type: parquet.TypeTimestamp},
+	{Name: "price", Type: parquet.TypeDouble},
+	{Name: "availability", Type: parquet.TypeString},
+}
+
+func writeHistory(out io.Writer, format string, records []file.Record) error {
+	switch format {
+	case formatCSV:
+		rows := make([][]string, 0, len(records)+1)
+		rows = append(rows, file.CSVHeader)
+
+		for _, r := range records {
+			rows = append(rows, r.CSV())
+		}
+
+		return csv.NewWriter(out).WriteAll(rows)
+	case formatJSONLines:
+		return writeJSONLines(out, records)
+	case formatParquet:
+		rows := make([][]any, 0, len(records))
+		for _, r := range records {
+			rows = append(rows, []any{r.Source, r.Name, r.URL, r.RecordedAt, r.Price, string(r.Availability)})
+		}
+
+		return parquet.Write(out, historyColumns, rows)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+var catalogColumns = []parquet.Column{
+	{Name: "source", Type: parquet.TypeString},
+	{Name: "name", Type: parquet.TypeString},
+	{Name: "url", Type: parquet.TypeString},
+	{Name: "first_seen", Type: parquet.TypeTimestamp},
+	{Name: "last_seen", Type: parquet.TypeTimestamp},
+	{Name: "times_seen", Type: parquet.TypeInt64},
+	{Name: "first_price", Type: parquet.TypeDouble},
+	{Name: "last_price", Type: parquet.TypeDouble},
+	{Name: "availability", Type: parquet.TypeString},
+}
+
+func writeCatalog(out io.Writer, format string, entries []entry) error {
+	switch format {
+	case formatCSV:
+		rows := make([][]string, 0, len(entries)+1)
+		rows = append(rows, []string{"source", "name", "url", "first_seen", "last_seen", "times_seen", "first_price", "last_price", "availability"})
+
+		for _, e := range entries {
+			rows = append(rows, []string{
+				e.Source,
+				e.Name,
+				e.URL,
+				e.FirstSeen.Format(time.RFC3339),
+				e.LastSeen.Format(time.RFC3339),
+				strconv.Itoa(e.TimesSeen),
+				file.FormatPrice(e.FirstPrice),
+				file.FormatPrice(e.LastPrice),
+				string(e.Availability),
+			})
+		}
+
+		return csv.NewWriter(out).WriteAll(rows)
+	case formatJSONLines:
+		return writeJSONLines(out, entries)
+	case formatParquet:
+		rows := make([][]any, 0, len(entries))
+		for _, e := range entries {
+			rows = append(rows, []any{e.Source, e.Name, e.URL, e.FirstSeen, e.LastSeen, int64(e.TimesSeen), e.FirstPrice, e.LastPrice, string(e.Availability)})
+		}
+
+		return parquet.Write(out, catalogColumns, rows)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func writeJSONLines[T any](out io.Writer, items []T) error {
+	enc := json.NewEncoder(out)
+
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return fmt.Errorf("encoding: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const (
+	formatCSV       = "csv"
+	formatJSONLines = "jsonl"
+	formatParquet   = "parquet"
+	modeCatalog     = "catalog"
+	modeHistory     = "history"
+)
+
+var errInvalidFormat = errors.New("format must be one of csv, jsonl, parquet")
+
+type flags struct {
+	RecordFile string
+	Inputs     []string
+	Format     string
+	Mode       string
+	Output     string
+	Sources    []string
+	Since      string
+	Until      string
+	Watch      []string
+	Watchlist  string
+}
+
+func (f *flags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.RecordFile, "record-file", f.RecordFile, "Path of the record file whose archives are exported")
+	flags.StringSliceVar(&f.Inputs, "input", f.Inputs, "Explicit archive files to export instead of --record-file")
+	flags.StringVar(&f.Format, "format", f.Format, "Output format (csv, jsonl, parquet)")
+	flags.StringVar(&f.Mode, "mode", f.Mode, "Export one row per product (catalog) or per observation (history)")
+	flags.StringVarP(&f.Output, "output", "o", f.Output, "Path to write the export to or '-' for stdout")
+	flags.StringSliceVar(&f.Sources, "source", f.Sources, "Only export products from these sources")
+	flags.StringVar(&f.Since, "since", f.Since, "Only export observations at or after this RFC3339 time")
+	flags.StringVar(&f.Until, "until", f.Until, "Only export observations before this RFC3339 time")
+	flags.StringSliceVar(&f.Watch, "watch", f.Watch, "Only export products whose name or URL matches one of these patterns")
+	flags.StringVar(&f.Watchlist, "watchlist", f.Watchlist, "Path to a watchlist file of patterns, one per line, added to --watch")
+}
+
+func (f *flags) filter() (filter, error) {
+	if !slices.Contains([]string{formatCSV, formatJSONLines, formatParquet}, f.Format) {
+		return filter{}, errInvalidFormat
+	}
+
+	res := filter{
+		sources: f.Sources,
+	}
+
+	if f.Since != "" {
+		since, err := time.Parse(time.RFC3339, f.Since)
+		if err != nil {
+			return filter{}, fmt.Errorf("parsing since: %w", err)
+		}
+
+		res.since = since
+	}
+
+	if f.Until != "" {
+		until, err := time.Parse(time.RFC3339, f.Until)
+		if err != nil {
+			return filter{}, fmt.Errorf("parsing until: %w", err)
+		}
+
+		res.until = until
+	}
+
+	patterns := f.Watch
+	if f.Watchlist != "" {
+		watchlist, err := readWatchlist(f.Watchlist)
+		if err != nil {
+			return filter{}, err
+		}
+
+		patterns = append(slices.Clone(patterns), watchlist...)
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return filter{}, fmt.Errorf("compiling watch pattern %q: %w", pattern, err)
+		}
+
+		res.watch = append(res.watch, re)
+	}
+
+	return res, nil
+}
+
+// readWatchlist reads one pattern per line ignoring blank lines and lines
+// starting with #.
+func readWatchlist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading watchlist: %w", err)
+	}
+
+	var patterns []string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+
+	return patterns, nil
+}
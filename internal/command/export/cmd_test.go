@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/recorder/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	recordFile := filepath.Join(dir, "products.jsonl")
+
+	day := func(d int) time.Time {
+		return time.Date(2024, time.January, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	m800 := file.Record{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800"}
+	sailor := file.Record{Source: "fph", Name: "sailor-1911", URL: "https://fountainpenhospital.com/products/sailor-1911"}
+
+	writeRecords(t, file.RotatedPath(recordFile, day(1)), at(m800, day(1)), at(sailor, day(1)))
+	writeRecords(t, recordFile, at(m800, day(2)))
+
+	t.Run("catalog", func(t *testing.T) {
+		out := execute(t, "--record-file", recordFile, "--format", "jsonl")
+
+		var entries []entry
+
+		dec := json.NewDecoder(strings.NewReader(out))
+		for dec.More() {
+			var e entry
+			require.NoError(t, dec.Decode(&e))
+
+			entries = append(entries, e)
+		}
+
+		assert.Equal(t, []entry{
+			{Source: m800.Source, Name: m800.Name, URL: m800.URL, FirstSeen: day(1), LastSeen: day(2), TimesSeen: 2},
+			{Source: sailor.Source, Name: sailor.Name, URL: sailor.URL, FirstSeen: day(1), LastSeen: day(1), TimesSeen: 1},
+		}, entries)
+	})
+
+	t.Run("history filtered", func(t *testing.T) {
+		out := execute(t, "--record-file", recordFile, "--mode", "history", "--source", "truphae", "--since", day(2).Format(time.RFC3339))
+
+		assert.Equal(t, strings.Join([]string{
+			"source,name,url,recorded_at,price,availability",
+			"truphae,pelikan-m800,https://truphaeinc.com/products/pelikan-m800," + day(2).Format(time.RFC3339) + ",,",
+			"",
+		}, "\n"), out)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		out := execute(t, "--record-file", recordFile, "--mode", "history", "--watch", "SAILOR")
+
+		assert.Equal(t, 2, strings.Count(out, "\n"))
+		assert.Contains(t, out, sailor.URL)
+	})
+
+	t.Run("watchlist", func(t *testing.T) {
+		watchlist := filepath.Join(dir, "watchlist.txt")
+		require.NoError(t, os.WriteFile(watchlist, []byte("# pens to watch\n\n  sailor  \n"), 0o644))
+
+		out := execute(t, "--record-file", recordFile, "--mode", "history", "--watchlist", watchlist, "--watch", "m800")
+
+		assert.Equal(t, 4, strings.Count(out, "\n"))
+		assert.Contains(t, out, sailor.URL)
+		assert.Contains(t, out, m800.URL)
+	})
+
+	t.Run("prices", func(t *testing.T) {
+		priced := filepath.Join(dir, "priced.jsonl")
+
+		m800 := m800
+		m800.Price, m800.Availability = 450, recorder.AvailabilityInStock
+		later := m800
+		later.Price, later.Availability = 425.5, recorder.AvailabilitySoldOut
+
+		writeRecords(t, priced, at(later, day(4)), at(m800, day(3)))
+
+		out := execute(t, "--input", priced, "--mode", "history")
+		assert.Contains(t, out, m800.URL+","+day(3).Format(time.RFC3339)+",450,in_stock\n")
+		assert.Contains(t, out, m800.URL+","+day(4).Format(time.RFC3339)+",425.5,sold_out\n")
+
+		out = execute(t, "--input", priced)
+		assert.Contains(t, out, ",2,450,425.5,sold_out\n")
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		for _, mode := range []string{"catalog", "history"} {
+			out := execute(t, "--record-file", recordFile, "--mode", mode, "--format", "parquet")
+
+			assert.True(t, strings.HasPrefix(out, "PAR1"), mode)
+			assert.True(t, strings.HasSuffix(out, "PAR1"), mode)
+		}
+	})
+
+	t.Run("output file", func(t *testing.T) {
+		output := filepath.Join(dir, "export.csv")
+
+		assert.Empty(t, execute(t, "--record-file", recordFile, "--output", output))
+
+		data, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "source,name,url,first_seen,last_seen,times_seen,first_price,last_price,availability\n"))
+		assert.Equal(t, 3, bytes.Count(data, []byte("\n")))
+	})
+
+	t.Run("records from before canonical URLs", func(t *testing.T) {
+		legacy := filepath.Join(dir, "legacy.jsonl")
+		writeRecords(t, legacy, at(file.Record{
+			Source: m800.Source,
+			Name:   "Pelikan-M800",
+			URL:    "https://truphaeinc.com/collections/pre-owned-pens/products/Pelikan-M800/",
+		}, day(0)))
+
+		out := execute(t, "--input", legacy, "--input", recordFile, "--format", "jsonl")
+
+		var e entry
+		require.NoError(t, json.NewDecoder(strings.NewReader(out)).Decode(&e))
+		assert.Equal(t, entry{Source: m800.Source, Name: m800.Name, URL: m800.URL, FirstSeen: day(0), LastSeen: day(2), TimesSeen: 2}, e)
+		assert.Equal(t, 1, strings.Count(out, "\n"), "legacy and current records are one product")
+	})
+
+	for name, args := range map[string][]string{
+		"no archives":    {"--record-file", filepath.Join(dir, "missing.jsonl")},
+		"unknown format": {"--record-file", recordFile, "--format", "xml"},
+		"unknown mode":   {"--record-file", recordFile, "--mode", "summary"},
+		"bad since":      {"--record-file", recordFile, "--since", "yesterday"},
+		"bad watchlist":  {"--record-file", recordFile, "--watchlist", filepath.Join(dir, "missing.txt")},
+		"missing output": {"--record-file", recordFile, "--output", filepath.Join(dir, "missing", "export.csv")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := NewCommand()
+			cmd.SetArgs(args)
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+
+			assert.Error(t, cmd.Execute())
+		})
+	}
+}
+
+func execute(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	cmd := NewCommand()
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+
+	require.NoError(t, cmd.Execute())
+
+	return out.String()
+}
+
+func at(r file.Record, ts time.Time) file.Record {
+	r.RecordedAt = ts
+
+	return r
+}
+
+func writeRecords(t *testing.T, path string, records ...file.Record) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		require.NoError(t, enc.Encode(r))
+	}
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
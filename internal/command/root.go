@@ -5,7 +5,13 @@
 package command
 
 import (
+	"github.com/ajpantuso/pen-finder/internal/command/certs"
+	"github.com/ajpantuso/pen-finder/internal/command/config"
+	"github.com/ajpantuso/pen-finder/internal/command/export"
+	"github.com/ajpantuso/pen-finder/internal/command/run"
+	"github.com/ajpantuso/pen-finder/internal/command/runs"
 	"github.com/ajpantuso/pen-finder/internal/command/start"
+	"github.com/ajpantuso/pen-finder/internal/command/tokens"
 	"github.com/spf13/cobra"
 )
 
@@ -13,7 +19,13 @@ func NewRootCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "pen-finder [command]",
 	}
+	cmd.AddCommand(certs.NewCommand())
+	cmd.AddCommand(config.NewCommand())
+	cmd.AddCommand(export.NewCommand())
+	cmd.AddCommand(run.NewCommand())
+	cmd.AddCommand(runs.NewCommand())
 	cmd.AddCommand(start.NewCommand())
+	cmd.AddCommand(tokens.NewCommand())
 
 	return cmd
 }
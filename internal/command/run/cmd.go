@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/config"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+func NewCommand() *cobra.Command {
+	flags := flags{
+		Output:  outputTable,
+		Timeout: 10 * time.Minute,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Runs scrapers once and prints the recorded products",
+		RunE:  run(&flags),
+	}
+	flags.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func run(flags *flags) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		if !slices.Contains([]string{outputTable, outputJSON, outputYAML}, flags.Output) {
+			return fmt.Errorf("unknown output format %q", flags.Output)
+		}
+
+		cfg, err := config.Load(flags.ConfigFile)
+		if err != nil {
+			return fmt.Errorf("loading configuration: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+
+		names := make([]api.Scraper, 0, len(flags.Scrapers))
+		for _, name := range flags.Scrapers {
+			s := api.Scraper(name)
+			if !cfg.IsScraper(s) {
+				return fmt.Errorf("unknown scraper %q: must be one of %s", name, joinNames(cfg.ScraperNames()))
+			}
+
+			names = append(names, s)
+		}
+
+		opts, err := cfg.ScraperOptions()
+		if err != nil {
+			return err
+		}
+
+		for name, extra := range flags.scraperOptions {
+			opts[name] = append(opts[name], extra...)
+		}
+
+		feedOpts, err := cfg.FeedScraperOptions()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		if flags.Timeout > 0 {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+			defer cancel()
+		}
+
+		rec := recorder.NewMemoryRecorder()
+
+		runErr := scraper.NewParallelRunner().Run(ctx,
+			scraper.WithScrapers(newScrapers(opts, feedOpts, names)),
+			scraper.WithScrapeOptions{scraper.WithRecorder{Recorder: rec}},
+		)
+
+		if err := writeProducts(cmd.OutOrStdout(), flags.Output, rec.Products()); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+
+		if runErr != nil {
+			return fmt.Errorf("running scrapers: %w", runErr)
+		}
+
+		return nil
+	}
+}
+
+// newScrapers returns the named builtin scrapers and feeds or all of them if
+// no names are given.
+func newScrapers(opts map[api.Scraper][]scraper.SimpleScraperOption, feeds map[api.Scraper][]scraper.FeedScraperOption, names []api.Scraper) []scraper.Scraper {
+	if len(names) < 1 {
+		names = scraper.BuiltinNames()
+		for name := range feeds {
+			names = append(names, name)
+		}
+	}
+
+	names = slices.Clone(names)
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var (
+		builtins []api.Scraper
+		result   []scraper.Scraper
+	)
+
+	for _, name := range names {
+		if feedOpts, ok := feeds[name]; ok {
+			result = append(result, scraper.NewFeedScraper(feedOpts...))
+		} else {
+			builtins = append(builtins, name)
+		}
+	}
+
+	if len(builtins) > 0 {
+		result = append(result, scraper.NewBuiltinScrapers(opts, builtins...)...)
+	}
+
+	return result
+}
+
+type product struct {
+	Source       string                `json:"source" yaml:"source"`
+	Name         string                `json:"name" yaml:"name"`
+	URL          string                `json:"url" yaml:"url"`
+	Price        float64               `json:"price,omitempty" yaml:"price,omitempty"`
+	Availability recorder.Availability `json:"availability,omitempty" yaml:"availability,omitempty"`
+}
+
+func writeProducts(out io.Writer, format string, recorded []recorder.Product) error {
+	products := make([]product, 0, len(recorded))
+	for _, p := range recorded {
+		products = append(products, product(p))
+	}
+
+	slices.SortFunc(products, func(a, b product) int {
+		if c := strings.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(products)
+	case outputYAML:
+		enc := yaml.NewEncoder(out)
+		defer enc.Close()
+
+		return enc.Encode(products)
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+		fmt.Fprintln(w, "SOURCE\tNAME\tURL")
+		for _, p := range products {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.Source, p.Name, p.URL)
+		}
+
+		return w.Flush()
+	}
+}
+
+func joinNames(names []api.Scraper) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", name))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+type flags struct {
+	ConfigFile string
+	Scrapers   []string
+	Output     string
+	Timeout    time.Duration
+	// scraperOptions override the builtin scraper defaults
+	scraperOptions map[api.Scraper][]scraper.SimpleScraperOption
+}
+
+func (f *flags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.ConfigFile, "config", f.ConfigFile, "Path to YAML configuration file providing crawl settings")
+	flags.StringSliceVar(&f.Scrapers, "scraper", f.Scrapers, "Builtin scrapers or configured feeds to run (defaults to all)")
+	flags.StringVarP(&f.Output, "output", "o", f.Output, "Output format (table, json, yaml)")
+	flags.DurationVar(&f.Timeout, "timeout", f.Timeout, "Maximum duration of the run")
+}
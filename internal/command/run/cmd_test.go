@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRun(t *testing.T) {
+	shop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shop/" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, `<html><body>
+			<a href="/shop/products/sailor-1911">Sailor 1911</a>
+			<a href="/shop/products/pelikan-m800">Pelikan M800</a>
+		</body></html>`)
+	}))
+	defer shop.Close()
+
+	expected := []product{
+		{Source: "truphae", Name: "pelikan-m800", URL: shop.URL + "/shop/products/pelikan-m800"},
+		{Source: "truphae", Name: "sailor-1911", URL: shop.URL + "/shop/products/sailor-1911"},
+	}
+
+	t.Run("table", func(t *testing.T) {
+		out, err := execute(t, shopOptions(shop.URL), "--scraper", string(api.ScraperTruphae))
+		require.NoError(t, err)
+
+		assert.Regexp(t, regexp.MustCompile(`^SOURCE\s+NAME\s+URL\n`+
+			`truphae\s+pelikan-m800\s+`+regexp.QuoteMeta(expected[0].URL)+`\n`+
+			`truphae\s+sailor-1911\s+`+regexp.QuoteMeta(expected[1].URL)+`\n$`), out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := execute(t, shopOptions(shop.URL), "--scraper", string(api.ScraperTruphae), "-o", "json")
+		require.NoError(t, err)
+
+		var products []product
+		require.NoError(t, json.Unmarshal([]byte(out), &products))
+		assert.Equal(t, expected, products)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		out, err := execute(t, shopOptions(shop.URL), "--scraper", string(api.ScraperTruphae), "-o", "yaml")
+		require.NoError(t, err)
+
+		var products []product
+		require.NoError(t, yaml.Unmarshal([]byte(out), &products))
+		assert.Equal(t, expected, products)
+	})
+
+	t.Run("unknown output format", func(t *testing.T) {
+		_, err := execute(t, shopOptions(shop.URL), "--scraper", string(api.ScraperTruphae), "-o", "xml")
+		assert.ErrorContains(t, err, `unknown output format "xml"`)
+	})
+
+	t.Run("unknown scraper", func(t *testing.T) {
+		_, err := execute(t, shopOptions(shop.URL), "--scraper", "ebay")
+		assert.ErrorContains(t, err, `unknown scraper "ebay"`)
+	})
+
+	t.Run("failed scraper", func(t *testing.T) {
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer broken.Close()
+
+		opts := shopOptions(shop.URL)
+		for name, o := range shopOptions(broken.URL) {
+			if name == api.ScraperFPH {
+				opts[name] = o
+			}
+		}
+
+		out, err := execute(t, opts, "--scraper", string(api.ScraperTruphae), "--scraper", string(api.ScraperFPH), "-o", "json")
+		assert.ErrorContains(t, err, "running scrapers")
+
+		var products []product
+		require.NoError(t, json.Unmarshal([]byte(out), &products))
+		assert.Equal(t, expected, products, "products of successful scrapers are still written")
+	})
+
+	t.Run("crawl settings from config", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		_, err := execute(t, shopOptions(shop.URL),
+			"--scraper", string(api.ScraperTruphae),
+			"--config", writeConfig(t, "crawl:\n  delay: 0s\n  randomDelay: 0s\n  cache:\n    enabled: true\n    dir: "+cacheDir+"\n"),
+		)
+		require.NoError(t, err)
+
+		cached, err := os.ReadDir(filepath.Join(cacheDir, string(api.ScraperTruphae)))
+		require.NoError(t, err)
+		assert.NotEmpty(t, cached, "the configured HTTP cache is used")
+	})
+
+	t.Run("feeds from config", func(t *testing.T) {
+		feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><item><guid>1001</guid><title>WTS: Pelikan M800</title><link>https://forum.example/topic/1001</link></item></channel></rss>`)
+		}))
+		defer feed.Close()
+
+		out, err := execute(t, shopOptions(shop.URL),
+			"--scraper", "classifieds",
+			"--config", writeConfig(t, "feeds:\n  - name: classifieds\n    urls: ["+feed.URL+"]\n    stateFile: "+filepath.Join(t.TempDir(), "feed.json")+"\n"),
+			"-o", "json",
+		)
+		require.NoError(t, err)
+
+		var products []product
+		require.NoError(t, json.Unmarshal([]byte(out), &products))
+		assert.Equal(t, []product{{Source: "classifieds", Name: "WTS: Pelikan M800", URL: "https://forum.example/topic/1001"}}, products)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := execute(t, shopOptions(shop.URL), "--config", writeConfig(t, "crawl:\n  parallelism: 0\n"))
+		assert.ErrorContains(t, err, "invalid configuration")
+	})
+}
+
+// shopOptions points every builtin scraper at the shop served from baseURL.
+func shopOptions(baseURL string) map[api.Scraper][]scraper.SimpleScraperOption {
+	opts := make(map[api.Scraper][]scraper.SimpleScraperOption)
+
+	for _, name := range scraper.BuiltinNames() {
+		opts[name] = []scraper.SimpleScraperOption{
+			scraper.WithBaseURL(baseURL + "/shop/"),
+			scraper.WithFilters{regexp.MustCompile(regexp.QuoteMeta(baseURL) + `/shop/.*`)},
+			scraper.WithProcessor{Processor: scraper.NewSimpleProcessor(
+				scraper.WithBaseURL(baseURL),
+				scraper.WithProductPathPrefix("/shop/products/"),
+			)},
+			scraper.WithPagination{Pagination: scraper.NextLinkPagination{}},
+			scraper.WithIgnoreRobotsTxt(true),
+			scraper.WithRetryPolicy(scraper.RetryPolicy{MaxAttempts: 1}),
+		}
+	}
+
+	return opts
+}
+
+func execute(t *testing.T, opts map[api.Scraper][]scraper.SimpleScraperOption, args ...string) (string, error) {
+	t.Helper()
+
+	// keep runs fast unless a test supplies its own crawl settings
+	f := flags{
+		ConfigFile:     writeConfig(t, "crawl:\n  delay: 0s\n  randomDelay: 0s\n"),
+		Output:         outputTable,
+		scraperOptions: opts,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "run",
+		RunE:          run(&f),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	f.AddFlags(cmd.Flags())
+
+	var out bytes.Buffer
+
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+
+	err := cmd.Execute()
+
+	return out.String(), err
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	return path
+}
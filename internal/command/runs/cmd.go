@@ -0,0 +1,352 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package runs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/client"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCommand() *cobra.Command {
+	flags := flags{
+		Token:        os.Getenv("PEN_FINDER_TOKEN"),
+		Server:       "https://localhost:8080",
+		Output:       outputTable,
+		PollInterval: time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Manages runs on a remote server",
+	}
+	flags.AddFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(
+		newCreateCommand(&flags),
+		newGetCommand(&flags),
+		newListCommand(&flags),
+		newCancelCommand(&flags),
+		newWaitCommand(&flags),
+	)
+
+	return cmd
+}
+
+func newCreateCommand(flags *flags) *cobra.Command {
+	var (
+		scrapers       []string
+		wait           bool
+		follow         bool
+		idempotencyKey string
+		callbackURL    string
+		callbackSecret string
+		options        api.RunOptions
+		timeout        time.Duration
+		labels         map[string]string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Creates a run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.client()
+			if err != nil {
+				return err
+			}
+
+			options.Timeout = api.Duration(timeout)
+			options.Labels = labels
+
+			req := api.PostRunRequest{
+				Scrapers:       make([]api.Scraper, 0, len(scrapers)),
+				CallbackURL:    callbackURL,
+				CallbackSecret: callbackSecret,
+				RunOptions:     options,
+			}
+			for _, s := range scrapers {
+				req.Scrapers = append(req.Scrapers, api.Scraper(s))
+			}
+
+			var res api.PostRunResponse
+			if idempotencyKey != "" {
+				res, err = c.CreateRunWithIdempotencyKey(cmd.Context(), idempotencyKey, req)
+			} else {
+				res, err = c.CreateRun(cmd.Context(), req)
+			}
+			if err != nil {
+				return fmt.Errorf("creating run: %w", err)
+			}
+
+			if !wait {
+				return flags.write(cmd.OutOrStdout(), res, func(w io.Writer) error {
+					_, err := fmt.Fprintln(w, res.RunID)
+
+					return err
+				})
+			}
+
+			return waitRun(cmd, flags, c, res.RunID, follow)
+		},
+	}
+	cmd.Flags().StringSliceVar(&scrapers, "scraper", scrapers, "Scrapers to run (defaults to all)")
+	cmd.Flags().BoolVar(&wait, "wait", wait, "Wait for the run to finish")
+	cmd.Flags().BoolVar(&follow, "follow", follow, "Stream progress events while waiting")
+	cmd.Flags().DurationVar(&timeout, "timeout", timeout, "Maximum duration of the run (capped by the server)")
+	cmd.Flags().IntVar(&options.MaxPages, "max-pages", options.MaxPages, "Maximum number of pages each scraper fetches")
+	cmd.Flags().IntVar(&options.MaxDepth, "max-depth", options.MaxDepth, "Maximum link depth each scraper follows")
+	cmd.Flags().BoolVar(&options.DryRun, "dry-run", options.DryRun, "Scrape without recording products")
+	cmd.Flags().StringToStringVarP(&labels, "label", "l", labels, "Labels attached to the run (key=value)")
+	cmd.Flags().StringVar(&callbackURL, "callback-url", callbackURL, "URL the run summary is POSTed to once the run finishes")
+	cmd.Flags().StringVar(&callbackSecret, "callback-secret", callbackSecret, "Secret used to sign the callback with HMAC-SHA256")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", idempotencyKey, "Key which prevents a retried request from creating a duplicate run")
+
+	return cmd
+}
+
+func newGetCommand(flags *flags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get RUN_ID",
+		Short: "Shows a run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("parsing run ID: %w", err)
+			}
+
+			c, err := flags.client()
+			if err != nil {
+				return err
+			}
+
+			run, err := c.GetRun(cmd.Context(), id)
+			if err != nil {
+				return fmt.Errorf("getting run: %w", err)
+			}
+
+			return flags.write(cmd.OutOrStdout(), run, func(w io.Writer) error {
+				return writeRunTable(w, run)
+			})
+		},
+	}
+}
+
+func newListCommand(flags *flags) *cobra.Command {
+	var labels []string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.client()
+			if err != nil {
+				return err
+			}
+
+			res, err := c.ListRuns(cmd.Context(), labels...)
+			if err != nil {
+				return fmt.Errorf("listing runs: %w", err)
+			}
+
+			return flags.write(cmd.OutOrStdout(), res, func(w io.Writer) error {
+				return writeRunTable(w, res.Runs...)
+			})
+		},
+	}
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", labels, "Only list runs with the given label (key=value)")
+
+	return cmd
+}
+
+func newCancelCommand(flags *flags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel RUN_ID",
+		Short: "Cancels an in progress run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("parsing run ID: %w", err)
+			}
+
+			c, err := flags.client()
+			if err != nil {
+				return err
+			}
+
+			if err := c.CancelRun(cmd.Context(), id); err != nil {
+				return fmt.Errorf("cancelling run: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newWaitCommand(flags *flags) *cobra.Command {
+	var follow bool
+
+	cmd := &cobra.Command{
+		Use:   "wait RUN_ID",
+		Short: "Waits for a run to finish",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("parsing run ID: %w", err)
+			}
+
+			c, err := flags.client()
+			if err != nil {
+				return err
+			}
+
+			return waitRun(cmd, flags, c, id, follow)
+		},
+	}
+	cmd.Flags().BoolVar(&follow, "follow", follow, "Stream progress events while waiting")
+
+	return cmd
+}
+
+func waitRun(cmd *cobra.Command, flags *flags, c *client.Client, id uuid.UUID, follow bool) error {
+	if follow {
+		if err := c.StreamRunEvents(cmd.Context(), id, func(event api.RunEvent) error {
+			return flags.write(cmd.ErrOrStderr(), event, func(w io.Writer) error {
+				return writeRunEvent(w, event)
+			})
+		}); err != nil {
+			return fmt.Errorf("following run: %w", err)
+		}
+	}
+
+	run, err := c.WaitRun(cmd.Context(), id)
+	if err != nil {
+		return fmt.Errorf("waiting for run: %w", err)
+	}
+
+	if err := flags.write(cmd.OutOrStdout(), run, func(w io.Writer) error {
+		return writeRunTable(w, run)
+	}); err != nil {
+		return err
+	}
+
+	if run.Status != api.RunStatusSuccess {
+		return fmt.Errorf("run %s finished with status %q", run.ID, run.Status)
+	}
+
+	return nil
+}
+
+func writeRunEvent(w io.Writer, event api.RunEvent) error {
+	detail := event.URL
+	switch event.Type {
+	case api.RunEventProductRecorded:
+		detail = event.Product + " " + event.URL
+	case api.RunEventRequestRetried, api.RunEventScraperError, api.RunEventScraperFinished, api.RunEventScraperSkipped:
+		detail = event.Error
+	case api.RunEventRunFinished:
+		detail = string(event.Status)
+	}
+
+	_, err := fmt.Fprintf(w, "%s  %-16s  %-20s  %s\n",
+		event.Time.Local().Format(time.TimeOnly), event.Type, event.Source, strings.TrimSpace(detail))
+
+	return err
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, val := range labels {
+		pairs = append(pairs, key+"="+val)
+	}
+
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func writeRunTable(out io.Writer, runs ...api.GetRunResponse) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tSTATUS\tLAST UPDATED\tLABELS")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", run.ID, run.Status, run.LastUpdated.Local().Format(time.DateTime), formatLabels(run.Labels))
+	}
+
+	return w.Flush()
+}
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+type flags struct {
+	Server             string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	Output             string
+	PollInterval       time.Duration
+	Token              string
+}
+
+func (f *flags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.Server, "server", f.Server, "URL of the pen-finder server")
+	flags.StringVar(&f.CAFile, "ca-file", f.CAFile, "Path to CA bundle used to verify the server")
+	flags.StringVar(&f.CertFile, "client-cert-file", f.CertFile, "Path to client TLS certificate")
+	flags.StringVar(&f.KeyFile, "client-key-file", f.KeyFile, "Path to client TLS private key")
+	flags.BoolVar(&f.InsecureSkipVerify, "insecure-skip-verify", f.InsecureSkipVerify, "Skip verification of the server certificate")
+	flags.StringVarP(&f.Output, "output", "o", f.Output, "Output format (table, json)")
+	flags.StringVar(&f.Token, "token", "", "API token used to authenticate (defaults to $PEN_FINDER_TOKEN)")
+	flags.DurationVar(&f.PollInterval, "poll-interval", f.PollInterval, "Interval between status checks while waiting")
+}
+
+func (f *flags) client() (*client.Client, error) {
+	if !slices.Contains([]string{outputTable, outputJSON}, f.Output) {
+		return nil, fmt.Errorf("unknown output format %q", f.Output)
+	}
+
+	c, err := client.NewClient(
+		client.WithServerURL(f.Server),
+		client.WithCAFile(f.CAFile),
+		client.WithClientCertificate{CertFile: f.CertFile, KeyFile: f.KeyFile},
+		client.WithInsecureSkipVerify(f.InsecureSkipVerify),
+		client.WithPollInterval(f.PollInterval),
+		client.WithToken(f.Token),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	return c, nil
+}
+
+func (f *flags) write(out io.Writer, v any, table func(io.Writer) error) error {
+	if f.Output == outputJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	}
+
+	return table(out)
+}
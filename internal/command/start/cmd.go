@@ -6,12 +6,21 @@ package start
 
 import (
 	"fmt"
-	"log"
+	"sync"
 	"time"
 
+	"github.com/ajpantuso/pen-finder/internal/auth"
+	"github.com/ajpantuso/pen-finder/internal/certs"
+	"github.com/ajpantuso/pen-finder/internal/config"
+	"github.com/ajpantuso/pen-finder/internal/httpcache"
 	"github.com/ajpantuso/pen-finder/internal/metrics"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/recorder/file"
 	"github.com/ajpantuso/pen-finder/internal/recorder/prometheus"
+	"github.com/ajpantuso/pen-finder/internal/scheduler"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
 	"github.com/ajpantuso/pen-finder/internal/server"
+	"github.com/ajpantuso/pen-finder/internal/webhook"
 	"github.com/go-logr/zapr"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
@@ -21,58 +30,183 @@ import (
 )
 
 func NewCommand() *cobra.Command {
+	defaults := config.Default()
 	flags := flags{
-		BindAddr:        ":8080",
-		MetricsBindAddr: ":8083",
-		CertFile:        "server.crt",
-		KeyFile:         "server.key",
+		BindAddr:          defaults.Server.BindAddr,
+		MetricsBindAddr:   defaults.Metrics.BindAddr,
+		CertFile:          defaults.Server.CertFile,
+		KeyFile:           defaults.Server.KeyFile,
+		RunTimeout:        defaults.Server.RunTimeout,
+		MaxRunTimeout:     defaults.Server.MaxRunTimeout,
+		MaxConcurrentRuns: defaults.Server.MaxConcurrentRuns,
+		MaxQueuedRuns:     defaults.Server.MaxQueuedRuns,
+		IdempotencyWindow: defaults.Server.IdempotencyWindow,
+		CircuitThreshold:  defaults.Server.CircuitBreaker.FailureThreshold,
+		CircuitCooldown:   defaults.Server.CircuitBreaker.Cooldown,
+		LogLevel:          defaults.Log.Level,
+		RecordFormat:      defaults.Recorders.File.Format,
 	}
 
 	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Starts server",
-		RunE:  run(flags),
+		RunE:  run(&flags),
 	}
 	flags.AddFlags(cmd.Flags())
 
 	return cmd
 }
 
-func run(flags flags) func(*cobra.Command, []string) error {
+func run(flags *flags) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, _ []string) error {
 		ctx := cmd.Context()
-		errCh := make(chan error, 2)
 
-		registry := prom.NewRegistry()
-		recorder, err := prometheus.NewRecorder(prometheus.WithRegisterer{Registerer: registry})
+		cfg, err := flags.Config(cmd.Flags())
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		zlog, err := zap.NewDevelopment()
+		zlog, err := newZapLogger(cfg.Log)
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("creating logger: %w", err)
 		}
 
 		logger := zapr.NewLogger(zlog)
+
+		certFile, keyFile := cfg.Server.CertFile, cfg.Server.KeyFile
+
+		if cfg.Server.DevTLS.Enabled {
+			paths, err := ensureDevTLS(cfg.Server.DevTLS)
+			if err != nil {
+				return fmt.Errorf("preparing development certificates: %w", err)
+			}
+
+			logger.Info("using development certificates", "caFile", paths.CAFile)
+
+			certFile, keyFile = paths.CertFile, paths.KeyFile
+		}
+
+		registry := prom.NewRegistry()
+		promRecorder, err := prometheus.NewRecorder(prometheus.WithRegisterer{Registerer: registry})
+		if err != nil {
+			return fmt.Errorf("creating prometheus recorder: %w", err)
+		}
+
+		breakers := scraper.NewCircuitBreakers(
+			scraper.WithFailureThreshold(cfg.Server.CircuitBreaker.FailureThreshold),
+			scraper.WithCooldown(cfg.Server.CircuitBreaker.Cooldown),
+		)
+		if err := registry.Register(metrics.NewCircuitCollector(breakers)); err != nil {
+			return fmt.Errorf("registering circuit breaker metrics: %w", err)
+		}
+
+		cacheMetrics, err := httpcache.NewMetrics(registry)
+		if err != nil {
+			return fmt.Errorf("registering HTTP cache metrics: %w", err)
+		}
+
+		scraperOpts, err := cfg.ScraperOptions(httpcache.WithMetrics{Metrics: cacheMetrics}, httpcache.WithLogger{Logger: logger})
+		if err != nil {
+			return err
+		}
+
+		feedOpts, err := cfg.FeedScraperOptions()
+		if err != nil {
+			return err
+		}
+
+		recorders := []recorder.Recorder{promRecorder}
+
+		if rec := cfg.Recorders.File; rec.Path != "" {
+			fileRecorder, err := file.NewRecorder(
+				file.WithPath(rec.Path),
+				file.WithFormat(rec.Format),
+				file.WithMaxSize(rec.MaxSize),
+				file.WithRotatePerRun(rec.RotatePerRun),
+				file.WithGzip(rec.Gzip),
+			)
+			if err != nil {
+				return fmt.Errorf("creating file recorder: %w", err)
+			}
+			defer fileRecorder.Close()
+
+			recorders = append(recorders, fileRecorder)
+		}
+
+		rl := &reloader{
+			load: func() (config.Config, error) {
+				return flags.Config(cmd.Flags())
+			},
+			current:      cfg,
+			cacheMetrics: cacheMetrics,
+			logger:       logger,
+			lock:         &sync.Mutex{},
+		}
+
+		var authenticator server.Authenticator
+		if cfg.Server.Auth.TokensFile != "" {
+			authenticator = auth.NewFileTokenStore(cfg.Server.Auth.TokensFile)
+		}
+
 		srv := server.NewDefaultServer(
-			server.WithBindAddr(flags.BindAddr),
-			server.WithKeyFile(flags.KeyFile),
-			server.WithCertFile(flags.CertFile),
+			server.WithBindAddr(cfg.Server.BindAddr),
+			server.WithKeyFile(keyFile),
+			server.WithCertFile(certFile),
+			server.WithClientCAFile(cfg.Server.ClientCAFile),
+			server.WithInsecureHTTP(cfg.Server.InsecureHTTP),
 			server.WithLogger{Logger: logger},
-			server.WithRunTimeout(10*time.Second),
-			server.WithRecorder{Recorder: recorder},
+			server.WithRunTimeout(cfg.Server.RunTimeout),
+			server.WithMaxRunTimeout(cfg.Server.MaxRunTimeout),
+			server.WithMaxConcurrentRuns(cfg.Server.MaxConcurrentRuns),
+			server.WithMaxQueuedRuns(maxQueuedRuns(cfg.Server.MaxQueuedRuns)),
+			server.WithIdempotencyWindow(cfg.Server.IdempotencyWindow),
+			server.WithCircuitBreakers{Breakers: breakers},
+			server.WithRecorder{Recorder: recorder.NewMultiRecorder(recorders...)},
+			server.WithScrapers(cfg.EnabledScrapers()),
+			server.WithScraperOptions(scraperOpts),
+			server.WithFeedScraperOptions(feedOpts),
+			server.WithReloader{Reloader: rl},
+			server.WithAuthenticator{Authenticator: authenticator},
+			server.WithNotifiers(notifiers(cfg.Notifiers)),
+			server.WithWebhookSender{Sender: webhook.NewSender(
+				webhook.WithLogger{Logger: logger},
+				webhook.WithAllowPrivateNetworks(cfg.Server.AllowPrivateCallbacks),
+			)},
 		)
 
-		go func() {
-			errCh <- srv.Serve(ctx)
-		}()
+		sched := scheduler.NewScheduler(
+			scheduler.WithSchedules(schedules(cfg.Schedules)),
+			scheduler.WithStarter{Starter: srv},
+			scheduler.WithLogger{Logger: logger},
+		)
+
+		rl.srv, rl.sched = srv, sched
+
+		go rl.watchSignals(ctx)
 
-		metricsSrv := metrics.NewServer(metrics.WithBindAddr(flags.MetricsBindAddr), metrics.WithGatherer{Gatherer: registry})
+		workers := []func() error{
+			func() error {
+				return srv.Serve(ctx)
+			},
+			func() error {
+				metricsSrv := metrics.NewServer(metrics.WithBindAddr(cfg.Metrics.BindAddr), metrics.WithGatherer{Gatherer: registry})
 
-		go func() {
-			errCh <- metricsSrv.Serve(ctx)
-		}()
+				return metricsSrv.Serve(ctx)
+			},
+			func() error {
+				return sched.Run(ctx)
+			},
+		}
+
+		errCh := make(chan error, len(workers))
+
+		for _, worker := range workers {
+			worker := worker
+
+			go func() {
+				errCh <- worker()
+			}()
+		}
 
 		for {
 			select {
@@ -81,8 +215,13 @@ func run(flags flags) func(*cobra.Command, []string) error {
 			case <-ctx.Done():
 				logger.Info("received shutdown signal")
 
-				if err := multierr.Combine(<-errCh, <-errCh); err != nil {
-					return fmt.Errorf("shutting down: %w", err)
+				var finalErr error
+				for range workers {
+					multierr.AppendInto(&finalErr, <-errCh)
+				}
+
+				if finalErr != nil {
+					return fmt.Errorf("shutting down: %w", finalErr)
 				}
 
 				return nil
@@ -91,16 +230,165 @@ func run(flags flags) func(*cobra.Command, []string) error {
 	}
 }
 
+func schedules(cfgs []config.ScheduleConfig) []scheduler.Schedule {
+	result := make([]scheduler.Schedule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		result = append(result, scheduler.Schedule(cfg))
+	}
+
+	return result
+}
+
+func ensureDevTLS(cfg config.DevTLSConfig) (certs.Paths, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		var err error
+
+		dir, err = certs.DefaultDir()
+		if err != nil {
+			return certs.Paths{}, err
+		}
+	}
+
+	return certs.NewGenerator(certs.WithDir(dir), certs.WithSANs(cfg.SANs)).Ensure()
+}
+
+func newZapLogger(cfg config.LogConfig) (*zap.Logger, error) {
+	zcfg := zap.NewProductionConfig()
+	if cfg.Development {
+		zcfg = zap.NewDevelopmentConfig()
+	}
+
+	level, err := zap.ParseAtomicLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	zcfg.Level = level
+
+	return zcfg.Build()
+}
+
 type flags struct {
-	BindAddr        string
-	MetricsBindAddr string
-	CertFile        string
-	KeyFile         string
+	ConfigFile         string
+	BindAddr           string
+	MetricsBindAddr    string
+	CertFile           string
+	KeyFile            string
+	ClientCAFile       string
+	InsecureHTTP       bool
+	DevTLS             bool
+	DevTLSDir          string
+	DevTLSSANs         []string
+	TokensFile         string
+	RunTimeout         time.Duration
+	MaxRunTimeout      time.Duration
+	MaxConcurrentRuns  int
+	MaxQueuedRuns      int
+	IdempotencyWindow  time.Duration
+	CircuitThreshold   int
+	CircuitCooldown    time.Duration
+	LogLevel           string
+	RecordFile         string
+	RecordFormat       string
+	RecordMaxSize      int64
+	RecordRotatePerRun bool
+	RecordGzip         bool
 }
 
 func (f *flags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.ConfigFile, "config", f.ConfigFile, "Path to YAML configuration file")
 	flags.StringVar(&f.BindAddr, "bind-addr", f.BindAddr, "Address for server to listen on")
 	flags.StringVar(&f.MetricsBindAddr, "metrics-bind-addr", f.MetricsBindAddr, "Address for metrics server to listen on")
 	flags.StringVar(&f.CertFile, "cert-file", f.CertFile, "Path to server TLS certificate")
 	flags.StringVar(&f.KeyFile, "key-file", f.KeyFile, "Path to server TLS private key")
+	flags.StringVar(&f.ClientCAFile, "client-ca-file", f.ClientCAFile, "Path to CA bundle used to verify client certificates (enables mTLS)")
+	flags.BoolVar(&f.InsecureHTTP, "insecure-http", f.InsecureHTTP, "Serve plaintext HTTP, e.g. behind a TLS terminating proxy")
+	flags.BoolVar(&f.DevTLS, "dev-tls", f.DevTLS, "Generate and use a cached self-signed development certificate")
+	flags.StringVar(&f.DevTLSDir, "dev-tls-dir", f.DevTLSDir, "Directory development certificates are cached in")
+	flags.StringSliceVar(&f.DevTLSSANs, "dev-tls-san", f.DevTLSSANs, "DNS names and IP addresses the development certificate is valid for")
+	flags.StringVar(&f.TokensFile, "tokens-file", f.TokensFile, "Path to API token file; enables bearer token authentication")
+	flags.DurationVar(&f.RunTimeout, "run-timeout", f.RunTimeout, "Default maximum duration of a run")
+	flags.DurationVar(&f.MaxRunTimeout, "max-run-timeout", f.MaxRunTimeout, "Upper bound on timeouts requested by clients (0 for no bound)")
+	flags.IntVar(&f.MaxConcurrentRuns, "max-concurrent-runs", f.MaxConcurrentRuns, "Maximum number of runs executing at once")
+	flags.IntVar(&f.MaxQueuedRuns, "max-queued-runs", f.MaxQueuedRuns, "Maximum number of runs waiting to execute")
+	flags.DurationVar(&f.IdempotencyWindow, "idempotency-window", f.IdempotencyWindow, "Duration for which Idempotency-Key headers on run requests are remembered")
+	flags.IntVar(&f.CircuitThreshold, "circuit-failure-threshold", f.CircuitThreshold, "Consecutive failed runs after which a scraper is skipped")
+	flags.DurationVar(&f.CircuitCooldown, "circuit-cooldown", f.CircuitCooldown, "Duration a failing scraper is skipped before it is probed again")
+	flags.StringVar(&f.LogLevel, "log-level", f.LogLevel, "Log level (debug, info, warn, error)")
+	flags.StringVar(&f.RecordFile, "record-file", f.RecordFile, "Path to file which products are recorded to")
+	flags.StringVar(&f.RecordFormat, "record-format", f.RecordFormat, "Format of recorded products (jsonl, csv)")
+	flags.Int64Var(&f.RecordMaxSize, "record-max-size", f.RecordMaxSize, "Size in bytes after which the record file is rotated")
+	flags.BoolVar(&f.RecordRotatePerRun, "record-rotate-per-run", f.RecordRotatePerRun, "Rotate the record file after each run")
+	flags.BoolVar(&f.RecordGzip, "record-gzip", f.RecordGzip, "Compress rotated record files with gzip")
+}
+
+func (f *flags) Config(flags *pflag.FlagSet) (config.Config, error) {
+	cfg, err := config.Load(f.ConfigFile)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	overrides := []struct {
+		flag  string
+		path  string
+		apply func()
+	}{
+		{"bind-addr", "server.bindAddr", func() { cfg.Server.BindAddr = f.BindAddr }},
+		{"metrics-bind-addr", "metrics.bindAddr", func() { cfg.Metrics.BindAddr = f.MetricsBindAddr }},
+		{"cert-file", "server.certFile", func() { cfg.Server.CertFile = f.CertFile }},
+		{"key-file", "server.keyFile", func() { cfg.Server.KeyFile = f.KeyFile }},
+		{"client-ca-file", "server.clientCAFile", func() { cfg.Server.ClientCAFile = f.ClientCAFile }},
+		{"insecure-http", "server.insecureHTTP", func() { cfg.Server.InsecureHTTP = f.InsecureHTTP }},
+		{"dev-tls", "server.devTLS.enabled", func() { cfg.Server.DevTLS.Enabled = f.DevTLS }},
+		{"dev-tls-dir", "server.devTLS.dir", func() { cfg.Server.DevTLS.Dir = f.DevTLSDir }},
+		{"dev-tls-san", "server.devTLS.sans", func() { cfg.Server.DevTLS.SANs = f.DevTLSSANs }},
+		{"tokens-file", "server.auth.tokensFile", func() { cfg.Server.Auth.TokensFile = f.TokensFile }},
+		{"run-timeout", "server.runTimeout", func() { cfg.Server.RunTimeout = f.RunTimeout }},
+		{"max-run-timeout", "server.maxRunTimeout", func() { cfg.Server.MaxRunTimeout = f.MaxRunTimeout }},
+		{"max-concurrent-runs", "server.maxConcurrentRuns", func() { cfg.Server.MaxConcurrentRuns = f.MaxConcurrentRuns }},
+		{"max-queued-runs", "server.maxQueuedRuns", func() { cfg.Server.MaxQueuedRuns = f.MaxQueuedRuns }},
+		{"idempotency-window", "server.idempotencyWindow", func() { cfg.Server.IdempotencyWindow = f.IdempotencyWindow }},
+		{"circuit-failure-threshold", "server.circuitBreaker.failureThreshold", func() { cfg.Server.CircuitBreaker.FailureThreshold = f.CircuitThreshold }},
+		{"circuit-cooldown", "server.circuitBreaker.cooldown", func() { cfg.Server.CircuitBreaker.Cooldown = f.CircuitCooldown }},
+		{"log-level", "log.level", func() { cfg.Log.Level = f.LogLevel }},
+		{"record-file", "recorders.file.path", func() { cfg.Recorders.File.Path = f.RecordFile }},
+		{"record-format", "recorders.file.format", func() { cfg.Recorders.File.Format = f.RecordFormat }},
+		{"record-max-size", "recorders.file.maxSize", func() { cfg.Recorders.File.MaxSize = f.RecordMaxSize }},
+		{"record-rotate-per-run", "recorders.file.rotatePerRun", func() { cfg.Recorders.File.RotatePerRun = f.RecordRotatePerRun }},
+		{"record-gzip", "recorders.file.gzip", func() { cfg.Recorders.File.Gzip = f.RecordGzip }},
+	}
+
+	for _, o := range overrides {
+		if flags.Changed(o.flag) {
+			o.apply()
+			cfg.Override(o.path, "flag --"+o.flag)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return cfg, nil
+}
+
+// maxQueuedRuns maps a configured limit of 0, which disables queueing, to
+// the server's equivalent.
+func maxQueuedRuns(n int) int {
+	if n == 0 {
+		return -1
+	}
+
+	return n
+}
+
+func notifiers(cfg config.NotifiersConfig) []webhook.Delivery {
+	deliveries := make([]webhook.Delivery, 0, len(cfg.Webhooks))
+
+	for _, w := range cfg.Webhooks {
+		deliveries = append(deliveries, webhook.Delivery{URL: w.URL, Secret: w.Secret})
+	}
+
+	return deliveries
 }
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package start
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/ajpantuso/pen-finder/internal/config"
+	"github.com/ajpantuso/pen-finder/internal/httpcache"
+	"github.com/ajpantuso/pen-finder/internal/scheduler"
+	"github.com/ajpantuso/pen-finder/internal/server"
+	"github.com/go-logr/logr"
+)
+
+type reloader struct {
+	load         func() (config.Config, error)
+	current      config.Config
+	cacheMetrics *httpcache.Metrics
+	srv          *server.DefaultServer
+	sched        *scheduler.Scheduler
+	logger       logr.Logger
+	lock         *sync.Mutex
+}
+
+func (r *reloader) Reload(_ context.Context) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	if restart := requiresRestart(r.current, cfg); len(restart) > 0 {
+		r.logger.Info("ignoring changes which require a restart", "sections", restart)
+	}
+
+	scraperOpts, err := cfg.ScraperOptions(httpcache.WithMetrics{Metrics: r.cacheMetrics}, httpcache.WithLogger{Logger: r.logger})
+	if err != nil {
+		return err
+	}
+
+	feedOpts, err := cfg.FeedScraperOptions()
+	if err != nil {
+		return err
+	}
+
+	r.srv.SetScraperConfig(server.ScraperConfig{
+		Names:       cfg.EnabledScrapers(),
+		Options:     scraperOpts,
+		FeedOptions: feedOpts,
+	})
+	r.sched.Update(schedules(cfg.Schedules))
+
+	r.current.Crawl = cfg.Crawl
+	r.current.Scrapers = cfg.Scrapers
+	r.current.Feeds = cfg.Feeds
+	r.current.Schedules = cfg.Schedules
+
+	r.logger.Info("reloaded configuration")
+
+	return nil
+}
+
+func (r *reloader) watchSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("received reload signal")
+
+			if err := r.Reload(ctx); err != nil {
+				r.logger.Error(err, "reloading configuration")
+			}
+		}
+	}
+}
+
+func requiresRestart(current, next config.Config) []string {
+	var sections []string
+
+	if !reflect.DeepEqual(current.Server, next.Server) {
+		sections = append(sections, "server")
+	}
+	if current.Metrics != next.Metrics {
+		sections = append(sections, "metrics")
+	}
+	if current.Log != next.Log {
+		sections = append(sections, "log")
+	}
+	if current.Recorders != next.Recorders {
+		sections = append(sections, "recorders")
+	}
+	if !reflect.DeepEqual(current.Notifiers, next.Notifiers) {
+		sections = append(sections, "notifiers")
+	}
+
+	return sections
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package start
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/config"
+	"github.com/ajpantuso/pen-finder/internal/scheduler"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/ajpantuso/pen-finder/internal/server"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	current := config.Default()
+
+	next := config.Default()
+	next.Server.BindAddr = ":9090"
+	next.Log.Level = "debug"
+	next.Crawl.Delay = 5 * time.Second
+	next.Scrapers = []config.ScraperConfig{
+		{Name: api.ScraperTruphae},
+		{Name: api.ScraperFPH, Disabled: true},
+		{Name: api.ScraperChatterly, Disabled: true},
+	}
+	next.Schedules = []config.ScheduleConfig{
+		{Name: "hourly", Interval: time.Hour, Scrapers: []api.Scraper{api.ScraperTruphae}},
+	}
+
+	srv := server.NewDefaultServer(
+		server.WithRunner{Runner: noopRunner{}},
+		server.WithScrapers(current.EnabledScrapers()),
+	)
+
+	rl := &reloader{
+		load: func() (config.Config, error) {
+			return next, nil
+		},
+		current: current,
+		srv:     srv,
+		sched:   scheduler.NewScheduler(),
+		logger:  logr.Discard(),
+		lock:    &sync.Mutex{},
+	}
+
+	require.NoError(t, rl.Reload(context.Background()))
+
+	assert.Equal(t, current.Server, rl.current.Server, "server changes require a restart")
+	assert.Equal(t, current.Log, rl.current.Log, "log changes require a restart")
+	assert.Equal(t, next.Crawl, rl.current.Crawl)
+	assert.Equal(t, next.Scrapers, rl.current.Scrapers)
+	assert.Equal(t, next.Schedules, rl.current.Schedules)
+
+	runID, err := srv.StartRun(api.PostRunRequest{})
+	require.NoError(t, err)
+
+	res := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/run/"+runID.String(), nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var run api.GetRunResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &run))
+	assert.Equal(t, []api.Scraper{api.ScraperTruphae}, run.Scrapers, "only enabled scrapers run after reload")
+}
+
+func TestRequiresRestart(t *testing.T) {
+	current := config.Default()
+
+	next := config.Default()
+	next.Crawl.Parallelism = 8
+	next.Schedules = []config.ScheduleConfig{{Name: "hourly", Interval: time.Hour}}
+	next.Scrapers = []config.ScraperConfig{{Name: api.ScraperTruphae, Disabled: true}}
+
+	assert.Empty(t, requiresRestart(current, next), "crawl, scrapers and schedules are reloadable")
+
+	next.Server.MaxConcurrentRuns++
+	next.Metrics.BindAddr = ":9999"
+	next.Log.Development = !next.Log.Development
+	next.Recorders.File.Path = "products.jsonl"
+
+	assert.Equal(t, []string{"server", "metrics", "log", "recorders"}, requiresRestart(current, next))
+}
+
+type noopRunner struct{}
+
+func (noopRunner) Run(context.Context, ...scraper.RunOption) error {
+	return nil
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tokens
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	tokensFile := "tokens.yaml"
+
+	cmd := &cobra.Command{
+		Use:   "tokens",
+		Short: "Manages API tokens",
+	}
+	cmd.PersistentFlags().StringVar(&tokensFile, "tokens-file", tokensFile, "Path to API token file")
+
+	cmd.AddCommand(
+		newMintCommand(&tokensFile),
+		newRevokeCommand(&tokensFile),
+		newListCommand(&tokensFile),
+	)
+
+	return cmd
+}
+
+func newMintCommand(tokensFile *string) *cobra.Command {
+	var (
+		name string
+		role = string(auth.RoleReader)
+	)
+
+	cmd := &cobra.Command{
+		Use:   "mint",
+		Short: "Mints a new API token and prints it once",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if name == "" {
+				return fmt.Errorf("--name is required")
+			}
+
+			secret, token, err := auth.NewFileTokenStore(*tokensFile).Mint(name, auth.Role(role))
+			if err != nil {
+				return fmt.Errorf("minting token: %w", err)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "minted token %s (%s) for %q; it will not be shown again\n", token.ID, token.Role, token.Name)
+			fmt.Fprintln(cmd.OutOrStdout(), secret)
+
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", name, "Name describing who uses the token")
+	cmd.Flags().StringVar(&role, "role", role, "Role granted to the token (reader, operator)")
+
+	return cmd
+}
+
+func newRevokeCommand(tokensFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke TOKEN_ID",
+		Short: "Revokes an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := auth.NewFileTokenStore(*tokensFile).Revoke(args[0]); err != nil {
+				return fmt.Errorf("revoking token: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newListCommand(tokensFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Lists API tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			tokens, err := auth.NewFileTokenStore(*tokensFile).List()
+			if err != nil {
+				return fmt.Errorf("listing tokens: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+
+			fmt.Fprintln(w, "ID\tNAME\tROLE\tCREATED")
+			for _, t := range tokens {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Role, t.CreatedAt.Local().Format(time.DateTime))
+			}
+
+			return w.Flush()
+		},
+	}
+}
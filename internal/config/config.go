@@ -0,0 +1,860 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/httpcache"
+	"github.com/ajpantuso/pen-finder/internal/recorder/file"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"gopkg.in/yaml.v3"
+)
+
+const EnvPrefix = "PEN_FINDER_"
+
+type Config struct {
+	Server  ServerConfig  `yaml:"server"`
+	Metrics MetricsConfig `yaml:"metrics"`
+	Log     LogConfig     `yaml:"log"`
+	Crawl   CrawlConfig   `yaml:"crawl"`
+	// Scrapers override the settings of builtin scrapers which are all
+	// enabled unless disabled here. PEN_FINDER_SCRAPERS enables only the
+	// listed builtin scrapers while keeping their overrides.
+	Scrapers  []ScraperConfig  `yaml:"scrapers"`
+	Feeds     []FeedConfig     `yaml:"feeds"`
+	Recorders RecordersConfig  `yaml:"recorders"`
+	Schedules []ScheduleConfig `yaml:"schedules"`
+	Notifiers NotifiersConfig  `yaml:"notifiers"`
+
+	source source
+}
+
+type ServerConfig struct {
+	BindAddr          string               `yaml:"bindAddr"`
+	CertFile          string               `yaml:"certFile"`
+	KeyFile           string               `yaml:"keyFile"`
+	ClientCAFile      string               `yaml:"clientCAFile"`
+	RunTimeout        time.Duration        `yaml:"runTimeout"`
+	MaxRunTimeout     time.Duration        `yaml:"maxRunTimeout"`
+	MaxConcurrentRuns int                  `yaml:"maxConcurrentRuns"`
+	MaxQueuedRuns     int                  `yaml:"maxQueuedRuns"`
+	IdempotencyWindow time.Duration        `yaml:"idempotencyWindow"`
+	CircuitBreaker    CircuitBreakerConfig `yaml:"circuitBreaker"`
+	InsecureHTTP      bool                 `yaml:"insecureHTTP"`
+	DevTLS            DevTLSConfig         `yaml:"devTLS"`
+	Auth              AuthConfig           `yaml:"auth"`
+	// AllowPrivateCallbacks permits run callbacks to loopback, private and
+	// link-local addresses which are refused by default.
+	AllowPrivateCallbacks bool `yaml:"allowPrivateCallbacks"`
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	Cooldown         time.Duration `yaml:"cooldown"`
+}
+
+type AuthConfig struct {
+	TokensFile string `yaml:"tokensFile"`
+}
+
+type DevTLSConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Dir     string   `yaml:"dir"`
+	SANs    []string `yaml:"sans"`
+}
+
+type MetricsConfig struct {
+	BindAddr string `yaml:"bindAddr"`
+}
+
+type LogConfig struct {
+	Level       string `yaml:"level"`
+	Development bool   `yaml:"development"`
+}
+
+type ScraperConfig struct {
+	Name     api.Scraper         `yaml:"name"`
+	Disabled bool                `yaml:"disabled"`
+	Crawl    CrawlOverrideConfig `yaml:"crawl"`
+	Sitemap  SitemapConfig       `yaml:"sitemap"`
+}
+
+// SitemapConfig discovers products through the sitemaps of a shop instead
+// of its listing pages.
+type SitemapConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// URLs default to /sitemap.xml on the host of the shop.
+	URLs []string `yaml:"urls"`
+	// Filters are patterns of product URLs to visit in addition to those of
+	// the scraper. Shopify sitemaps list products under /products/ for the
+	// whole shop rather than per collection.
+	Filters []string `yaml:"filters"`
+	// ProductPathPrefix of products listed in the sitemaps defaults to the
+	// one of the scraper, e.g. /products/ for Shopify shops whose scraper
+	// is limited to a collection.
+	ProductPathPrefix string `yaml:"productPathPrefix"`
+	// StateFile keeps when products were last visited between runs and
+	// defaults to a file per scraper in the user cache directory.
+	StateFile string `yaml:"stateFile"`
+}
+
+// FeedConfig adds a scraper named Name which records new entries of RSS or
+// Atom feeds.
+type FeedConfig struct {
+	Name api.Scraper `yaml:"name"`
+	URLs []string    `yaml:"urls"`
+	// StateFile keeps the entries already recorded between runs and
+	// defaults to a file per feed in the user cache directory.
+	StateFile string `yaml:"stateFile"`
+	// Retention is how long entries no longer listed are remembered.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// NotifiersConfig configures where the results of every run are sent in
+// addition to the callback of the run request.
+type NotifiersConfig struct {
+	Webhooks []WebhookNotifierConfig `yaml:"webhooks"`
+}
+
+// WebhookNotifierConfig receives the same payload as run callbacks signed
+// with Secret when it is set.
+type WebhookNotifierConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+type CrawlConfig struct {
+	Delay           time.Duration `yaml:"delay"`
+	RandomDelay     time.Duration `yaml:"randomDelay"`
+	Parallelism     int           `yaml:"parallelism"`
+	IgnoreRobotsTxt bool          `yaml:"ignoreRobotsTxt"`
+	Retry           RetryConfig   `yaml:"retry"`
+	Cache           CacheConfig   `yaml:"cache"`
+}
+
+type CacheConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	MaxSize int64  `yaml:"maxSize"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	ErrorBudget    int           `yaml:"errorBudget"`
+}
+
+type CrawlOverrideConfig struct {
+	Delay           *time.Duration      `yaml:"delay"`
+	RandomDelay     *time.Duration      `yaml:"randomDelay"`
+	Parallelism     *int                `yaml:"parallelism"`
+	IgnoreRobotsTxt *bool               `yaml:"ignoreRobotsTxt"`
+	Retry           RetryOverrideConfig `yaml:"retry"`
+	Cache           CacheOverrideConfig `yaml:"cache"`
+}
+
+type CacheOverrideConfig struct {
+	Enabled *bool  `yaml:"enabled"`
+	MaxSize *int64 `yaml:"maxSize"`
+}
+
+func (o CacheOverrideConfig) Apply(c CacheConfig) CacheConfig {
+	if o.Enabled != nil {
+		c.Enabled = *o.Enabled
+	}
+	if o.MaxSize != nil {
+		c.MaxSize = *o.MaxSize
+	}
+
+	return c
+}
+
+type RetryOverrideConfig struct {
+	MaxAttempts    *int           `yaml:"maxAttempts"`
+	InitialBackoff *time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     *time.Duration `yaml:"maxBackoff"`
+	ErrorBudget    *int           `yaml:"errorBudget"`
+}
+
+func (o RetryOverrideConfig) Apply(c RetryConfig) RetryConfig {
+	if o.MaxAttempts != nil {
+		c.MaxAttempts = *o.MaxAttempts
+	}
+	if o.InitialBackoff != nil {
+		c.InitialBackoff = *o.InitialBackoff
+	}
+	if o.MaxBackoff != nil {
+		c.MaxBackoff = *o.MaxBackoff
+	}
+	if o.ErrorBudget != nil {
+		c.ErrorBudget = *o.ErrorBudget
+	}
+
+	return c
+}
+
+func (o CrawlOverrideConfig) Apply(c CrawlConfig) CrawlConfig {
+	if o.Delay != nil {
+		c.Delay = *o.Delay
+	}
+	if o.RandomDelay != nil {
+		c.RandomDelay = *o.RandomDelay
+	}
+	if o.Parallelism != nil {
+		c.Parallelism = *o.Parallelism
+	}
+	if o.IgnoreRobotsTxt != nil {
+		c.IgnoreRobotsTxt = *o.IgnoreRobotsTxt
+	}
+
+	c.Retry = o.Retry.Apply(c.Retry)
+	c.Cache = o.Cache.Apply(c.Cache)
+
+	return c
+}
+
+type RecordersConfig struct {
+	File FileRecorderConfig `yaml:"file"`
+}
+
+type FileRecorderConfig struct {
+	Path         string `yaml:"path"`
+	Format       string `yaml:"format"`
+	MaxSize      int64  `yaml:"maxSize"`
+	RotatePerRun bool   `yaml:"rotatePerRun"`
+	Gzip         bool   `yaml:"gzip"`
+}
+
+type ScheduleConfig struct {
+	Name     string        `yaml:"name"`
+	Interval time.Duration `yaml:"interval"`
+	Scrapers []api.Scraper `yaml:"scrapers"`
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			BindAddr: ":8080",
+			CertFile: "server.crt",
+			KeyFile:  "server.key",
+			// crawls are throttled by crawl.delay and robots.txt so a run
+			// visiting a few hundred pages takes minutes rather than seconds
+			RunTimeout:        15 * time.Minute,
+			MaxRunTimeout:     time.Hour,
+			MaxConcurrentRuns: 2,
+			MaxQueuedRuns:     10,
+			IdempotencyWindow: 24 * time.Hour,
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 3,
+				Cooldown:         15 * time.Minute,
+			},
+		},
+		Metrics: MetricsConfig{
+			BindAddr: ":8083",
+		},
+		Log: LogConfig{
+			Level:       "info",
+			Development: true,
+		},
+		Crawl: CrawlConfig{
+			Delay:       time.Second,
+			RandomDelay: 500 * time.Millisecond,
+			Parallelism: scraper.DefaultParallelism,
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: time.Second,
+				MaxBackoff:     30 * time.Second,
+				ErrorBudget:    10,
+			},
+			Cache: CacheConfig{
+				MaxSize: httpcache.DefaultMaxSize,
+			},
+		},
+		Recorders: RecordersConfig{
+			File: FileRecorderConfig{
+				Format: string(file.FormatJSONLines),
+			},
+		},
+	}
+}
+
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	return c.decode(path, data)
+}
+
+func (c *Config) decode(path string, data []byte) error {
+	var root yaml.Node
+
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return &FileError{File: path, Err: err}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return &FileError{File: path, Err: err}
+	}
+
+	c.source.file = path
+	c.source.root = &root
+
+	return nil
+}
+
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, strings.TrimPrefix(e.Err.Error(), "yaml: "))
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+type LookupEnvFunc func(string) (string, bool)
+
+func (c *Config) LoadEnv(lookup LookupEnvFunc) error {
+	for _, b := range c.envBindings() {
+		name := EnvPrefix + b.name
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		if err := b.set(raw); err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+
+		c.Override(b.path, "env "+name)
+	}
+
+	return nil
+}
+
+type envBinding struct {
+	name string
+	path string
+	set  func(string) error
+}
+
+func (c *Config) envBindings() []envBinding {
+	return []envBinding{
+		{"SERVER_BIND_ADDR", "server.bindAddr", setString(&c.Server.BindAddr)},
+		{"SERVER_CERT_FILE", "server.certFile", setString(&c.Server.CertFile)},
+		{"SERVER_KEY_FILE", "server.keyFile", setString(&c.Server.KeyFile)},
+		{"SERVER_CLIENT_CA_FILE", "server.clientCAFile", setString(&c.Server.ClientCAFile)},
+		{"SERVER_RUN_TIMEOUT", "server.runTimeout", setDuration(&c.Server.RunTimeout)},
+		{"SERVER_MAX_RUN_TIMEOUT", "server.maxRunTimeout", setDuration(&c.Server.MaxRunTimeout)},
+		{"SERVER_MAX_CONCURRENT_RUNS", "server.maxConcurrentRuns", setInt(&c.Server.MaxConcurrentRuns)},
+		{"SERVER_MAX_QUEUED_RUNS", "server.maxQueuedRuns", setInt(&c.Server.MaxQueuedRuns)},
+		{"SERVER_IDEMPOTENCY_WINDOW", "server.idempotencyWindow", setDuration(&c.Server.IdempotencyWindow)},
+		{"SERVER_CIRCUIT_BREAKER_FAILURE_THRESHOLD", "server.circuitBreaker.failureThreshold", setInt(&c.Server.CircuitBreaker.FailureThreshold)},
+		{"SERVER_CIRCUIT_BREAKER_COOLDOWN", "server.circuitBreaker.cooldown", setDuration(&c.Server.CircuitBreaker.Cooldown)},
+		{"SERVER_INSECURE_HTTP", "server.insecureHTTP", setBool(&c.Server.InsecureHTTP)},
+		{"SERVER_DEV_TLS", "server.devTLS.enabled", setBool(&c.Server.DevTLS.Enabled)},
+		{"SERVER_DEV_TLS_DIR", "server.devTLS.dir", setString(&c.Server.DevTLS.Dir)},
+		{"SERVER_DEV_TLS_SANS", "server.devTLS.sans", setStrings(&c.Server.DevTLS.SANs)},
+		{"SERVER_AUTH_TOKENS_FILE", "server.auth.tokensFile", setString(&c.Server.Auth.TokensFile)},
+		{"SERVER_ALLOW_PRIVATE_CALLBACKS", "server.allowPrivateCallbacks", setBool(&c.Server.AllowPrivateCallbacks)},
+		{"METRICS_BIND_ADDR", "metrics.bindAddr", setString(&c.Metrics.BindAddr)},
+		{"LOG_LEVEL", "log.level", setString(&c.Log.Level)},
+		{"LOG_DEVELOPMENT", "log.development", setBool(&c.Log.Development)},
+		{"CRAWL_DELAY", "crawl.delay", setDuration(&c.Crawl.Delay)},
+		{"CRAWL_RANDOM_DELAY", "crawl.randomDelay", setDuration(&c.Crawl.RandomDelay)},
+		{"CRAWL_PARALLELISM", "crawl.parallelism", setInt(&c.Crawl.Parallelism)},
+		{"CRAWL_IGNORE_ROBOTS_TXT", "crawl.ignoreRobotsTxt", setBool(&c.Crawl.IgnoreRobotsTxt)},
+		{"CRAWL_RETRY_MAX_ATTEMPTS", "crawl.retry.maxAttempts", setInt(&c.Crawl.Retry.MaxAttempts)},
+		{"CRAWL_RETRY_INITIAL_BACKOFF", "crawl.retry.initialBackoff", setDuration(&c.Crawl.Retry.InitialBackoff)},
+		{"CRAWL_RETRY_MAX_BACKOFF", "crawl.retry.maxBackoff", setDuration(&c.Crawl.Retry.MaxBackoff)},
+		{"CRAWL_RETRY_ERROR_BUDGET", "crawl.retry.errorBudget", setInt(&c.Crawl.Retry.ErrorBudget)},
+		{"CRAWL_CACHE_ENABLED", "crawl.cache.enabled", setBool(&c.Crawl.Cache.Enabled)},
+		{"CRAWL_CACHE_DIR", "crawl.cache.dir", setString(&c.Crawl.Cache.Dir)},
+		{"CRAWL_CACHE_MAX_SIZE", "crawl.cache.maxSize", setInt64(&c.Crawl.Cache.MaxSize)},
+		{"SCRAPERS", "scrapers", c.setScrapers},
+		{"RECORDERS_FILE_PATH", "recorders.file.path", setString(&c.Recorders.File.Path)},
+		{"RECORDERS_FILE_FORMAT", "recorders.file.format", setString(&c.Recorders.File.Format)},
+		{"RECORDERS_FILE_MAX_SIZE", "recorders.file.maxSize", setInt64(&c.Recorders.File.MaxSize)},
+		{"RECORDERS_FILE_ROTATE_PER_RUN", "recorders.file.rotatePerRun", setBool(&c.Recorders.File.RotatePerRun)},
+		{"RECORDERS_FILE_GZIP", "recorders.file.gzip", setBool(&c.Recorders.File.Gzip)},
+	}
+}
+
+// setScrapers enables only the listed scrapers. Overrides of the scrapers
+// section are kept and unknown names are added so that they fail
+// validation.
+func (c *Config) setScrapers(raw string) error {
+	var enabled []api.Scraper
+
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enabled = append(enabled, api.Scraper(name))
+		}
+	}
+
+	for i, s := range c.Scrapers {
+		c.Scrapers[i].Disabled = !slices.Contains(enabled, s.Name)
+	}
+
+	for _, name := range append(scraper.BuiltinNames(), enabled...) {
+		if !slices.ContainsFunc(c.Scrapers, func(s ScraperConfig) bool { return s.Name == name }) {
+			c.Scrapers = append(c.Scrapers, ScraperConfig{Name: name, Disabled: !slices.Contains(enabled, name)})
+		}
+	}
+
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(raw string) error {
+		*dst = raw
+
+		return nil
+	}
+}
+
+func setStrings(dst *[]string) func(string) error {
+	return func(raw string) error {
+		*dst = nil
+
+		for _, val := range strings.Split(raw, ",") {
+			if val = strings.TrimSpace(val); val != "" {
+				*dst = append(*dst, val)
+			}
+		}
+
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(raw string) error {
+		val, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+
+		*dst = val
+
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(raw string) error {
+		val, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+
+		*dst = val
+
+		return nil
+	}
+}
+
+func setInt64(dst *int64) func(string) error {
+	return func(raw string) error {
+		val, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		*dst = val
+
+		return nil
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(raw string) error {
+		val, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		*dst = val
+
+		return nil
+	}
+}
+
+func (c *Config) Override(path, origin string) {
+	if c.source.overrides == nil {
+		c.source.overrides = make(map[string]string)
+	}
+
+	c.source.overrides[path] = origin
+}
+
+// EnabledScrapers returns the builtin scrapers which are not disabled
+// followed by the configured feeds.
+func (c *Config) EnabledScrapers() []api.Scraper {
+	var names []api.Scraper
+
+	for _, name := range scraper.BuiltinNames() {
+		disabled := slices.ContainsFunc(c.Scrapers, func(s ScraperConfig) bool {
+			return s.Name == name && s.Disabled
+		})
+
+		if !disabled {
+			names = append(names, name)
+		}
+	}
+
+	for _, f := range c.Feeds {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+// ScraperNames returns the builtin scrapers followed by the configured feeds.
+func (c *Config) ScraperNames() []api.Scraper {
+	names := scraper.BuiltinNames()
+
+	for _, f := range c.Feeds {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+func (c *Config) IsScraper(name api.Scraper) bool {
+	return slices.Contains(c.ScraperNames(), name)
+}
+
+func (c *Config) CrawlSettings() map[api.Scraper]CrawlConfig {
+	settings := make(map[api.Scraper]CrawlConfig)
+
+	for _, name := range scraper.BuiltinNames() {
+		settings[name] = c.Crawl
+	}
+
+	for _, s := range c.Scrapers {
+		settings[s.Name] = s.Crawl.Apply(c.Crawl)
+	}
+
+	return settings
+}
+
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+
+	add := func(path []any, format string, args ...any) {
+		errs = append(errs, FieldError{
+			Path:     formatPath(path),
+			Location: c.source.locate(path),
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if c.Server.BindAddr == "" {
+		add([]any{"server", "bindAddr"}, "must not be empty")
+	}
+	if c.Server.RunTimeout < 0 {
+		add([]any{"server", "runTimeout"}, "must not be negative")
+	}
+	if c.Server.MaxRunTimeout < 0 {
+		add([]any{"server", "maxRunTimeout"}, "must not be negative")
+	}
+	if c.Server.MaxRunTimeout > 0 && c.Server.RunTimeout > c.Server.MaxRunTimeout {
+		add([]any{"server", "runTimeout"}, "must not exceed server.maxRunTimeout")
+	}
+	if c.Server.MaxConcurrentRuns < 1 {
+		add([]any{"server", "maxConcurrentRuns"}, "must be at least 1")
+	}
+	if c.Server.MaxQueuedRuns < 0 {
+		add([]any{"server", "maxQueuedRuns"}, "must not be negative")
+	}
+	if c.Server.IdempotencyWindow <= 0 {
+		add([]any{"server", "idempotencyWindow"}, "must be positive")
+	}
+	if c.Server.CircuitBreaker.FailureThreshold < 1 {
+		add([]any{"server", "circuitBreaker", "failureThreshold"}, "must be at least 1")
+	}
+	if c.Server.CircuitBreaker.Cooldown <= 0 {
+		add([]any{"server", "circuitBreaker", "cooldown"}, "must be positive")
+	}
+	if c.Server.InsecureHTTP && c.Server.DevTLS.Enabled {
+		add([]any{"server", "insecureHTTP"}, "cannot be combined with server.devTLS")
+	}
+	if c.Server.InsecureHTTP && c.Server.ClientCAFile != "" {
+		add([]any{"server", "insecureHTTP"}, "cannot be combined with server.clientCAFile")
+	}
+	if c.Metrics.BindAddr == "" {
+		add([]any{"metrics", "bindAddr"}, "must not be empty")
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, c.Log.Level) {
+		add([]any{"log", "level"}, "must be one of debug, info, warn, error")
+	}
+
+	validateCrawl := func(path []any, crawl CrawlConfig) {
+		if crawl.Delay < 0 {
+			add(append(path, "delay"), "must not be negative")
+		}
+		if crawl.RandomDelay < 0 {
+			add(append(path, "randomDelay"), "must not be negative")
+		}
+		if crawl.Parallelism < 1 {
+			add(append(path, "parallelism"), "must be at least 1")
+		}
+		if crawl.Retry.MaxAttempts < 1 {
+			add(append(path, "retry", "maxAttempts"), "must be at least 1")
+		}
+		if crawl.Retry.InitialBackoff <= 0 {
+			add(append(path, "retry", "initialBackoff"), "must be positive")
+		}
+		if crawl.Retry.MaxBackoff < crawl.Retry.InitialBackoff {
+			add(append(path, "retry", "maxBackoff"), "must not be less than initialBackoff")
+		}
+		if crawl.Retry.ErrorBudget < 1 {
+			add(append(path, "retry", "errorBudget"), "must be at least 1")
+		}
+		if crawl.Cache.MaxSize < 1 {
+			add(append(path, "cache", "maxSize"), "must be at least 1")
+		}
+	}
+
+	validateCrawl([]any{"crawl"}, c.Crawl)
+
+	seen := make(map[api.Scraper]bool)
+
+	for i, s := range c.Scrapers {
+		switch {
+		case !scraper.IsBuiltin(s.Name):
+			add([]any{"scrapers", i, "name"}, "unknown scraper %q", s.Name)
+		case seen[s.Name]:
+			add([]any{"scrapers", i, "name"}, "duplicate scraper %q", s.Name)
+		}
+
+		seen[s.Name] = true
+
+		for j, pattern := range s.Sitemap.Filters {
+			if _, err := regexp.Compile(pattern); err != nil {
+				add([]any{"scrapers", i, "sitemap", "filters", j}, "invalid pattern: %s", err)
+			}
+		}
+
+		// only the overridden fields need checking; the rest come from crawl
+		validateCrawl([]any{"scrapers", i, "crawl"}, s.Crawl.Apply(CrawlConfig{
+			Parallelism: 1,
+			Retry:       RetryConfig{MaxAttempts: 1, InitialBackoff: 1, MaxBackoff: 1, ErrorBudget: 1},
+			Cache:       CacheConfig{MaxSize: 1},
+		}))
+	}
+
+	feeds := make(map[api.Scraper]bool)
+
+	for i, f := range c.Feeds {
+		switch {
+		case f.Name == "":
+			add([]any{"feeds", i, "name"}, "must not be empty")
+		case scraper.IsBuiltin(f.Name):
+			add([]any{"feeds", i, "name"}, "conflicts with builtin scraper %q", f.Name)
+		case feeds[f.Name]:
+			add([]any{"feeds", i, "name"}, "duplicate feed %q", f.Name)
+		}
+
+		feeds[f.Name] = true
+
+		if len(f.URLs) < 1 {
+			add([]any{"feeds", i, "urls"}, "must not be empty")
+		}
+
+		for j, raw := range f.URLs {
+			if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add([]any{"feeds", i, "urls", j}, "must be an absolute http or https URL")
+			}
+		}
+
+		if f.Retention < 0 {
+			add([]any{"feeds", i, "retention"}, "must not be negative")
+		}
+	}
+
+	switch file.Format(c.Recorders.File.Format) {
+	case file.FormatJSONLines, file.FormatCSV:
+	default:
+		add([]any{"recorders", "file", "format"}, "must be one of jsonl, csv")
+	}
+
+	if c.Recorders.File.MaxSize < 0 {
+		add([]any{"recorders", "file", "maxSize"}, "must not be negative")
+	}
+
+	names := make(map[string]bool)
+
+	for i, s := range c.Schedules {
+		if s.Name == "" {
+			add([]any{"schedules", i, "name"}, "must not be empty")
+		} else if names[s.Name] {
+			add([]any{"schedules", i, "name"}, "duplicate schedule %q", s.Name)
+		}
+
+		names[s.Name] = true
+
+		if s.Interval < time.Minute {
+			add([]any{"schedules", i, "interval"}, "must be at least 1m")
+		}
+
+		for j, name := range s.Scrapers {
+			if !c.IsScraper(name) {
+				add([]any{"schedules", i, "scrapers", j}, "unknown scraper %q", name)
+			}
+		}
+	}
+
+	for i, w := range c.Notifiers.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add([]any{"notifiers", "webhooks", i, "url"}, "must be an absolute http or https URL")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+type FieldError struct {
+	Path     string
+	Location string
+	Message  string
+}
+
+func (e FieldError) Error() string {
+	if e.Location == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", e.Location, e.Path, e.Message)
+}
+
+type source struct {
+	file      string
+	root      *yaml.Node
+	overrides map[string]string
+}
+
+func (s source) locate(path []any) string {
+	for i := len(path); i > 0; i-- {
+		if origin, ok := s.overrides[formatPath(path[:i])]; ok {
+			return origin
+		}
+	}
+
+	if s.root == nil {
+		return ""
+	}
+
+	node := s.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := node.Line
+
+	for _, seg := range path {
+		next := child(node, seg)
+		if next == nil {
+			break
+		}
+
+		node, line = next, next.Line
+	}
+
+	return fmt.Sprintf("%s:%d", s.file, line)
+}
+
+func child(node *yaml.Node, seg any) *yaml.Node {
+	switch key := seg.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+			return node.Content[key]
+		}
+	}
+
+	return nil
+}
+
+func formatPath(path []any) string {
+	var sb strings.Builder
+
+	for _, seg := range path {
+		switch v := seg.(type) {
+		case int:
+			fmt.Fprintf(&sb, "[%d]", v)
+		default:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+
+			fmt.Fprint(&sb, v)
+		}
+	}
+
+	return sb.String()
+}
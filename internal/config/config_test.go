@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLayering(t *testing.T) {
+	cfg := Default()
+
+	require.NoError(t, cfg.decode("config.yaml", []byte(`
+server:
+  bindAddr: ":9090"
+  runTimeout: 30s
+log:
+  level: warn
+scrapers:
+  - name: truphae
+    crawl:
+      delay: 3s
+  - name: fountain pen hospital
+    disabled: true
+`)))
+
+	env := map[string]string{
+		EnvPrefix + "SERVER_BIND_ADDR": ":7070",
+		EnvPrefix + "SCRAPERS":         "truphae, fountain pen hospital",
+	}
+
+	require.NoError(t, cfg.LoadEnv(func(name string) (string, bool) {
+		val, ok := env[name]
+
+		return val, ok
+	}))
+
+	assert.Equal(t, ":7070", cfg.Server.BindAddr)
+	assert.Equal(t, 30*time.Second, cfg.Server.RunTimeout)
+	assert.Equal(t, "warn", cfg.Log.Level)
+	assert.Equal(t, ":8083", cfg.Metrics.BindAddr)
+	assert.Equal(t, []api.Scraper{api.ScraperFPH, api.ScraperTruphae}, cfg.EnabledScrapers(), "the environment selects the enabled scrapers")
+	assert.Equal(t, 3*time.Second, cfg.CrawlSettings()[api.ScraperTruphae].Delay, "overrides from the file are kept")
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestConfigValidateLocations(t *testing.T) {
+	cfg := Default()
+
+	require.NoError(t, cfg.decode("config.yaml", []byte(`log:
+  level: loud
+schedules:
+  - name: nightly
+    interval: 1s
+notifiers:
+  webhooks:
+    - url: hooks.example/pen-finder
+`)))
+
+	cfg.Server.BindAddr = ""
+	cfg.Override("server.bindAddr", "flag --bind-addr")
+
+	var errs ValidationErrors
+
+	require.ErrorAs(t, cfg.Validate(), &errs)
+	assert.Equal(t, ValidationErrors{
+		{Path: "server.bindAddr", Location: "flag --bind-addr", Message: "must not be empty"},
+		{Path: "log.level", Location: "config.yaml:2", Message: "must be one of debug, info, warn, error"},
+		{Path: "schedules[0].interval", Location: "config.yaml:5", Message: "must be at least 1m"},
+		{Path: "notifiers.webhooks[0].url", Location: "config.yaml:8", Message: "must be an absolute http or https URL"},
+	}, errs)
+}
+
+func TestConfigCrawlSettings(t *testing.T) {
+	cfg := Default()
+
+	require.NoError(t, cfg.decode("config.yaml", []byte(`
+crawl:
+  delay: 2s
+scrapers:
+  - name: truphae
+    crawl:
+      parallelism: 1
+      ignoreRobotsTxt: true
+      cache:
+        enabled: true
+`)))
+	require.NoError(t, cfg.Validate())
+
+	settings := cfg.CrawlSettings()
+
+	assert.Equal(t, CrawlConfig{
+		Delay:           2 * time.Second,
+		RandomDelay:     500 * time.Millisecond,
+		Parallelism:     1,
+		IgnoreRobotsTxt: true,
+		Retry:           cfg.Crawl.Retry,
+		Cache:           CacheConfig{Enabled: true, MaxSize: cfg.Crawl.Cache.MaxSize},
+	}, settings["truphae"])
+	assert.Equal(t, cfg.Crawl, settings["fountain pen hospital"])
+}
+
+func TestConfigSitemap(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "truphae.json")
+	lastmod := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	data, err := json.Marshal(map[string]time.Time{"https://truphaeinc.com/products/pelikan-m800": lastmod})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(statePath, data, 0o644))
+
+	cfg := Default()
+
+	require.NoError(t, cfg.decode("config.yaml", []byte(`
+scrapers:
+  - name: truphae
+    sitemap:
+      enabled: true
+      filters: ['https://truphaeinc\.com/products/.*']
+      productPathPrefix: /products/
+      stateFile: `+statePath+`
+  - name: fountain pen hospital
+`)))
+	require.NoError(t, cfg.Validate())
+
+	opts, err := cfg.ScraperOptions()
+	require.NoError(t, err)
+
+	var truphae scraper.SimpleScraperConfig
+	truphae.Options(opts["truphae"]...)
+
+	require.NotNil(t, truphae.Sitemap)
+	assert.Equal(t, "/products/", truphae.Sitemap.ProductPathPrefix)
+	known, ok := truphae.Sitemap.State.Lastmod("https://truphaeinc.com/products/pelikan-m800")
+	assert.True(t, ok, "state is loaded from the state file")
+	assert.Equal(t, lastmod, known)
+	require.Len(t, truphae.Filters, 1)
+	assert.True(t, truphae.Filters[0].MatchString("https://truphaeinc.com/products/pelikan-m800"))
+
+	var fph scraper.SimpleScraperConfig
+	fph.Options(opts["fountain pen hospital"]...)
+
+	assert.Nil(t, fph.Sitemap)
+
+	t.Run("invalid filter", func(t *testing.T) {
+		cfg := Default()
+
+		require.NoError(t, cfg.decode("config.yaml", []byte(`scrapers:
+  - name: truphae
+    sitemap:
+      enabled: true
+      filters: ['(']
+`)))
+
+		var errs ValidationErrors
+
+		require.ErrorAs(t, cfg.Validate(), &errs)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "scrapers[0].sitemap.filters[0]", errs[0].Path)
+		assert.Equal(t, "config.yaml:5", errs[0].Location)
+	})
+}
+
+func TestConfigFeeds(t *testing.T) {
+	cfg := Default()
+
+	require.NoError(t, cfg.decode("config.yaml", []byte(`
+scrapers:
+  - name: truphae
+feeds:
+  - name: fpn classifieds
+    urls: ["https://forum.example/classifieds.xml"]
+    stateFile: `+filepath.Join(t.TempDir(), "fpn.json")+`
+schedules:
+  - name: hourly
+    interval: 1h
+    scrapers: ["fpn classifieds"]
+`)))
+	require.NoError(t, cfg.Validate())
+
+	assert.Equal(t, append(scraper.BuiltinNames(), "fpn classifieds"), cfg.EnabledScrapers(), "listed scrapers are overrides rather than an allow-list")
+	assert.True(t, cfg.IsScraper("fpn classifieds"))
+
+	opts, err := cfg.FeedScraperOptions()
+	require.NoError(t, err)
+
+	var feed scraper.FeedScraperConfig
+	feed.Options(opts["fpn classifieds"]...)
+
+	assert.Equal(t, []string{"https://forum.example/classifieds.xml"}, feed.URLs)
+	assert.Equal(t, "fpn_classifieds", feed.SourceName)
+	assert.IsType(t, &scraper.FileFeedState{}, feed.State)
+
+	t.Run("invalid", func(t *testing.T) {
+		cfg := Default()
+
+		require.NoError(t, cfg.decode("config.yaml", []byte(`feeds:
+  - name: truphae
+    urls: ["forum.example/rss"]
+  - name: classifieds
+`)))
+
+		var errs ValidationErrors
+
+		require.ErrorAs(t, cfg.Validate(), &errs)
+
+		paths := make([]string, 0, len(errs))
+		for _, e := range errs {
+			paths = append(paths, e.Path)
+		}
+
+		assert.Equal(t, []string{"feeds[0].name", "feeds[0].urls[0]", "feeds[1].urls"}, paths)
+	})
+}
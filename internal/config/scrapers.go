@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/httpcache"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+)
+
+// ScraperOptions translates the crawl settings of every scraper into
+// options for the builtin scrapers. cacheOpts apply to every HTTP cache.
+func (c *Config) ScraperOptions(cacheOpts ...httpcache.Option) (map[api.Scraper][]scraper.SimpleScraperOption, error) {
+	result := make(map[api.Scraper][]scraper.SimpleScraperOption)
+	for name, crawl := range c.CrawlSettings() {
+		result[name] = []scraper.SimpleScraperOption{
+			scraper.WithDelay(crawl.Delay),
+			scraper.WithRandomDelay(crawl.RandomDelay),
+			scraper.WithParallelism(crawl.Parallelism),
+			scraper.WithIgnoreRobotsTxt(crawl.IgnoreRobotsTxt),
+			scraper.WithRetryPolicy(crawl.Retry),
+		}
+
+		if !crawl.Cache.Enabled {
+			continue
+		}
+
+		dir := crawl.Cache.Dir
+		if dir == "" {
+			var err error
+
+			dir, err = httpcache.DefaultDir()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		transport, err := httpcache.NewTransport(append([]httpcache.Option{
+			httpcache.WithDir(filepath.Join(dir, strings.ReplaceAll(string(name), " ", "-"))),
+			httpcache.WithMaxSize(crawl.Cache.MaxSize),
+			httpcache.WithName(string(name)),
+		}, cacheOpts...)...)
+		if err != nil {
+			return nil, fmt.Errorf("creating HTTP cache for %s: %w", name, err)
+		}
+
+		result[name] = append(result[name], scraper.WithTransport{Transport: transport})
+	}
+
+	for _, s := range c.Scrapers {
+		if !s.Sitemap.Enabled {
+			continue
+		}
+
+		opts, err := s.Sitemap.options(s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("configuring sitemap for %s: %w", s.Name, err)
+		}
+
+		result[s.Name] = append(result[s.Name], opts...)
+	}
+
+	return result, nil
+}
+
+func (c SitemapConfig) options(name api.Scraper) ([]scraper.SimpleScraperOption, error) {
+	path := c.StateFile
+	if path == "" {
+		dir, err := scraper.DefaultSitemapStateDir()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(dir, strings.ReplaceAll(string(name), " ", "-")+".json")
+	}
+
+	state, err := scraper.NewFileSitemapState(path)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make(scraper.WithFilters, 0, len(c.Filters))
+	for _, pattern := range c.Filters {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling filter %q: %w", pattern, err)
+		}
+
+		filters = append(filters, re)
+	}
+
+	return []scraper.SimpleScraperOption{
+		scraper.WithSitemap{Sitemap: scraper.SitemapDiscovery{URLs: c.URLs, ProductPathPrefix: c.ProductPathPrefix, State: state}},
+		filters,
+	}, nil
+}
+
+// FeedScraperOptions translates the configured feeds into options for feed
+// scrapers keyed by feed name.
+func (c *Config) FeedScraperOptions() (map[api.Scraper][]scraper.FeedScraperOption, error) {
+	result := make(map[api.Scraper][]scraper.FeedScraperOption)
+	for _, f := range c.Feeds {
+		path := f.StateFile
+		if path == "" {
+			dir, err := scraper.DefaultFeedStateDir()
+			if err != nil {
+				return nil, err
+			}
+
+			path = filepath.Join(dir, strings.ReplaceAll(string(f.Name), " ", "-")+".json")
+		}
+
+		state, err := scraper.NewFileFeedState(path, scraper.WithFeedRetention(f.Retention))
+		if err != nil {
+			return nil, fmt.Errorf("configuring feed %s: %w", f.Name, err)
+		}
+
+		result[f.Name] = []scraper.FeedScraperOption{
+			scraper.WithFeedURLs(f.URLs),
+			scraper.WithSourceName(strings.ReplaceAll(string(f.Name), " ", "_")),
+			scraper.WithFeedState{State: state},
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,502 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fakeshop
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Layout string
+
+const (
+	// LayoutShopify serves relative links and ?page=N pagination.
+	LayoutShopify Layout = "shopify"
+	// LayoutWooCommerce serves absolute links with trailing slashes and /page/N/ pagination.
+	LayoutWooCommerce Layout = "woocommerce"
+	// LayoutPlain serves a hand-rolled site with /catalog/N pagination.
+	LayoutPlain Layout = "plain"
+)
+
+type Product struct {
+	Slug string
+	Name string
+	// URL is the canonical product URL which is not necessarily the one
+	// listing pages link to.
+	URL string
+}
+
+type Faults struct {
+	// Latency delays every response.
+	Latency time.Duration
+	// TooManyRequests is the number of times each listing and product page
+	// responds with 429 before succeeding.
+	TooManyRequests int
+	// ServerErrors is the number of times each listing and product page
+	// responds with 500 after any 429s and before succeeding.
+	ServerErrors int
+	// BrokenLinks is the number of links to missing products on each
+	// collection page.
+	BrokenLinks int
+}
+
+func NewShop(opts ...Option) *Shop {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	s := &Shop{
+		cfg:      cfg,
+		requests: make(map[string]int),
+		lock:     &sync.Mutex{},
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+type Shop struct {
+	cfg      Config
+	server   *httptest.Server
+	requests map[string]int
+	lock     *sync.Mutex
+}
+
+func (s *Shop) URL() string {
+	return s.server.URL
+}
+
+func (s *Shop) Layout() Layout {
+	return s.cfg.Layout
+}
+
+func (s *Shop) Close() {
+	s.server.Close()
+}
+
+func (s *Shop) CollectionURL() string {
+	return s.publicURL() + s.collectionPath()
+}
+
+func (s *Shop) ProductPathPrefix() string {
+	switch s.cfg.Layout {
+	case LayoutWooCommerce:
+		return "/product/"
+	case LayoutPlain:
+		return "/item/"
+	default:
+		return s.collectionPath() + "/products/"
+	}
+}
+
+// URLFilters match every page a scraper of the shop needs to visit.
+func (s *Shop) URLFilters() []*regexp.Regexp {
+	host := regexp.QuoteMeta(s.publicURL())
+
+	filters := []*regexp.Regexp{regexp.MustCompile(host + regexp.QuoteMeta(s.collectionPath()) + `.*`)}
+	if s.cfg.Layout != LayoutShopify {
+		filters = append(filters, regexp.MustCompile(host+regexp.QuoteMeta(s.ProductPathPrefix())+`.*`))
+	}
+
+	return filters
+}
+
+func (s *Shop) Products() []Product {
+	products := make([]Product, 0, s.cfg.Products)
+	for i := range s.cfg.Products {
+		products = append(products, s.product(i))
+	}
+
+	return products
+}
+
+// Requests returns the number of requests received for the given path
+// including any query, e.g. as returned by PagePath.
+func (s *Shop) Requests(uri string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.requests[uri]
+}
+
+// PagePath returns the path and query of the given listing page.
+func (s *Shop) PagePath(page int) string {
+	return s.pagePath(page)
+}
+
+func (s *Shop) product(i int) Product {
+	slug := fmt.Sprintf("pen-%03d", i+1)
+
+	url := s.publicURL() + s.ProductPathPrefix() + slug
+	if s.cfg.Layout == LayoutShopify {
+		url = s.publicURL() + "/products/" + slug
+	}
+
+	return Product{
+		Slug: slug,
+		Name: fmt.Sprintf("Pen %d", i+1),
+		URL:  url,
+	}
+}
+
+// productPath is the path listing pages link to for a product.
+func (s *Shop) productPath(slug string) string {
+	if s.cfg.Layout == LayoutWooCommerce {
+		return s.ProductPathPrefix() + slug + "/"
+	}
+
+	return s.ProductPathPrefix() + slug
+}
+
+func (s *Shop) collectionPath() string {
+	return s.cfg.CollectionPath
+}
+
+func (s *Shop) pagePath(page int) string {
+	if page == 1 {
+		return s.collectionPath()
+	}
+
+	switch s.cfg.Layout {
+	case LayoutWooCommerce:
+		return fmt.Sprintf("%spage/%d/", s.collectionPath(), page)
+	case LayoutPlain:
+		return fmt.Sprintf("%s/%d", s.collectionPath(), page)
+	default:
+		return fmt.Sprintf("%s?page=%d", s.collectionPath(), page)
+	}
+}
+
+// href renders a path the way the layout links to it.
+func (s *Shop) href(path string) string {
+	if s.cfg.Layout == LayoutWooCommerce {
+		return s.publicURL() + path
+	}
+
+	return path
+}
+
+// publicURL is the URL absolute links and product URLs are rendered with.
+func (s *Shop) publicURL() string {
+	if s.cfg.PublicURL != "" {
+		return s.cfg.PublicURL
+	}
+
+	return s.server.URL
+}
+
+func (s *Shop) pages() int {
+	return max(1, (s.cfg.Products+s.cfg.PageSize-1)/s.cfg.PageSize)
+}
+
+func (s *Shop) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	attempt := s.count(r.URL.RequestURI())
+
+	if s.cfg.Faults.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.cfg.Faults.Latency):
+		}
+	}
+
+	if r.URL.Path == "/robots.txt" {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /cart\n")
+
+		return
+	}
+
+	if page, ok := s.parsePage(r); ok {
+		s.servePage(w, page, attempt)
+
+		return
+	}
+
+	if slug, ok := strings.CutPrefix(r.URL.Path, s.ProductPathPrefix()); ok {
+		s.serveProduct(w, strings.TrimSuffix(slug, "/"), attempt)
+
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func (s *Shop) count(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests[path]++
+
+	return s.requests[path]
+}
+
+func (s *Shop) parsePage(r *http.Request) (int, bool) {
+	collection := s.collectionPath()
+
+	var raw string
+
+	switch s.cfg.Layout {
+	case LayoutWooCommerce:
+		// the first page is served with and without a trailing slash
+		rest, ok := strings.CutPrefix(r.URL.Path+"/", collection)
+		if !ok {
+			return 0, false
+		}
+		if rest == "" || rest == "/" {
+			return 1, true
+		}
+
+		raw, ok = strings.CutPrefix(strings.Trim(rest, "/"), "page/")
+		if !ok {
+			return 0, false
+		}
+	case LayoutPlain:
+		if r.URL.Path == collection {
+			return 1, true
+		}
+
+		var ok bool
+		if raw, ok = strings.CutPrefix(r.URL.Path, collection+"/"); !ok {
+			return 0, false
+		}
+	default:
+		if r.URL.Path != collection {
+			return 0, false
+		}
+
+		raw = r.URL.Query().Get("page")
+		if raw == "" {
+			return 1, true
+		}
+	}
+
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 1 {
+		return 0, false
+	}
+
+	return page, true
+}
+
+type link struct {
+	HREF  string
+	Text  string
+	Rel   string
+	Class string
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+  <head><title>{{ .Title }}</title></head>
+  <body>
+    <nav><a href="/">Home</a> <a href="/cart">Cart</a></nav>
+    <ul class="products">
+{{- range .Products }}
+      <li><a href="{{ .HREF }}">{{ .Text }}</a></li>
+{{- end }}
+    </ul>
+    <nav class="pagination">
+{{- range .Pagination }}
+      <a href="{{ .HREF }}"{{ with .Rel }} rel="{{ . }}"{{ end }}{{ with .Class }} class="{{ . }}"{{ end }}>{{ .Text }}</a>
+{{- end }}
+    </nav>
+  </body>
+</html>
+`))
+
+func (s *Shop) servePage(w http.ResponseWriter, page, attempt int) {
+	if s.fault(w, attempt) {
+		return
+	}
+
+	if page > s.pages() {
+		// Shopify and friends render an empty listing past the last page
+		s.render(w, fmt.Sprintf("Pens - Page %d", page), nil, nil)
+
+		return
+	}
+
+	var products []link
+
+	start := (page - 1) * s.cfg.PageSize
+	for i := start; i < min(start+s.cfg.PageSize, s.cfg.Products); i++ {
+		p := s.product(i)
+
+		products = append(products, link{HREF: s.href(s.productPath(p.Slug)), Text: p.Name})
+	}
+
+	for i := range s.cfg.Faults.BrokenLinks {
+		products = append(products, link{
+			HREF: s.href(fmt.Sprintf("%smissing-%d-%d", s.ProductPathPrefix(), page, i+1)),
+			Text: "Sold out",
+		})
+	}
+
+	var pagination []link
+	if page > 1 {
+		pagination = append(pagination, link{HREF: s.href(s.pagePath(page - 1)), Text: "Previous", Rel: "prev", Class: s.pageClass("prev")})
+	}
+	if page < s.pages() {
+		pagination = append(pagination, link{HREF: s.href(s.pagePath(page + 1)), Text: "Next", Rel: "next", Class: s.pageClass("next")})
+	}
+
+	s.render(w, fmt.Sprintf("Pens - Page %d", page), products, pagination)
+}
+
+// pageClass mirrors the classes WooCommerce themes put on pagination links.
+func (s *Shop) pageClass(rel string) string {
+	if s.cfg.Layout != LayoutWooCommerce {
+		return ""
+	}
+
+	return rel + " page-numbers"
+}
+
+func (s *Shop) serveProduct(w http.ResponseWriter, slug string, attempt int) {
+	var found bool
+	for i := range s.cfg.Products {
+		if s.product(i).Slug == slug {
+			found = true
+
+			break
+		}
+	}
+
+	if !found {
+		http.Error(w, "product not found", http.StatusNotFound)
+
+		return
+	}
+
+	if s.fault(w, attempt) {
+		return
+	}
+
+	s.render(w, slug, nil, []link{{HREF: s.href(s.collectionPath()), Text: "Back to pens"}})
+}
+
+// fault responds with the configured error for the given attempt at a page
+// and reports whether it did.
+func (s *Shop) fault(w http.ResponseWriter, attempt int) bool {
+	switch faults := s.cfg.Faults; {
+	case attempt <= faults.TooManyRequests:
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+
+		return true
+	case attempt <= faults.TooManyRequests+faults.ServerErrors:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Shop) render(w http.ResponseWriter, title string, products, pagination []link) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := pageTemplate.Execute(w, struct {
+		Title      string
+		Products   []link
+		Pagination []link
+	}{
+		Title:      title,
+		Products:   products,
+		Pagination: pagination,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type Config struct {
+	Layout Layout
+	// PublicURL replaces the URL of the server in rendered links and
+	// product URLs for shops served behind another host.
+	PublicURL string
+	// CollectionPath of the first listing page defaults to one typical of
+	// the layout. WooCommerce collection paths end with a slash.
+	CollectionPath string
+	Products       int
+	PageSize       int
+	Faults         Faults
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureShop(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Layout == "" {
+		c.Layout = LayoutShopify
+	}
+	if c.Products < 0 {
+		c.Products = 0
+	}
+	if c.PageSize < 1 {
+		c.PageSize = 24
+	}
+	if c.CollectionPath == "" {
+		switch c.Layout {
+		case LayoutWooCommerce:
+			c.CollectionPath = "/product-category/pens/"
+		case LayoutPlain:
+			c.CollectionPath = "/catalog"
+		default:
+			c.CollectionPath = "/collections/pens"
+		}
+	}
+}
+
+type Option interface {
+	ConfigureShop(*Config)
+}
+
+type WithLayout Layout
+
+func (w WithLayout) ConfigureShop(c *Config) {
+	c.Layout = Layout(w)
+}
+
+type WithPublicURL string
+
+func (w WithPublicURL) ConfigureShop(c *Config) {
+	c.PublicURL = string(w)
+}
+
+type WithCollectionPath string
+
+func (w WithCollectionPath) ConfigureShop(c *Config) {
+	c.CollectionPath = string(w)
+}
+
+type WithProducts int
+
+func (w WithProducts) ConfigureShop(c *Config) {
+	c.Products = int(w)
+}
+
+type WithPageSize int
+
+func (w WithPageSize) ConfigureShop(c *Config) {
+	c.PageSize = int(w)
+}
+
+type WithFaults Faults
+
+func (w WithFaults) ConfigureShop(c *Config) {
+	c.Faults = Faults(w)
+}
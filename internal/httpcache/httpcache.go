@@ -0,0 +1,495 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrDirRequired = errors.New("cache directory is required")
+
+const (
+	HeaderCacheStatus = "X-Cache"
+
+	StatusHit         = "hit"
+	StatusRevalidated = "revalidated"
+	StatusMiss        = "miss"
+)
+
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "pen-finder", "http"), nil
+}
+
+func NewTransport(opts ...Option) (*Transport, error) {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	if cfg.Dir == "" {
+		return nil, ErrDirRequired
+	}
+
+	t := &Transport{
+		cfg:   cfg,
+		lock:  &sync.Mutex{},
+		files: make(map[string]cachedFile),
+	}
+
+	if err := t.scan(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Transport keeps the size and last use of its entries in memory so that
+// storing does not need to scan the cache directory. Entries written by
+// other processes sharing the directory are only noticed on startup.
+type Transport struct {
+	cfg   Config
+	lock  *sync.Mutex
+	files map[string]cachedFile
+	size  int64
+}
+
+type cachedFile struct {
+	size int64
+	used time.Time
+}
+
+type entry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"storedAt"`
+}
+
+func (e entry) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(HeaderCacheStatus, status)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheableRequest(req) {
+		return t.cfg.Transport.RoundTrip(req)
+	}
+
+	path := t.path(req)
+
+	cached, ok := t.load(path)
+	if ok && fresh(cached) {
+		t.touch(path)
+		t.observe(StatusHit)
+
+		return cached.response(req, StatusHit), nil
+	}
+
+	if ok {
+		conditional := req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+
+		req = conditional
+	}
+
+	res, err := t.cfg.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+
+		for _, key := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if vals := res.Header.Values(key); len(vals) > 0 {
+				cached.Header[key] = vals
+			}
+		}
+
+		cached.StoredAt = time.Now()
+
+		// the revalidated entry is still valid even if it cannot be stored
+		if err := t.store(path, cached); err != nil {
+			t.cfg.Logger.Error(err, "storing revalidated cache entry", "url", req.URL.String())
+		}
+
+		t.observe(StatusRevalidated)
+
+		return cached.response(req, StatusRevalidated), nil
+	}
+
+	t.observe(StatusMiss)
+	res.Header.Set(HeaderCacheStatus, StatusMiss)
+
+	if res.StatusCode != http.StatusOK || !storable(res.Header) {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	header.Del(HeaderCacheStatus)
+
+	if err := t.store(path, entry{
+		Status:   res.StatusCode,
+		Header:   header,
+		Body:     body,
+		StoredAt: time.Now(),
+	}); err != nil {
+		t.cfg.Logger.Error(err, "storing cache entry", "url", req.URL.String())
+	}
+
+	return res, nil
+}
+
+func (t *Transport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String()))
+
+	return filepath.Join(t.cfg.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *Transport) load(path string) (entry, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry{}, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		// corrupt entries are simply refetched and overwritten
+		return entry{}, false
+	}
+
+	return e, true
+}
+
+func (t *Transport) store(path string, e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding cache entry: %w", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := os.MkdirAll(t.cfg.Dir, 0o750); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(t.cfg.Dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("creating cache entry: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("closing cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("storing cache entry: %w", err)
+	}
+
+	t.track(path, int64(len(data)), time.Now())
+
+	return t.evict()
+}
+
+func (t *Transport) touch(path string) {
+	now := time.Now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if f, ok := t.files[path]; ok {
+		f.used = now
+		t.files[path] = f
+	}
+
+	// recency drives eviction, so failing to record it only makes eviction less precise
+	_ = os.Chtimes(path, now, now)
+}
+
+// scan indexes the entries already in the cache directory.
+func (t *Transport) scan() error {
+	dirEntries, err := os.ReadDir(t.cfg.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading cache directory: %w", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".json") {
+			continue
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+
+		t.track(filepath.Join(t.cfg.Dir, de.Name()), info.Size(), info.ModTime())
+	}
+
+	return t.evict()
+}
+
+// track records an entry of the given size replacing any previous one at
+// path. Callers must hold the lock.
+func (t *Transport) track(path string, size int64, used time.Time) {
+	t.size += size - t.files[path].size
+	t.files[path] = cachedFile{size: size, used: used}
+}
+
+// evict removes the least recently used entries until the cache fits within
+// its maximum size. Callers must hold the lock.
+func (t *Transport) evict() error {
+	if t.size <= t.cfg.MaxSize {
+		return nil
+	}
+
+	paths := make([]string, 0, len(t.files))
+	for path := range t.files {
+		paths = append(paths, path)
+	}
+
+	slices.SortFunc(paths, func(a, b string) int {
+		return t.files[a].used.Compare(t.files[b].used)
+	})
+
+	for _, path := range paths {
+		if t.size <= t.cfg.MaxSize {
+			break
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("evicting cache entry: %w", err)
+		}
+
+		t.size -= t.files[path].size
+		delete(t.files, path)
+	}
+
+	return nil
+}
+
+func (t *Transport) observe(status string) {
+	if t.cfg.Metrics == nil {
+		return
+	}
+
+	t.cfg.Metrics.requests.WithLabelValues(t.cfg.Name, status).Inc()
+}
+
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	if req.Header.Get("Range") != "" || req.Header.Get("Authorization") != "" {
+		return false
+	}
+
+	_, noStore := cacheControl(req.Header)["no-store"]
+
+	return !noStore
+}
+
+func storable(header http.Header) bool {
+	directives := cacheControl(header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != "" || maxAge(directives) > 0
+}
+
+func fresh(e entry) bool {
+	directives := cacheControl(e.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+
+	return time.Since(e.StoredAt) < maxAge(directives)
+}
+
+func maxAge(directives map[string]string) time.Duration {
+	seconds, err := strconv.Atoi(directives["max-age"])
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+
+	for _, val := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(val, ",") {
+			key, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if key == "" {
+				continue
+			}
+
+			directives[strings.ToLower(key)] = strings.Trim(arg, `"`)
+		}
+	}
+
+	return directives
+}
+
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_http_cache_requests_total",
+		Help: "Requests served by the scraper HTTP cache by outcome.",
+	}, []string{"source", "result"})
+
+	if err := registerer.Register(requests); err != nil {
+		return nil, err
+	}
+
+	return &Metrics{
+		requests: requests,
+	}, nil
+}
+
+type Metrics struct {
+	requests *prometheus.CounterVec
+}
+
+type Config struct {
+	Dir       string
+	MaxSize   int64
+	Name      string
+	Transport http.RoundTripper
+	Metrics   *Metrics
+	Logger    logr.Logger
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureTransport(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+	if c.Logger.GetSink() == nil {
+		c.Logger = logr.Discard()
+	}
+}
+
+const DefaultMaxSize = 100 << 20
+
+type Option interface {
+	ConfigureTransport(*Config)
+}
+
+type WithDir string
+
+func (w WithDir) ConfigureTransport(c *Config) {
+	c.Dir = string(w)
+}
+
+type WithMaxSize int64
+
+func (w WithMaxSize) ConfigureTransport(c *Config) {
+	c.MaxSize = int64(w)
+}
+
+type WithName string
+
+func (w WithName) ConfigureTransport(c *Config) {
+	c.Name = string(w)
+}
+
+type WithTransport struct {
+	Transport http.RoundTripper
+}
+
+func (w WithTransport) ConfigureTransport(c *Config) {
+	c.Transport = w.Transport
+}
+
+type WithMetrics struct {
+	Metrics *Metrics
+}
+
+func (w WithMetrics) ConfigureTransport(c *Config) {
+	c.Metrics = w.Metrics
+}
+
+type WithLogger struct {
+	Logger logr.Logger
+}
+
+func (w WithLogger) ConfigureTransport(c *Config) {
+	c.Logger = w.Logger
+}
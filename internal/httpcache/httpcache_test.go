@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	var requests, notModified int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+		case "/modified":
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Header.Get("If-Modified-Since") != "" {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("ETag", `"v1"`)
+		}
+
+		fmt.Fprint(w, "page "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	require.NoError(t, err)
+
+	transport, err := NewTransport(WithDir(t.TempDir()), WithName("shop"), WithMetrics{Metrics: metrics})
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: transport}
+
+	get := func(path string) (string, string) {
+		t.Helper()
+
+		res, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		return res.Header.Get(HeaderCacheStatus), string(body)
+	}
+
+	for _, tc := range []struct {
+		path     string
+		statuses []string
+		requests int
+	}{
+		{path: "/fresh", statuses: []string{StatusMiss, StatusHit}, requests: 1},
+		{path: "/etag", statuses: []string{StatusMiss, StatusRevalidated}, requests: 2},
+		{path: "/modified", statuses: []string{StatusMiss, StatusRevalidated}, requests: 2},
+		{path: "/no-store", statuses: []string{StatusMiss, StatusMiss}, requests: 2},
+	} {
+		requests = 0
+
+		for i, expected := range tc.statuses {
+			status, body := get(tc.path)
+			assert.Equal(t, expected, status, "%s request %d", tc.path, i)
+			assert.Equal(t, "page "+tc.path, body)
+		}
+
+		assert.Equal(t, tc.requests, requests, tc.path)
+	}
+
+	assert.Equal(t, 2, notModified)
+	assert.Equal(t, map[string]float64{StatusHit: 1, StatusRevalidated: 2, StatusMiss: 5}, gatherResults(t, registry))
+}
+
+func TestTransportEviction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+
+		fmt.Fprint(w, strings.Repeat("x", 1000))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	transport, err := NewTransport(WithDir(dir), WithMaxSize(4000))
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: transport}
+
+	for i := range 10 {
+		res, err := client.Get(fmt.Sprintf("%s/page/%d", srv.URL, i))
+		require.NoError(t, err)
+		res.Body.Close()
+
+		// distinct modification times keep the eviction order deterministic
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		require.NoError(t, err)
+
+		total += info.Size()
+	}
+
+	assert.LessOrEqual(t, total, int64(4000))
+	assert.NotEmpty(t, entries)
+
+	res, err := client.Get(srv.URL + "/page/9")
+	require.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, StatusHit, res.Header.Get(HeaderCacheStatus), "the most recent entry survives eviction")
+}
+
+func TestTransportEvictsExistingEntries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+
+		fmt.Fprint(w, strings.Repeat("x", 1000))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	previous, err := NewTransport(WithDir(dir))
+	require.NoError(t, err)
+
+	for i := range 5 {
+		res, err := (&http.Client{Transport: previous}).Get(fmt.Sprintf("%s/page/%d", srv.URL, i))
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	_, err = NewTransport(WithDir(dir), WithMaxSize(2500))
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "entries from earlier runs count towards the maximum size")
+}
+
+func TestTransportStoreFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+
+		fmt.Fprint(w, "page")
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	transport, err := NewTransport(WithDir(dir))
+	require.NoError(t, err)
+
+	// a file in place of the cache directory makes every store fail
+	require.NoError(t, os.WriteFile(dir, nil, 0o600))
+
+	res, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "page", string(body), "responses are served even if they cannot be cached")
+}
+
+func gatherResults(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	results := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "result" {
+					results[label.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type HealthReporter interface {
+	Health() []scraper.SourceHealth
+}
+
+func NewCircuitCollector(reporter HealthReporter) *CircuitCollector {
+	return &CircuitCollector{
+		reporter: reporter,
+		state: prometheus.NewDesc(
+			"scraper_circuit_state",
+			"Circuit breaker state of each scraper source; the series for the current state is 1.",
+			[]string{"source", "state"}, nil,
+		),
+		failures: prometheus.NewDesc(
+			"scraper_consecutive_failures",
+			"Number of consecutive failed runs of each scraper source.",
+			[]string{"source"}, nil,
+		),
+	}
+}
+
+type CircuitCollector struct {
+	reporter HealthReporter
+	state    *prometheus.Desc
+	failures *prometheus.Desc
+}
+
+func (c *CircuitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.failures
+}
+
+func (c *CircuitCollector) Collect(ch chan<- prometheus.Metric) {
+	states := []scraper.CircuitState{scraper.CircuitClosed, scraper.CircuitHalfOpen, scraper.CircuitOpen}
+
+	for _, health := range c.reporter.Health() {
+		for _, state := range states {
+			var val float64
+			if health.State == state {
+				val = 1
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, val, health.Source, string(state))
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.failures, prometheus.GaugeValue, float64(health.ConsecutiveFailures), health.Source)
+	}
+}
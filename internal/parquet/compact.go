@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol types used by the Parquet metadata.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol in which
+// field IDs are written as deltas from the previous field of the struct.
+type compactWriter struct {
+	buf    bytes.Buffer
+	last   int16
+	parent []int16
+}
+
+func (c *compactWriter) field(typ byte, id int16) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.varint(zigzag(int64(id)))
+	}
+
+	c.last = id
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.field(compactI32, id)
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.field(compactI64, id)
+	c.varint(zigzag(v))
+}
+
+func (c *compactWriter) binary(id int16, v string) {
+	c.field(compactBinary, id)
+	c.str(v)
+}
+
+// str writes a string list element or the value of a binary field.
+func (c *compactWriter) str(v string) {
+	c.varint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+// list writes the header of a list field whose size elements follow.
+func (c *compactWriter) list(id int16, elem byte, size int) {
+	c.field(compactList, id)
+
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		c.buf.WriteByte(0xf0 | elem)
+		c.varint(uint64(size))
+	}
+}
+
+func (c *compactWriter) beginStruct(id int16) {
+	c.field(compactStruct, id)
+	c.beginElement()
+}
+
+// beginElement starts a struct within a list which has no field header.
+func (c *compactWriter) beginElement() {
+	c.parent = append(c.parent, c.last)
+	c.last = 0
+}
+
+func (c *compactWriter) endStruct() {
+	c.stop()
+
+	c.last = c.parent[len(c.parent)-1]
+	c.parent = c.parent[:len(c.parent)-1]
+}
+
+func (c *compactWriter) stop() {
+	c.buf.WriteByte(0)
+}
+
+func (c *compactWriter) varint(v uint64) {
+	c.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,241 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package parquet writes flat tables as Apache Parquet files. Only what
+// exports need is supported: a single row group of required columns which
+// are plain encoded and uncompressed.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeDouble
+	TypeInt64
+	// TypeTimestamp is stored as milliseconds since the Unix epoch in UTC.
+	TypeTimestamp
+)
+
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Write encodes rows whose values are a string, float64, int64 or
+// time.Time matching the type of their column.
+func Write(w io.Writer, columns []Column, rows [][]any) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(magic)
+
+	chunks := make([]columnChunk, 0, len(columns))
+
+	if len(rows) > 0 {
+		for i, col := range columns {
+			values, err := encodeValues(col, i, rows)
+			if err != nil {
+				return err
+			}
+
+			header := pageHeader(len(rows), len(values))
+			chunks = append(chunks, columnChunk{
+				offset: int64(buf.Len()),
+				size:   int64(len(header) + len(values)),
+			})
+
+			buf.Write(header)
+			buf.Write(values)
+		}
+	}
+
+	footer := fileMetaData(columns, int64(len(rows)), chunks)
+
+	buf.Write(footer)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	buf.WriteString(magic)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writing parquet: %w", err)
+	}
+
+	return nil
+}
+
+const magic = "PAR1"
+
+// physical types, converted types and enums of the Parquet format
+const (
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	pageTypeData       = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+)
+
+func (t Type) physical() int32 {
+	switch t {
+	case TypeDouble:
+		return physicalDouble
+	case TypeInt64, TypeTimestamp:
+		return physicalInt64
+	default:
+		return physicalByteArray
+	}
+}
+
+func (t Type) converted() (int32, bool) {
+	switch t {
+	case TypeString:
+		return convertedUTF8, true
+	case TypeTimestamp:
+		return convertedTimestampMillis, true
+	default:
+		return 0, false
+	}
+}
+
+func encodeValues(col Column, idx int, rows [][]any) ([]byte, error) {
+	var out []byte
+
+	for n, row := range rows {
+		if idx >= len(row) {
+			return nil, fmt.Errorf("row %d: missing column %s", n, col.Name)
+		}
+
+		val := row[idx]
+		ok := false
+
+		switch col.Type {
+		case TypeString:
+			var s string
+			if s, ok = val.(string); ok {
+				out = binary.LittleEndian.AppendUint32(out, uint32(len(s)))
+				out = append(out, s...)
+			}
+		case TypeDouble:
+			var f float64
+			if f, ok = val.(float64); ok {
+				out = binary.LittleEndian.AppendUint64(out, math.Float64bits(f))
+			}
+		case TypeInt64:
+			var i int64
+			if i, ok = val.(int64); ok {
+				out = binary.LittleEndian.AppendUint64(out, uint64(i))
+			}
+		case TypeTimestamp:
+			var t time.Time
+			if t, ok = val.(time.Time); ok {
+				out = binary.LittleEndian.AppendUint64(out, uint64(t.UnixMilli()))
+			}
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("row %d: unexpected %T for column %s", n, val, col.Name)
+		}
+	}
+
+	return out, nil
+}
+
+type columnChunk struct {
+	offset int64
+	size   int64
+}
+
+func pageHeader(numValues, size int) []byte {
+	var c compactWriter
+
+	c.i32(1, pageTypeData)
+	c.i32(2, int32(size))
+	c.i32(3, int32(size))
+	c.beginStruct(5)
+	c.i32(1, int32(numValues))
+	c.i32(2, encodingPlain)
+	c.i32(3, encodingRLE)
+	c.i32(4, encodingRLE)
+	c.endStruct()
+	c.stop()
+
+	return c.buf.Bytes()
+}
+
+func fileMetaData(columns []Column, numRows int64, chunks []columnChunk) []byte {
+	var c compactWriter
+
+	c.i32(1, 1)
+
+	c.list(2, compactStruct, len(columns)+1)
+	c.beginElement()
+	c.binary(4, "schema")
+	c.i32(5, int32(len(columns)))
+	c.endStruct()
+
+	for _, col := range columns {
+		c.beginElement()
+		c.i32(1, col.Type.physical())
+		c.i32(3, repetitionRequired)
+		c.binary(4, col.Name)
+		if converted, ok := col.Type.converted(); ok {
+			c.i32(6, converted)
+		}
+		c.endStruct()
+	}
+
+	c.i64(3, numRows)
+
+	if len(chunks) > 0 {
+		var total int64
+
+		c.list(4, compactStruct, 1)
+		c.beginElement()
+		c.list(1, compactStruct, len(chunks))
+
+		for i, chunk := range chunks {
+			total += chunk.size
+
+			c.beginElement()
+			c.i64(2, chunk.offset)
+			c.beginStruct(3)
+			c.i32(1, columns[i].Type.physical())
+			c.list(2, compactI32, 1)
+			c.varint(zigzag(encodingPlain))
+			c.list(3, compactBinary, 1)
+			c.str(columns[i].Name)
+			c.i32(4, codecUncompressed)
+			c.i64(5, numRows)
+			c.i64(6, chunk.size)
+			c.i64(7, chunk.size)
+			c.i64(9, chunk.offset)
+			c.endStruct()
+			c.endStruct()
+		}
+
+		c.i64(2, total)
+		c.i64(3, numRows)
+		c.endStruct()
+	} else {
+		c.list(4, compactStruct, 0)
+	}
+
+	c.binary(6, "pen-finder")
+	c.stop()
+
+	return c.buf.Bytes()
+}
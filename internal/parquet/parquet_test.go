@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	columns := []Column{
+		{Name: "name", Type: TypeString},
+		{Name: "price", Type: TypeDouble},
+		{Name: "times_seen", Type: TypeInt64},
+		{Name: "first_seen", Type: TypeTimestamp},
+	}
+
+	day := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	rows := [][]any{
+		{"pelikan-m800", 425.5, int64(2), day},
+		{"sailor-1911", 0.0, int64(1), day.Add(time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, columns, rows))
+
+	data := buf.Bytes()
+	require.Equal(t, magic, string(data[:4]))
+	require.Equal(t, magic, string(data[len(data)-4:]))
+
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&compactReader{data: data[len(data)-8-footerLen : len(data)-8]}).readStruct()
+
+	assert.Equal(t, int64(2), meta[3], "num_rows")
+
+	schema := meta[2].([]any)
+	require.Len(t, schema, len(columns)+1)
+	assert.Equal(t, int64(len(columns)), schema[0].(map[int16]any)[5])
+
+	for i, col := range columns {
+		assert.Equal(t, col.Name, schema[i+1].(map[int16]any)[4])
+	}
+
+	chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+	require.Len(t, chunks, len(columns))
+
+	for i, col := range columns {
+		colMeta := chunks[i].(map[int16]any)[3].(map[int16]any)
+		assert.Equal(t, []any{col.Name}, colMeta[3])
+
+		page := &compactReader{data: data, pos: int(colMeta[9].(int64))}
+		header := page.readStruct()
+		assert.Equal(t, colMeta[6], int64(page.pos-int(colMeta[9].(int64)))+header[2].(int64), "chunk size includes the page header")
+		assert.Equal(t, int64(len(rows)), header[5].(map[int16]any)[1])
+
+		values := data[page.pos : page.pos+int(header[2].(int64))]
+		for _, row := range rows {
+			switch col.Type {
+			case TypeString:
+				n := binary.LittleEndian.Uint32(values)
+				assert.Equal(t, row[i], string(values[4:4+n]))
+				values = values[4+n:]
+			case TypeDouble:
+				assert.Equal(t, row[i], math.Float64frombits(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case TypeInt64:
+				assert.Equal(t, row[i], int64(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case TypeTimestamp:
+				assert.Equal(t, row[i].(time.Time).UnixMilli(), int64(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			}
+		}
+
+		assert.Empty(t, values)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []Column{{Name: "name", Type: TypeString}}, nil))
+
+	data := buf.Bytes()
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&compactReader{data: data[len(data)-8-footerLen : len(data)-8]}).readStruct()
+
+	assert.Equal(t, int64(0), meta[3])
+	assert.Empty(t, meta[4])
+}
+
+func TestWriteMismatchedValue(t *testing.T) {
+	assert.Error(t, Write(&bytes.Buffer{}, []Column{{Name: "price", Type: TypeDouble}}, [][]any{{"free"}}))
+	assert.Error(t, Write(&bytes.Buffer{}, []Column{{Name: "price", Type: TypeDouble}}, [][]any{{}}))
+}
+
+// compactReader decodes the subset of the Thrift compact protocol the
+// writer produces into maps keyed by field ID.
+type compactReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *compactReader) readStruct() map[int16]any {
+	fields := make(map[int16]any)
+
+	var last int16
+
+	for {
+		b := r.data[r.pos]
+		r.pos++
+
+		if b == 0 {
+			return fields
+		}
+
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.signed())
+		}
+
+		last = id
+		fields[id] = r.value(b & 0x0f)
+	}
+}
+
+func (r *compactReader) value(typ byte) any {
+	switch typ {
+	case compactI32, compactI64:
+		return r.signed()
+	case compactBinary:
+		n := int(r.varint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+
+		return s
+	case compactList:
+		h := r.data[r.pos]
+		r.pos++
+
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+
+		list := make([]any, 0, size)
+		for range size {
+			list = append(list, r.value(h&0x0f))
+		}
+
+		return list
+	case compactStruct:
+		return r.readStruct()
+	default:
+		panic("unexpected compact type")
+	}
+}
+
+func (r *compactReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+
+	return v
+}
+
+func (r *compactReader) signed() int64 {
+	v := r.varint()
+
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,396 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+)
+
+var ErrPathRequired = errors.New("path is required")
+
+func NewRecorder(opts ...Option) (*Recorder, error) {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	if cfg.Path == "" {
+		return nil, ErrPathRequired
+	}
+
+	switch cfg.Format {
+	case FormatJSONLines, FormatCSV:
+	default:
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+
+	r := &Recorder{
+		cfg:  cfg,
+		lock: &sync.Mutex{},
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type Recorder struct {
+	cfg  Config
+	lock *sync.Mutex
+	file *os.File
+	size int64
+	// active counts runs begun but not yet completed
+	active int
+}
+
+func (r *Recorder) RecordProduct(product recorder.Product) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	record := Record{
+		Source:       product.Source,
+		Name:         product.Name,
+		URL:          product.URL,
+		Price:        product.Price,
+		Availability: product.Availability,
+		RecordedAt:   time.Now().UTC(),
+	}
+
+	data, err := r.encode(record)
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+
+	if r.cfg.MaxSize > 0 && r.size > 0 && r.size+int64(len(data)) > r.cfg.MaxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if r.size == 0 && r.cfg.Format == FormatCSV {
+		header, err := encodeCSV(CSVHeader)
+		if err != nil {
+			return fmt.Errorf("encoding header: %w", err)
+		}
+
+		data = append(header, data...)
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing record: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Recorder) BeginRun() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.active++
+}
+
+// CompleteRun rotates the file once no other begun run is still recording
+// so that concurrent runs are never split across rotated files.
+func (r *Recorder) CompleteRun() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.active > 0 {
+		r.active--
+	}
+
+	if !r.cfg.RotatePerRun || r.active > 0 {
+		return nil
+	}
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	return r.rotate()
+}
+
+func (r *Recorder) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	return r.rotate()
+}
+
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func (r *Recorder) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.cfg.Path), 0o755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	file, err := os.OpenFile(r.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", r.cfg.Path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return fmt.Errorf("inspecting %s: %w", r.cfg.Path, err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+
+	return nil
+}
+
+// rotate keeps the recorder writing when rotation fails: a failed rename
+// appends to the current file again while a failed compression leaves the
+// rotated file uncompressed.
+func (r *Recorder) rotate() error {
+	if r.size == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	if err := r.file.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing %s: %w", r.cfg.Path, err))
+	}
+
+	r.file = nil
+
+	rotated := availablePath(RotatedPath(r.cfg.Path, time.Now()))
+	if err := rename(r.cfg.Path, rotated); err != nil {
+		return errors.Join(append(errs, fmt.Errorf("rotating %s: %w", r.cfg.Path, err), r.open())...)
+	}
+
+	errs = append(errs, r.open())
+
+	if r.cfg.Gzip {
+		if err := compress(rotated); err != nil {
+			errs = append(errs, fmt.Errorf("compressing %s: %w", rotated, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// rename is replaced in tests to simulate failed rotations.
+var rename = os.Rename
+
+func (r *Recorder) encode(record Record) ([]byte, error) {
+	switch r.cfg.Format {
+	case FormatCSV:
+		return encodeCSV(record.CSV())
+	default:
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(data, '\n'), nil
+	}
+}
+
+func encodeCSV(row []string) ([]byte, error) {
+	var buf strings.Builder
+
+	w := csv.NewWriter(&buf)
+	if err := w.Write(row); err != nil {
+		return nil, err
+	}
+
+	w.Flush()
+
+	return []byte(buf.String()), w.Error()
+}
+
+func RotatedPath(path string, ts time.Time) string {
+	ext := filepath.Ext(path)
+
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), ts.UTC().Format("20060102T150405.000"), ext)
+}
+
+func availablePath(path string) string {
+	ext := filepath.Ext(path)
+	candidate := path
+
+	for i := 1; ; i++ {
+		_, errPlain := os.Stat(candidate)
+		_, errGzip := os.Stat(candidate + ".gz")
+
+		if errors.Is(errPlain, os.ErrNotExist) && errors.Is(errGzip, os.ErrNotExist) {
+			return candidate
+		}
+
+		candidate = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), i, ext)
+	}
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	// a partial archive would be read alongside the uncompressed one
+	discard := func(err error) error {
+		dst.Close()
+		os.Remove(dst.Name())
+
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return discard(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return discard(err)
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+type Record struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	// Price is zero and Availability empty when the source does not show them.
+	Price        float64               `json:"price,omitempty"`
+	Availability recorder.Availability `json:"availability,omitempty"`
+	RecordedAt   time.Time             `json:"recordedAt"`
+}
+
+// CSVHeader appends price and availability to the columns of
+// legacyCSVHeader so that rows of older archives keep their positions.
+var (
+	CSVHeader       = []string{"source", "name", "url", "recorded_at", "price", "availability"}
+	legacyCSVHeader = CSVHeader[:4]
+)
+
+func (r Record) CSV() []string {
+	return []string{r.Source, r.Name, r.URL, r.RecordedAt.Format(time.RFC3339), FormatPrice(r.Price), string(r.Availability)}
+}
+
+// FormatPrice leaves unknown prices empty.
+func FormatPrice(price float64) string {
+	if price == 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+type Format string
+
+const (
+	FormatJSONLines Format = "jsonl"
+	FormatCSV       Format = "csv"
+)
+
+type Config struct {
+	Path         string
+	Format       Format
+	MaxSize      int64
+	RotatePerRun bool
+	Gzip         bool
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureRecorder(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Format == "" {
+		c.Format = FormatJSONLines
+	}
+}
+
+type Option interface {
+	ConfigureRecorder(*Config)
+}
+
+type WithPath string
+
+func (w WithPath) ConfigureRecorder(c *Config) {
+	c.Path = string(w)
+}
+
+type WithFormat Format
+
+func (w WithFormat) ConfigureRecorder(c *Config) {
+	c.Format = Format(w)
+}
+
+type WithMaxSize int64
+
+func (w WithMaxSize) ConfigureRecorder(c *Config) {
+	c.MaxSize = int64(w)
+}
+
+type WithRotatePerRun bool
+
+func (w WithRotatePerRun) ConfigureRecorder(c *Config) {
+	c.RotatePerRun = bool(w)
+}
+
+type WithGzip bool
+
+func (w WithGzip) ConfigureRecorder(c *Config) {
+	c.Gzip = bool(w)
+}
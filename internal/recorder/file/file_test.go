@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderRotatePerRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.jsonl")
+
+	r, err := NewRecorder(WithPath(path), WithRotatePerRun(true), WithGzip(true))
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	product := recorder.Product{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800"}
+
+	require.NoError(t, r.RecordProduct(product))
+	require.NoError(t, r.CompleteRun())
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "products-*.jsonl.gz"))
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+
+	f, err := os.Open(rotated[0])
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	scanner := bufio.NewScanner(zr)
+	require.True(t, scanner.Scan())
+
+	var record Record
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+	assert.Equal(t, product.URL, record.URL)
+	assert.False(t, scanner.Scan())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestRecorderRotatePerRunWaitsForActiveRuns(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.jsonl")
+
+	r, err := NewRecorder(WithPath(path), WithRotatePerRun(true))
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	rotated := func() []string {
+		matches, err := filepath.Glob(filepath.Join(dir, "products-*.jsonl"))
+		require.NoError(t, err)
+
+		return matches
+	}
+
+	r.BeginRun()
+	r.BeginRun()
+
+	require.NoError(t, r.RecordProduct(recorder.Product{Source: "fph", Name: "sailor-1911", URL: "https://fountainpenhospital.com/products/sailor-1911"}))
+	require.NoError(t, r.CompleteRun())
+	assert.Empty(t, rotated(), "run still in flight")
+
+	require.NoError(t, r.RecordProduct(recorder.Product{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800"}))
+	require.NoError(t, r.CompleteRun())
+	require.Len(t, rotated(), 1)
+
+	data, err := os.ReadFile(rotated()[0])
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")), "both runs are in the rotated file")
+}
+
+func TestRecorderRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.csv")
+
+	r, err := NewRecorder(WithPath(path), WithFormat(FormatCSV), WithMaxSize(1))
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, r.RecordProduct(recorder.Product{Source: "s", Name: name, URL: "https://example.com/" + name}))
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "products-*.csv"))
+	require.NoError(t, err)
+	assert.Len(t, rotated, 2)
+}
+
+func TestRecorderRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.jsonl")
+
+	r, err := NewRecorder(WithPath(path))
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	rename = func(string, string) error { return os.ErrPermission }
+	defer func() { rename = os.Rename }()
+
+	product := recorder.Product{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800"}
+
+	require.NoError(t, r.RecordProduct(product))
+	require.ErrorIs(t, r.Rotate(), os.ErrPermission)
+	require.NoError(t, r.RecordProduct(product), "the recorder keeps writing after a failed rotation")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")), "records are appended to the current file")
+
+	rename = os.Rename
+
+	require.NoError(t, r.Rotate())
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "products-*.jsonl"))
+	require.NoError(t, err)
+	assert.Len(t, rotated, 1)
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+)
+
+// rotatedSuffix matches the timestamp RotatedPath appends along with the
+// counter availablePath adds when rotations collide.
+const rotatedSuffix = `-\d{8}T\d{6}\.\d{3}(\.\d+)?`
+
+// ArchivePaths returns the rotated archives of path oldest first followed by
+// path itself if it exists.
+func ArchivePaths(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	archive, err := regexp.Compile("^" + regexp.QuoteMeta(filepath.Base(base)) + rotatedSuffix + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+	if err != nil {
+		return nil, fmt.Errorf("compiling archive pattern: %w", err)
+	}
+
+	pattern := base + "-*" + ext + "*"
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("globbing %s: %w", pattern, err)
+	}
+
+	var paths []string
+
+	for _, match := range matches {
+		if archive.MatchString(filepath.Base(match)) {
+			paths = append(paths, match)
+		}
+	}
+
+	slices.Sort(paths)
+
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("inspecting %s: %w", path, err)
+	}
+
+	return paths, nil
+}
+
+func ReadRecords(path string, fn func(Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+
+	name := path
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("decompressing %s: %w", path, err)
+		}
+		defer zr.Close()
+
+		src = zr
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	if filepath.Ext(name) == ".csv" {
+		return readCSV(src, fn)
+	}
+
+	return readJSONLines(src, fn)
+}
+
+func readJSONLines(src io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("decoding line %d: %w", line, err)
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readCSV accepts rows with or without the price and availability columns
+// as archives written before they were added lack them.
+func readCSV(src io.Reader, fn func(Record) error) error {
+	r := csv.NewReader(src)
+	r.FieldsPerRecord = -1
+
+	for line := 1; ; line++ {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decoding row: %w", err)
+		}
+
+		if slices.Equal(row, CSVHeader) || slices.Equal(row, legacyCSVHeader) {
+			continue
+		}
+
+		if len(row) != len(CSVHeader) && len(row) != len(legacyCSVHeader) {
+			return fmt.Errorf("decoding row %d: expected %d or %d fields, got %d", line, len(legacyCSVHeader), len(CSVHeader), len(row))
+		}
+
+		recordedAt, err := time.Parse(time.RFC3339, row[3])
+		if err != nil {
+			return fmt.Errorf("parsing recorded_at: %w", err)
+		}
+
+		record := Record{
+			Source:     row[0],
+			Name:       row[1],
+			URL:        row[2],
+			RecordedAt: recordedAt,
+		}
+
+		if len(row) == len(CSVHeader) {
+			if row[4] != "" {
+				if record.Price, err = strconv.ParseFloat(row[4], 64); err != nil {
+					return fmt.Errorf("parsing price: %w", err)
+				}
+			}
+
+			record.Availability = recorder.Availability(row[5])
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
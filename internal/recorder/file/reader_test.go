@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.jsonl")
+
+	for _, name := range []string{
+		"products.jsonl",
+		"products-20240102T030405.000.jsonl",
+		"products-20240102T030405.000.1.jsonl",
+		"products-20240101T030405.000.jsonl.gz",
+		// not archives of products.jsonl
+		"products-backup.jsonl",
+		"products-20240101T030405.000.jsonl.bak",
+		"products-extra-20240101T030405.000.jsonl",
+		"products-20240101T030405.000.csv",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	paths, err := ArchivePaths(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "products-20240101T030405.000.jsonl.gz"),
+		filepath.Join(dir, "products-20240102T030405.000.1.jsonl"),
+		filepath.Join(dir, "products-20240102T030405.000.jsonl"),
+		path,
+	}, paths)
+}
+
+func TestArchivePathsMissing(t *testing.T) {
+	paths, err := ArchivePaths(filepath.Join(t.TempDir(), "products.csv"))
+	require.NoError(t, err)
+
+	assert.Empty(t, paths)
+}
+
+func TestReadRecords(t *testing.T) {
+	products := []recorder.Product{
+		{Source: "truphae", Name: "pelikan-m800", URL: "https://truphaeinc.com/products/pelikan-m800", Price: 425.5, Availability: recorder.AvailabilityInStock},
+		{Source: "fph", Name: "sailor, 1911", URL: "https://fountainpenhospital.com/products/sailor-1911"},
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "jsonl", opts: []Option{WithFormat(FormatJSONLines)}},
+		{name: "csv", opts: []Option{WithFormat(FormatCSV)}},
+		{name: "jsonl gzip", opts: []Option{WithFormat(FormatJSONLines), WithGzip(true)}},
+		{name: "csv gzip", opts: []Option{WithFormat(FormatCSV), WithGzip(true)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg Config
+
+			cfg.Options(tc.opts...)
+
+			path := filepath.Join(t.TempDir(), "products."+string(cfg.Format))
+
+			r, err := NewRecorder(append(tc.opts, WithPath(path))...)
+			require.NoError(t, err)
+
+			defer r.Close()
+
+			for _, p := range products {
+				require.NoError(t, r.RecordProduct(p))
+			}
+
+			require.NoError(t, r.Rotate())
+
+			paths, err := ArchivePaths(path)
+			require.NoError(t, err)
+			require.Len(t, paths, 2)
+
+			var records []Record
+			for _, p := range paths {
+				require.NoError(t, ReadRecords(p, func(r Record) error {
+					records = append(records, r)
+
+					return nil
+				}))
+			}
+
+			require.Len(t, records, len(products))
+
+			for i, p := range products {
+				assert.Equal(t, p.Source, records[i].Source)
+				assert.Equal(t, p.Name, records[i].Name)
+				assert.Equal(t, p.URL, records[i].URL)
+				assert.Equal(t, p.Price, records[i].Price)
+				assert.Equal(t, p.Availability, records[i].Availability)
+				assert.WithinDuration(t, time.Now(), records[i].RecordedAt, time.Minute)
+			}
+		})
+	}
+}
+
+func TestReadRecordsLegacyCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.csv")
+
+	// rows recorded after an upgrade are appended below the legacy header
+	require.NoError(t, os.WriteFile(path, []byte(`source,name,url,recorded_at
+truphae,pelikan-m800,https://truphaeinc.com/products/pelikan-m800,2024-01-01T12:00:00Z
+truphae,pelikan-m800,https://truphaeinc.com/products/pelikan-m800,2024-01-02T12:00:00Z,425.5,in_stock
+`), 0o644))
+
+	var records []Record
+	require.NoError(t, ReadRecords(path, func(r Record) error {
+		records = append(records, r)
+
+		return nil
+	}))
+
+	require.Len(t, records, 2)
+	assert.Zero(t, records[0].Price)
+	assert.Equal(t, recorder.AvailabilityUnknown, records[0].Availability)
+	assert.Equal(t, 425.5, records[1].Price)
+	assert.Equal(t, recorder.AvailabilityInStock, records[1].Availability)
+
+	require.NoError(t, os.WriteFile(path, []byte("truphae,pelikan-m800\n"), 0o644))
+	assert.Error(t, ReadRecords(path, func(Record) error { return nil }), "rows of unknown width are rejected")
+}
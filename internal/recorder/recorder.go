@@ -7,18 +7,43 @@ package recorder
 import (
 	"fmt"
 	"os"
+	"slices"
+	"sync"
+
+	"go.uber.org/multierr"
 )
 
 type Recorder interface {
 	RecordProduct(Product) error
 }
 
+type RunCompleter interface {
+	CompleteRun() error
+}
+
+// RunBeginner is notified when a run which will later be completed through
+// RunCompleter starts recording.
+type RunBeginner interface {
+	BeginRun()
+}
+
 type Product struct {
 	Source string
 	Name   string
 	URL    string
+	// Price is the listed price in the shop's currency or zero if unknown.
+	Price        float64
+	Availability Availability
 }
 
+type Availability string
+
+const (
+	AvailabilityUnknown Availability = ""
+	AvailabilityInStock Availability = "in_stock"
+	AvailabilitySoldOut Availability = "sold_out"
+)
+
 func NewDebugRecorder() *DebugRecorder {
 	return &DebugRecorder{}
 }
@@ -30,3 +55,70 @@ func (r *DebugRecorder) RecordProduct(product Product) error {
 
 	return err
 }
+
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{
+		lock: &sync.Mutex{},
+	}
+}
+
+type MemoryRecorder struct {
+	products []Product
+	lock     *sync.Mutex
+}
+
+func (r *MemoryRecorder) RecordProduct(product Product) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.products = append(r.products, product)
+
+	return nil
+}
+
+func (r *MemoryRecorder) Products() []Product {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return slices.Clone(r.products)
+}
+
+func NewMultiRecorder(recorders ...Recorder) *MultiRecorder {
+	return &MultiRecorder{
+		recorders: recorders,
+	}
+}
+
+type MultiRecorder struct {
+	recorders []Recorder
+}
+
+func (r *MultiRecorder) RecordProduct(product Product) error {
+	var finalErr error
+
+	for _, rec := range r.recorders {
+		multierr.AppendInto(&finalErr, rec.RecordProduct(product))
+	}
+
+	return finalErr
+}
+
+func (r *MultiRecorder) BeginRun() {
+	for _, rec := range r.recorders {
+		if beginner, ok := rec.(RunBeginner); ok {
+			beginner.BeginRun()
+		}
+	}
+}
+
+func (r *MultiRecorder) CompleteRun() error {
+	var finalErr error
+
+	for _, rec := range r.recorders {
+		if completer, ok := rec.(RunCompleter); ok {
+			multierr.AppendInto(&finalErr, completer.CompleteRun())
+		}
+	}
+
+	return finalErr
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package retryafter interprets Retry-After response headers.
+package retryafter
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Parse returns the wait requested by a Retry-After header given either
+// in seconds or as an HTTP date. Missing, invalid and past values yield 0.
+func Parse(raw string) time.Duration {
+	if raw == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(raw); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if at, err := http.ParseTime(raw); err == nil {
+		return max(time.Until(at), 0)
+	}
+
+	return 0
+}
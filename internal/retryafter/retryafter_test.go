@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package retryafter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, 120*time.Second, Parse("120"))
+	assert.Zero(t, Parse(""))
+	assert.Zero(t, Parse("0"))
+	assert.Zero(t, Parse("-5"))
+	assert.Zero(t, Parse("soon"))
+	assert.Zero(t, Parse(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), "past dates do not wait")
+
+	wait := Parse(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Minute, wait, float64(2*time.Second))
+}
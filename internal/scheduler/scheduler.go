@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+)
+
+type RunStarter interface {
+	StartRun(api.PostRunRequest) (uuid.UUID, error)
+}
+
+type Schedule struct {
+	Name     string
+	Interval time.Duration
+	Scrapers []api.Scraper
+}
+
+func (s Schedule) Equal(other Schedule) bool {
+	return s.Name == other.Name && s.Interval == other.Interval && slices.Equal(s.Scrapers, other.Scrapers)
+}
+
+func NewScheduler(opts ...Option) *Scheduler {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &Scheduler{
+		cfg:       cfg,
+		schedules: cfg.Schedules,
+		changed:   make(chan struct{}, 1),
+		lock:      &sync.Mutex{},
+	}
+}
+
+type Scheduler struct {
+	cfg       Config
+	schedules []Schedule
+	changed   chan struct{}
+	lock      *sync.Mutex
+}
+
+func (s *Scheduler) Update(schedules []Schedule) {
+	s.lock.Lock()
+	s.schedules = slices.Clone(schedules)
+	s.lock.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	type running struct {
+		schedule Schedule
+		cancel   context.CancelFunc
+	}
+
+	active := make(map[string]running)
+
+	reconcile := func() {
+		s.lock.Lock()
+		desired := slices.Clone(s.schedules)
+		s.lock.Unlock()
+
+		keep := make(map[string]bool, len(desired))
+
+		for _, schedule := range desired {
+			schedule := schedule
+			keep[schedule.Name] = true
+
+			if r, ok := active[schedule.Name]; ok {
+				if r.schedule.Equal(schedule) {
+					continue
+				}
+
+				r.cancel()
+			}
+
+			schedCtx, cancel := context.WithCancel(ctx)
+			active[schedule.Name] = running{schedule: schedule, cancel: cancel}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				s.runSchedule(schedCtx, schedule)
+			}()
+		}
+
+		for name, r := range active {
+			if !keep[name] {
+				r.cancel()
+				delete(active, name)
+			}
+		}
+	}
+
+	reconcile()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+
+			return nil
+		case <-s.changed:
+			reconcile()
+			s.cfg.Logger.Info("updated schedules", "count", len(active))
+		}
+	}
+}
+
+func (s *Scheduler) runSchedule(ctx context.Context, schedule Schedule) {
+	ticker := time.NewTicker(schedule.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runID, err := s.cfg.Starter.StartRun(api.PostRunRequest{Scrapers: schedule.Scrapers})
+			if err != nil {
+				s.cfg.Logger.Error(err, "starting scheduled run", "schedule", schedule.Name)
+
+				continue
+			}
+
+			s.cfg.Logger.Info("started scheduled run", "schedule", schedule.Name, "runID", runID)
+		}
+	}
+}
+
+type Config struct {
+	Schedules []Schedule
+	Starter   RunStarter
+	Logger    logr.Logger
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureScheduler(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Logger.GetSink() == nil {
+		c.Logger = logr.Discard()
+	}
+}
+
+type Option interface {
+	ConfigureScheduler(*Config)
+}
+
+type WithSchedules []Schedule
+
+func (w WithSchedules) ConfigureScheduler(c *Config) {
+	c.Schedules = append(c.Schedules, w...)
+}
+
+type WithStarter struct {
+	Starter RunStarter
+}
+
+func (w WithStarter) ConfigureScheduler(c *Config) {
+	c.Starter = w.Starter
+}
+
+type WithLogger struct {
+	Logger logr.Logger
+}
+
+func (w WithLogger) ConfigureScheduler(c *Config) {
+	c.Logger = w.Logger
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerUpdate(t *testing.T) {
+	starter := &recordingStarter{lock: &sync.Mutex{}}
+
+	sched := NewScheduler(
+		WithSchedules{
+			{Name: "truphae", Interval: 5 * time.Millisecond, Scrapers: []api.Scraper{api.ScraperTruphae}},
+			{Name: "fph", Interval: 5 * time.Millisecond, Scrapers: []api.Scraper{api.ScraperFPH}},
+		},
+		WithStarter{Starter: starter},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return starter.started(api.ScraperTruphae) && starter.started(api.ScraperFPH)
+	}, time.Second, time.Millisecond, "initial schedules run")
+
+	// remove fph, change truphae and add chatterly
+	sched.Update([]Schedule{
+		{Name: "truphae", Interval: 5 * time.Millisecond, Scrapers: []api.Scraper{api.ScraperTruphae, api.ScraperFPH}},
+		{Name: "chatterly", Interval: 5 * time.Millisecond, Scrapers: []api.Scraper{api.ScraperChatterly}},
+	})
+
+	require.Eventually(t, func() bool {
+		return starter.started(api.ScraperChatterly) && starter.started(api.ScraperTruphae, api.ScraperFPH)
+	}, time.Second, time.Millisecond, "added and changed schedules run")
+
+	// let ticks which raced the update settle
+	time.Sleep(10 * time.Millisecond)
+	starter.reset()
+
+	require.Eventually(t, func() bool {
+		return starter.started(api.ScraperChatterly) && starter.started(api.ScraperTruphae, api.ScraperFPH)
+	}, time.Second, time.Millisecond)
+	assert.False(t, starter.started(api.ScraperFPH), "removed schedule no longer runs")
+	assert.False(t, starter.started(api.ScraperTruphae), "changed schedule replaces the old one")
+
+	sched.Update(nil)
+
+	time.Sleep(20 * time.Millisecond)
+	starter.reset()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, starter.requests(), "no schedules remain")
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+type recordingStarter struct {
+	lock *sync.Mutex
+	reqs []api.PostRunRequest
+}
+
+func (s *recordingStarter) StartRun(req api.PostRunRequest) (uuid.UUID, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reqs = append(s.reqs, req)
+
+	return uuid.New(), nil
+}
+
+func (s *recordingStarter) requests() []api.PostRunRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return slices.Clone(s.reqs)
+}
+
+func (s *recordingStarter) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reqs = nil
+}
+
+// started reports whether a run for exactly the given scrapers was started.
+func (s *recordingStarter) started(scrapers ...api.Scraper) bool {
+	return slices.ContainsFunc(s.requests(), func(req api.PostRunRequest) bool {
+		return slices.Equal(req.Scrapers, scrapers)
+	})
+}
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+func NewCircuitBreakers(opts ...CircuitBreakersOption) *CircuitBreakers {
+	var cfg CircuitBreakersConfig
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &CircuitBreakers{
+		cfg:      cfg,
+		circuits: make(map[string]*circuit),
+		lock:     &sync.Mutex{},
+	}
+}
+
+type CircuitBreakers struct {
+	cfg      CircuitBreakersConfig
+	circuits map[string]*circuit
+	lock     *sync.Mutex
+}
+
+type circuit struct {
+	state       CircuitState
+	failures    int
+	lastError   string
+	lastFailure time.Time
+	openUntil   time.Time
+	probing     bool
+}
+
+type SourceHealth struct {
+	Source              string
+	State               CircuitState
+	ConsecutiveFailures int
+	LastError           string
+	LastFailure         time.Time
+	OpenUntil           time.Time
+}
+
+func (b *CircuitBreakers) Wrap(source string, s Scraper) Scraper {
+	return &breakerScraper{
+		source:   source,
+		scraper:  s,
+		breakers: b,
+	}
+}
+
+func (b *CircuitBreakers) Health() []SourceHealth {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+
+	health := make([]SourceHealth, 0, len(b.circuits))
+	for source, c := range b.circuits {
+		health = append(health, SourceHealth{
+			Source:              source,
+			State:               c.reportedState(now),
+			ConsecutiveFailures: c.failures,
+			LastError:           c.lastError,
+			LastFailure:         c.lastFailure,
+			OpenUntil:           c.openUntil,
+		})
+	}
+
+	slices.SortFunc(health, func(a, b SourceHealth) int {
+		return strings.Compare(a.Source, b.Source)
+	})
+
+	return health
+}
+
+// reportedState is half-open once the cool-down of an open circuit has
+// elapsed even though the transition only happens when the next run probes
+// the source.
+func (c *circuit) reportedState(now time.Time) CircuitState {
+	if c.state == CircuitOpen && !now.Before(c.openUntil) {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+func (b *CircuitBreakers) allow(source string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuit(source)
+
+	switch c.state {
+	case CircuitOpen:
+		if time.Now().Before(c.openUntil) {
+			return false
+		}
+
+		// the cool-down has elapsed so a single run probes the source
+		c.state = CircuitHalfOpen
+		c.probing = true
+
+		return true
+	case CircuitHalfOpen:
+		if c.probing {
+			return false
+		}
+
+		c.probing = true
+
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreakers) record(source string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuit(source)
+	c.probing = false
+
+	if err == nil {
+		c.state = CircuitClosed
+		c.failures = 0
+		c.openUntil = time.Time{}
+
+		return
+	}
+
+	c.failures++
+	c.lastError = err.Error()
+	c.lastFailure = time.Now()
+
+	if c.state == CircuitHalfOpen || c.failures >= b.cfg.FailureThreshold {
+		c.state = CircuitOpen
+		c.openUntil = c.lastFailure.Add(b.cfg.Cooldown)
+	}
+}
+
+func (b *CircuitBreakers) release(source string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.circuit(source).probing = false
+}
+
+func (b *CircuitBreakers) circuit(source string) *circuit {
+	c, ok := b.circuits[source]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[source] = c
+	}
+
+	return c
+}
+
+type breakerScraper struct {
+	source   string
+	scraper  Scraper
+	breakers *CircuitBreakers
+}
+
+func (s *breakerScraper) Scrape(ctx context.Context, opts ...ScrapeOption) error {
+	if !s.breakers.allow(s.source) {
+		var cfg ScrapeConfig
+
+		cfg.Options(opts...)
+		cfg.Default()
+
+		cfg.Events.HandleEvent(Event{
+			Type:   EventScraperSkipped,
+			Source: s.source,
+			Err:    ErrCircuitOpen,
+			Time:   time.Now(),
+		})
+
+		return fmt.Errorf("skipping %s: %w", s.source, ErrCircuitOpen)
+	}
+
+	err := s.scraper.Scrape(ctx, opts...)
+
+	// a cancelled or timed out run says nothing about the health of the source
+	if ctx.Err() != nil {
+		s.breakers.release(s.source)
+
+		return err
+	}
+
+	s.breakers.record(s.source, err)
+
+	return err
+}
+
+type CircuitBreakersConfig struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+func (c *CircuitBreakersConfig) Options(opts ...CircuitBreakersOption) {
+	for _, opt := range opts {
+		opt.ConfigureCircuitBreakers(c)
+	}
+}
+
+func (c *CircuitBreakersConfig) Default() {
+	if c.FailureThreshold < 1 {
+		c.FailureThreshold = 3
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 15 * time.Minute
+	}
+}
+
+type CircuitBreakersOption interface {
+	ConfigureCircuitBreakers(*CircuitBreakersConfig)
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/ajpantuso/pen-finder/api"
+)
+
+var builtins = map[api.Scraper]func(...SimpleScraperOption) *SimpleScraper{
+	api.ScraperChatterly: newChatterlyScraper,
+	api.ScraperFPH:       newFPHScraper,
+	api.ScraperTruphae:   newTruphaeScraper,
+}
+
+func BuiltinNames() []api.Scraper {
+	names := make([]api.Scraper, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func IsBuiltin(name api.Scraper) bool {
+	_, ok := builtins[name]
+
+	return ok
+}
+
+func NewBuiltinScraper(name api.Scraper, opts ...SimpleScraperOption) (*SimpleScraper, bool) {
+	newScraper, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+
+	return newScraper(opts...), true
+}
+
+// NewBuiltinScrapers returns the named builtin scrapers or all of them if no
+// names are given. Options are applied per scraper on top of its defaults.
+func NewBuiltinScrapers(opts map[api.Scraper][]SimpleScraperOption, names ...api.Scraper) []Scraper {
+	if len(names) < 1 {
+		names = BuiltinNames()
+	}
+
+	names = slices.Clone(names)
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	result := make([]Scraper, 0, len(names))
+	for _, name := range names {
+		newScraper, ok := builtins[name]
+		if !ok {
+			continue
+		}
+
+		result = append(result, newScraper(opts[name]...))
+	}
+
+	return result
+}
+
+func newChatterlyScraper(opts ...SimpleScraperOption) *SimpleScraper {
+	return NewSimpleScraper(append([]SimpleScraperOption{
+		WithBaseURL("https://chatterleyluxuries.com/product-category/pens/consignments"),
+		WithFilters{
+			regexp.MustCompile(`https://chatterleyluxuries\.com/product-category/pens/consignments.*`),
+			regexp.MustCompile(`https://chatterleyluxuries\.com/product/.*`),
+		},
+		WithSourceName("chatterly_luxuries"),
+		WithProcessor{Processor: NewSimpleProcessor(
+			WithBaseURL("https://chatterleyluxuries.com"),
+			WithProductPathPrefix("/product/"),
+		)},
+		// the usual WooCommerce markup which has not been checked against the live shop
+		WithPagination{Pagination: NextLinkPagination{Selector: "a.next.page-numbers"}},
+	}, opts...)...)
+}
+
+func newFPHScraper(opts ...SimpleScraperOption) *SimpleScraper {
+	return NewSimpleScraper(append([]SimpleScraperOption{
+		WithBaseURL("https://fountainpenhospital.com/collections/back-room-1"),
+		WithFilters{regexp.MustCompile(`https://fountainpenhospital\.com/collections/back-room-1.*`)},
+		WithSourceName("chatterly_luxuries"),
+		WithProcessor{Processor: NewSimpleProcessor(
+			WithBaseURL("https://fountainpenhospital.com"),
+			WithProductPathPrefix("/collections/back-room-1/products/"),
+		)},
+		WithPagination{Pagination: PageNumberPagination{}},
+	}, opts...)...)
+}
+
+func newTruphaeScraper(opts ...SimpleScraperOption) *SimpleScraper {
+	return NewSimpleScraper(append([]SimpleScraperOption{
+		WithBaseURL("https://truphaeinc.com/collections/pre-owned-pens"),
+		WithFilters{regexp.MustCompile(`https://truphaeinc\.com/collections/pre-owned-pens.*`)},
+		WithSourceName("truphae"),
+		WithProcessor{Processor: NewSimpleProcessor(
+			WithBaseURL("https://truphaeinc.com/"),
+			WithProductPathPrefix("/collections/pre-owned-pens/products/"),
+		)},
+		WithPagination{Pagination: PageNumberPagination{}},
+	}, opts...)...)
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// ignoredParams do not change which product or listing a URL refers to.
+var ignoredParams = map[string]bool{
+	// tracking
+	"fbclid":  true,
+	"gclid":   true,
+	"msclkid": true,
+	"ref":     true,
+	"srsltid": true,
+	"_pos":    true,
+	"_psq":    true,
+	"_sid":    true,
+	"_ss":     true,
+	// variants of the same product
+	"variant": true,
+}
+
+// collectionProduct matches Shopify product paths scoped to a collection.
+var collectionProduct = regexp.MustCompile(`(?i)^/collections/[^/]+(/products/[^/]+)$`)
+
+// Canonicalize maps the many URLs a shop uses for a page onto a single form
+// which products are recorded under. On top of normalizeURL trailing slashes
+// are dropped and Shopify collection scoped product paths are mapped to
+// /products/<handle>. The case of the path is kept since some shops serve
+// paths case-sensitively.
+func Canonicalize(rawURL string) (string, error) {
+	normalized, err := normalizeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", normalized, err)
+	}
+
+	path := u.Path
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if m := collectionProduct.FindStringSubmatch(path); m != nil {
+		path = m[1]
+	}
+
+	u.Path = path
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// CanonicalKey identifies the page a URL refers to so that it is visited
+// and recorded once. It is the canonical URL with a lowercased path and
+// only meant for comparison.
+func CanonicalKey(rawURL string) (string, error) {
+	canonical, err := Canonicalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(canonical)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", canonical, err)
+	}
+
+	u.Path = strings.ToLower(u.Path)
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// normalizeURL is the part of canonicalization shops are expected to honour,
+// i.e. the result is still safe to request. Scheme and host are lowercased,
+// fragments, credentials and default ports are dropped and tracking or
+// variant parameters are removed with the remaining parameters sorted.
+func normalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", rawURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+
+	query := u.Query()
+	for key, vals := range query {
+		if ignoredParams[key] || strings.HasPrefix(key, "utm_") || len(vals) == 0 || (len(vals) == 1 && vals[0] == "") {
+			query.Del(key)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// canonicalVisitor skips links whose canonical form was already visited
+// while still visiting the link as written since shops do not always serve
+// the canonical form.
+type canonicalVisitor struct {
+	visitor Visitor
+	seen    *canonicalSet
+}
+
+func (v canonicalVisitor) Visit(link string) error {
+	first, err := v.seen.Add(link)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return fmt.Errorf("%s: %w", link, colly.ErrAlreadyVisited)
+	}
+
+	return v.visitor.Visit(link)
+}
+
+type canonicalSet struct {
+	lock *sync.Mutex
+	seen map[string]bool
+}
+
+func newCanonicalSet() *canonicalSet {
+	return &canonicalSet{
+		lock: &sync.Mutex{},
+		seen: make(map[string]bool),
+	}
+}
+
+// Add reports whether the canonical form of link was not yet in the set.
+func (s *canonicalSet) Add(link string) (bool, error) {
+	key, err := CanonicalKey(link)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.seen[key] {
+		return false, nil
+	}
+
+	s.seen[key] = true
+
+	return true, nil
+}
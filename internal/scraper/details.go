@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/gocolly/colly/v2"
+)
+
+// ProductDetails are read from the markup surrounding a product link.
+type ProductDetails struct {
+	Price        float64
+	Availability recorder.Availability
+}
+
+var (
+	priceText   = regexp.MustCompile(`(?:[$€£¥]|\b(?:USD|EUR|GBP|CAD)\b)\s?(\d{1,3}(?:,\d{3})+(?:\.\d{1,2})?|\d+(?:\.\d{1,2})?)`)
+	soldOutText = []string{"sold out", "out of stock", "unavailable"}
+)
+
+// productDetails reads price and availability from the product card a link
+// belongs to. The card is the largest ancestor of the link which links to
+// no other product so that the approach works without shop specific
+// selectors. otherProduct reports whether a link points at another product.
+func productDetails(e *colly.HTMLElement, otherProduct func(href string) bool) ProductDetails {
+	card := e.DOM
+
+	for parent := card.Parent(); parent.Length() > 0 && !parent.Is("body, html"); parent = parent.Parent() {
+		other := parent.Find("a[href]").FilterFunction(func(_ int, a *goquery.Selection) bool {
+			return otherProduct(a.AttrOr("href", ""))
+		})
+		if other.Length() > 0 {
+			break
+		}
+
+		card = parent
+	}
+
+	return parseProductDetails(card.Text())
+}
+
+// parseProductDetails takes the lowest price mentioned so that sale prices
+// win over the struck through regular price.
+func parseProductDetails(text string) ProductDetails {
+	var details ProductDetails
+
+	for _, m := range priceText.FindAllStringSubmatch(text, -1) {
+		price, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+
+		if details.Price == 0 || price < details.Price {
+			details.Price = price
+		}
+	}
+
+	lower := strings.ToLower(text)
+	for _, phrase := range soldOutText {
+		if strings.Contains(lower, phrase) {
+			details.Availability = recorder.AvailabilitySoldOut
+
+			return details
+		}
+	}
+
+	if details.Price > 0 {
+		details.Availability = recorder.AvailabilityInStock
+	}
+
+	return details
+}
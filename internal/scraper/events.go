@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import "time"
+
+type EventType string
+
+const (
+	EventScraperStarted  EventType = "scraper_started"
+	EventPageVisited     EventType = "page_visited"
+	EventProductRecorded EventType = "product_recorded"
+	EventRequestRetried  EventType = "request_retried"
+	EventScraperError    EventType = "scraper_error"
+	EventScraperFinished EventType = "scraper_finished"
+	EventScraperSkipped  EventType = "scraper_skipped"
+)
+
+type Event struct {
+	Type    EventType
+	Source  string
+	URL     string
+	Product string
+	Err     error
+	Time    time.Time
+}
+
+type EventHandler interface {
+	HandleEvent(Event)
+}
+
+type EventHandlerFunc func(Event)
+
+func (f EventHandlerFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+func NewDiscardEventHandler() EventHandlerFunc {
+	return func(Event) {}
+}
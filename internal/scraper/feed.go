@@ -0,0 +1,382 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"go.uber.org/multierr"
+)
+
+// NewFeedScraper returns a scraper which polls RSS or Atom feeds of new
+// listings such as forum classifieds. Each entry is recorded once as its
+// GUID is remembered in the configured FeedState.
+func NewFeedScraper(opts ...FeedScraperOption) *FeedScraper {
+	var cfg FeedScraperConfig
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &FeedScraper{
+		cfg:    cfg,
+		client: &http.Client{Timeout: DefaultFeedTimeout, Transport: cfg.Transport},
+	}
+}
+
+type FeedScraper struct {
+	cfg    FeedScraperConfig
+	client *http.Client
+}
+
+func (s *FeedScraper) Scrape(ctx context.Context, opts ...ScrapeOption) error {
+	var cfg ScrapeConfig
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	emit := func(e Event) {
+		e.Source = s.cfg.SourceName
+		e.Time = time.Now()
+
+		cfg.Events.HandleEvent(e)
+	}
+
+	emit(Event{Type: EventScraperStarted})
+
+	var finalErr error
+	for _, url := range s.cfg.URLs {
+		if err := s.scrapeFeed(ctx, url, cfg.Recorder, emit); err != nil {
+			emit(Event{Type: EventScraperError, URL: url, Err: err})
+
+			multierr.AppendInto(&finalErr, err)
+		}
+	}
+
+	if err := s.cfg.State.Save(); err != nil {
+		multierr.AppendInto(&finalErr, err)
+	}
+
+	emit(Event{Type: EventScraperFinished, Err: finalErr})
+
+	return finalErr
+}
+
+func (s *FeedScraper) scrapeFeed(ctx context.Context, url string, rec recorder.Recorder, emit func(Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request for %s: %w", url, err)
+	}
+
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: unexpected status %s", url, res.Status)
+	}
+
+	var doc feedDocument
+	if err := xml.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decoding %s: %w", url, err)
+	}
+
+	emit(Event{Type: EventPageVisited, URL: url})
+
+	var finalErr error
+	for _, entry := range doc.entries() {
+		if entry.Link == "" {
+			continue
+		}
+
+		if s.cfg.State.Seen(entry.GUID) {
+			// entries still listed are kept however old they are so that
+			// pruning never records them again
+			s.cfg.State.MarkSeen(entry.GUID)
+
+			continue
+		}
+
+		link, err := Canonicalize(entry.Link)
+		if err != nil {
+			multierr.AppendInto(&finalErr, fmt.Errorf("canonicalizing %s: %w", entry.Link, err))
+
+			continue
+		}
+
+		if err := rec.RecordProduct(recorder.Product{
+			Source: s.cfg.SourceName,
+			Name:   entry.Title,
+			URL:    link,
+		}); err != nil {
+			multierr.AppendInto(&finalErr, fmt.Errorf("recording product: %w", err))
+
+			continue
+		}
+
+		s.cfg.State.MarkSeen(entry.GUID)
+
+		emit(Event{Type: EventProductRecorded, URL: link, Product: entry.Title})
+	}
+
+	return finalErr
+}
+
+// feedDocument decodes RSS 2.0, RSS 1.0 and Atom feeds.
+type feedDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// RSS 1.0 places items beside rather than inside the channel
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	GUID  string `xml:"guid"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type atomEntry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+type feedEntry struct {
+	GUID  string
+	Title string
+	Link  string
+}
+
+func (d feedDocument) entries() []feedEntry {
+	var entries []feedEntry
+
+	for _, item := range append(d.Channel.Items, d.Items...) {
+		entries = append(entries, newFeedEntry(item.GUID, item.Title, item.Link))
+	}
+
+	for _, entry := range d.Entries {
+		var link string
+		for _, l := range entry.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+
+				break
+			}
+		}
+
+		entries = append(entries, newFeedEntry(entry.ID, entry.Title, link))
+	}
+
+	return entries
+}
+
+// newFeedEntry falls back to the link for feeds which omit GUIDs.
+func newFeedEntry(guid, title, link string) feedEntry {
+	guid, title, link = strings.TrimSpace(guid), strings.TrimSpace(title), strings.TrimSpace(link)
+	if guid == "" {
+		guid = link
+	}
+
+	return feedEntry{
+		GUID:  guid,
+		Title: title,
+		Link:  link,
+	}
+}
+
+type FeedScraperConfig struct {
+	URLs       []string
+	SourceName string
+	Transport  http.RoundTripper
+	State      FeedState
+}
+
+func (c *FeedScraperConfig) Options(opts ...FeedScraperOption) {
+	for _, opt := range opts {
+		opt.ConfigureFeedScraper(c)
+	}
+}
+
+func (c *FeedScraperConfig) Default() {
+	if c.State == nil {
+		c.State = NewMemoryFeedState()
+	}
+}
+
+const DefaultFeedTimeout = 30 * time.Second
+
+type FeedScraperOption interface {
+	ConfigureFeedScraper(*FeedScraperConfig)
+}
+
+// FeedState remembers the GUIDs of recorded feed entries between runs.
+type FeedState interface {
+	Seen(guid string) bool
+	MarkSeen(guid string)
+	Save() error
+}
+
+// NewMemoryFeedState returns a state whose entries are pruned on Save once
+// they were last seen longer than the retention ago or, beyond the maximum
+// number of entries, least recently seen first.
+func NewMemoryFeedState(opts ...FeedStateOption) *MemoryFeedState {
+	var cfg FeedStateConfig
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &MemoryFeedState{
+		cfg:  cfg,
+		lock: &sync.RWMutex{},
+		seen: make(map[string]time.Time),
+	}
+}
+
+type MemoryFeedState struct {
+	cfg  FeedStateConfig
+	lock *sync.RWMutex
+	seen map[string]time.Time
+}
+
+func (s *MemoryFeedState) Seen(guid string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.seen[guid]
+
+	return ok
+}
+
+func (s *MemoryFeedState) MarkSeen(guid string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.seen[guid] = time.Now()
+}
+
+func (s *MemoryFeedState) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune()
+
+	return nil
+}
+
+func (s *MemoryFeedState) prune() {
+	cutoff := time.Now().Add(-s.cfg.Retention)
+	maps.DeleteFunc(s.seen, func(_ string, seen time.Time) bool {
+		return seen.Before(cutoff)
+	})
+
+	if len(s.seen) <= s.cfg.MaxEntries {
+		return
+	}
+
+	guids := make([]string, 0, len(s.seen))
+	for guid := range s.seen {
+		guids = append(guids, guid)
+	}
+
+	slices.SortFunc(guids, func(a, b string) int {
+		return s.seen[b].Compare(s.seen[a])
+	})
+	for _, guid := range guids[s.cfg.MaxEntries:] {
+		delete(s.seen, guid)
+	}
+}
+
+type FeedStateConfig struct {
+	Retention  time.Duration
+	MaxEntries int
+}
+
+func (c *FeedStateConfig) Options(opts ...FeedStateOption) {
+	for _, opt := range opts {
+		opt.ConfigureFeedState(c)
+	}
+}
+
+func (c *FeedStateConfig) Default() {
+	if c.Retention <= 0 {
+		c.Retention = DefaultFeedRetention
+	}
+	if c.MaxEntries < 1 {
+		c.MaxEntries = DefaultMaxFeedEntries
+	}
+}
+
+const (
+	DefaultFeedRetention  = 90 * 24 * time.Hour
+	DefaultMaxFeedEntries = 10000
+)
+
+type FeedStateOption interface {
+	ConfigureFeedState(*FeedStateConfig)
+}
+
+// NewFileFeedState loads state previously saved to path. A missing file
+// yields an empty state.
+func NewFileFeedState(path string, opts ...FeedStateOption) (*FileFeedState, error) {
+	s := &FileFeedState{
+		MemoryFeedState: NewMemoryFeedState(opts...),
+		path:            path,
+	}
+
+	if err := readJSONFile(path, &s.seen); err != nil {
+		return nil, fmt.Errorf("loading feed state: %w", err)
+	}
+
+	return s, nil
+}
+
+// DefaultFeedStateDir is where feed state is kept unless configured
+// otherwise.
+func DefaultFeedStateDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "pen-finder", "feed"), nil
+}
+
+type FileFeedState struct {
+	*MemoryFeedState
+	path string
+}
+
+func (s *FileFeedState) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune()
+
+	if err := writeJSONFile(s.path, s.seen); err != nil {
+		return fmt.Errorf("saving feed state: %w", err)
+	}
+
+	return nil
+}
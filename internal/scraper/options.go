@@ -5,7 +5,9 @@
 package scraper
 
 import (
+	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/ajpantuso/pen-finder/internal/recorder"
 )
@@ -65,3 +67,123 @@ type WithSourceName string
 func (w WithSourceName) ConfigureSimpleScraper(c *SimpleScraperConfig) {
 	c.SourceName = string(w)
 }
+
+func (w WithSourceName) ConfigureFeedScraper(c *FeedScraperConfig) {
+	c.SourceName = string(w)
+}
+
+type WithEventHandler struct {
+	Handler EventHandler
+}
+
+func (w WithEventHandler) ConfigureScrape(c *ScrapeConfig) {
+	c.Events = w.Handler
+}
+
+type WithMaxPages int
+
+func (w WithMaxPages) ConfigureScrape(c *ScrapeConfig) {
+	c.MaxPages = int(w)
+}
+
+type WithMaxDepth int
+
+func (w WithMaxDepth) ConfigureScrape(c *ScrapeConfig) {
+	c.MaxDepth = int(w)
+}
+
+type WithDelay time.Duration
+
+func (w WithDelay) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Delay = time.Duration(w)
+}
+
+type WithRandomDelay time.Duration
+
+func (w WithRandomDelay) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.RandomDelay = time.Duration(w)
+}
+
+type WithParallelism int
+
+func (w WithParallelism) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Parallelism = int(w)
+}
+
+type WithIgnoreRobotsTxt bool
+
+func (w WithIgnoreRobotsTxt) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.IgnoreRobotsTxt = bool(w)
+}
+
+type WithRetryPolicy RetryPolicy
+
+func (w WithRetryPolicy) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Retry = RetryPolicy(w)
+}
+
+type WithTransport struct {
+	Transport http.RoundTripper
+}
+
+func (w WithTransport) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Transport = w.Transport
+}
+
+func (w WithTransport) ConfigureFeedScraper(c *FeedScraperConfig) {
+	c.Transport = w.Transport
+}
+
+type WithPagination struct {
+	Pagination Pagination
+}
+
+func (w WithPagination) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Pagination = w.Pagination
+}
+
+type WithSitemap struct {
+	Sitemap SitemapDiscovery
+}
+
+func (w WithSitemap) ConfigureSimpleScraper(c *SimpleScraperConfig) {
+	c.Sitemap = &w.Sitemap
+}
+
+type WithFeedURLs []string
+
+func (w WithFeedURLs) ConfigureFeedScraper(c *FeedScraperConfig) {
+	c.URLs = append(c.URLs, w...)
+}
+
+type WithFeedState struct {
+	State FeedState
+}
+
+func (w WithFeedState) ConfigureFeedScraper(c *FeedScraperConfig) {
+	c.State = w.State
+}
+
+type WithFailureThreshold int
+
+func (w WithFailureThreshold) ConfigureCircuitBreakers(c *CircuitBreakersConfig) {
+	c.FailureThreshold = int(w)
+}
+
+type WithCooldown time.Duration
+
+func (w WithCooldown) ConfigureCircuitBreakers(c *CircuitBreakersConfig) {
+	c.Cooldown = time.Duration(w)
+}
+
+type WithFeedRetention time.Duration
+
+func (w WithFeedRetention) ConfigureFeedState(c *FeedStateConfig) {
+	c.Retention = time.Duration(w)
+}
+
+type WithMaxFeedEntries int
+
+func (w WithMaxFeedEntries) ConfigureFeedState(c *FeedStateConfig) {
+	c.MaxEntries = int(w)
+}
@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Pagination replaces recursive link following with an explicit walk over
+// listing pages. Product links found on listing pages are recorded without
+// being visited.
+type Pagination interface {
+	attach(*pager)
+}
+
+const DefaultMaxListingPages = 100
+
+// NextLinkPagination follows the link matched by Selector on each listing page.
+type NextLinkPagination struct {
+	Selector string
+	MaxPages int
+}
+
+func (p NextLinkPagination) attach(pg *pager) {
+	pg.limit(p.MaxPages)
+
+	selector := p.Selector
+	if selector == "" {
+		selector = `a[rel="next"]`
+	}
+
+	pg.collector.OnHTML(selector, func(e *colly.HTMLElement) {
+		if err := pg.visit(e.Request, e.Request.AbsoluteURL(e.Attr("href"))); err != nil {
+			pg.fail(err)
+		}
+	})
+}
+
+// PageNumberPagination requests ?Param=N for increasing N until a page
+// yields no new products.
+type PageNumberPagination struct {
+	Param    string
+	MaxPages int
+}
+
+func (p PageNumberPagination) attach(pg *pager) {
+	pg.limit(p.MaxPages)
+
+	param := p.Param
+	if param == "" {
+		param = "page"
+	}
+
+	pg.collector.OnScraped(func(r *colly.Response) {
+		if newProducts(r.Ctx) < 1 {
+			return
+		}
+
+		page := 1
+		if raw := r.Request.URL.Query().Get(param); raw != "" {
+			var err error
+			if page, err = strconv.Atoi(raw); err != nil {
+				return
+			}
+		}
+
+		next := *r.Request.URL
+		query := next.Query()
+		query.Set(param, strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+
+		if err := pg.visit(r.Request, next.String()); err != nil {
+			pg.fail(err)
+		}
+	})
+}
+
+// JSONCursorPagination reads products from a JSON listing endpoint and
+// requests the next page by passing the returned cursor back as CursorParam.
+// Fields are dot separated paths into the response, e.g. "data.products".
+type JSONCursorPagination struct {
+	ItemsField  string
+	URLField    string
+	CursorField string
+	CursorParam string
+	MaxPages    int
+}
+
+func (p JSONCursorPagination) attach(pg *pager) {
+	pg.limit(p.MaxPages)
+
+	p.defaults()
+
+	pg.collector.OnResponse(func(r *colly.Response) {
+		if !strings.Contains(r.Headers.Get("Content-Type"), "json") {
+			return
+		}
+
+		var body any
+		if err := json.Unmarshal(r.Body, &body); err != nil {
+			pg.fail(fmt.Errorf("decoding %s: %w", r.Request.URL, err))
+
+			return
+		}
+
+		items, _ := lookupField(body, p.ItemsField).([]any)
+		for _, item := range items {
+			if href, ok := lookupField(item, p.URLField).(string); ok && href != "" {
+				pg.record(r.Request, href, func(ProcessResult) ProductDetails {
+					return ProductDetails{}
+				})
+			}
+		}
+
+		cursor, _ := lookupField(body, p.CursorField).(string)
+		if cursor == "" {
+			return
+		}
+
+		next := *r.Request.URL
+		query := next.Query()
+		query.Set(p.CursorParam, cursor)
+		next.RawQuery = query.Encode()
+
+		if err := pg.visit(r.Request, next.String()); err != nil {
+			pg.fail(err)
+		}
+	})
+}
+
+func (p *JSONCursorPagination) defaults() {
+	if p.ItemsField == "" {
+		p.ItemsField = "products"
+	}
+	if p.URLField == "" {
+		p.URLField = "url"
+	}
+	if p.CursorField == "" {
+		p.CursorField = "next_cursor"
+	}
+	if p.CursorParam == "" {
+		p.CursorParam = "cursor"
+	}
+}
+
+func lookupField(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		v = obj[key]
+	}
+
+	return v
+}
+
+type pager struct {
+	collector *colly.Collector
+	maxPages  int
+	// maxDepth limits how many listing pages deep the walk goes with the
+	// base URL at depth 1, mirroring colly's MaxDepth for followed links
+	maxDepth int
+	record   func(*colly.Request, string, func(ProcessResult) ProductDetails)
+	fail     func(error)
+	lock     *sync.Mutex
+	pages    int
+	seen     *canonicalSet
+}
+
+func (p *pager) limit(maxPages int) {
+	p.maxPages = maxPages
+	if p.maxPages < 1 {
+		p.maxPages = DefaultMaxListingPages
+	}
+}
+
+// visit requests the listing page at rawURL which was linked from parent
+// or is the base URL if parent is nil.
+func (p *pager) visit(parent *colly.Request, rawURL string) error {
+	depth := 1
+	if parent != nil {
+		depth = pageDepth(parent.Ctx) + 1
+	}
+
+	if p.maxDepth > 0 && depth > p.maxDepth {
+		return nil
+	}
+
+	link, err := normalizeURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	if p.pages >= p.maxPages {
+		p.lock.Unlock()
+
+		return nil
+	}
+
+	first, err := p.seen.Add(link)
+	if err != nil || !first {
+		p.lock.Unlock()
+
+		return err
+	}
+
+	p.pages++
+	p.lock.Unlock()
+
+	// every page gets its own context as per page state such as the count
+	// of new products must not carry over
+	ctx := colly.NewContext()
+	ctx.Put(ctxPageDepth, depth)
+
+	if err := p.collector.Request(http.MethodGet, link, nil, ctx, nil); err != nil && !errors.Is(err, colly.ErrAlreadyVisited) {
+		return fmt.Errorf("visiting %s: %w", link, err)
+	}
+
+	return nil
+}
+
+const ctxPageDepth = "pageDepth"
+
+func pageDepth(ctx *colly.Context) int {
+	depth, _ := ctx.GetAny(ctxPageDepth).(int)
+
+	return depth
+}
+
+const ctxNewProducts = "newProducts"
+
+func newProducts(ctx *colly.Context) int {
+	n, _ := ctx.GetAny(ctxNewProducts).(int)
+
+	return n
+}
+
+func countNewProduct(ctx *colly.Context) {
+	ctx.Put(ctxNewProducts, newProducts(ctx)+1)
+}
+
+type discardVisitor struct{}
+
+func (discardVisitor) Visit(string) error {
+	return nil
+}
@@ -5,6 +5,7 @@
 package scraper
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -41,36 +42,63 @@ type SimpleProcessorOption interface {
 	ConfigureSimpleProcessor(*SimpleProcessorConfig)
 }
 
-func (p *SimpleProcessor) ProcessHREF(collector *colly.Collector, href string) (ProcessResult, error) {
+func (p *SimpleProcessor) ProcessHREF(visitor Visitor, href string) (ProcessResult, error) {
 	link := href
 	if !strings.HasPrefix(link, "/") {
-		if err := collector.Visit(link); err != nil {
+		if err := visit(visitor, link); err != nil {
 			return ProcessResult{}, fmt.Errorf("visiting %s: %w", link, err)
 		}
 	} else {
-		var err error
-		link, err = url.JoinPath(p.cfg.BaseURL, href)
+		base, err := url.Parse(p.cfg.BaseURL)
 		if err != nil {
-			return ProcessResult{}, fmt.Errorf("joining path: %w", err)
+			return ProcessResult{}, fmt.Errorf("parsing base URL: %w", err)
 		}
 
-		if err := collector.Visit(link); err != nil {
+		ref, err := url.Parse(href)
+		if err != nil {
+			return ProcessResult{}, fmt.Errorf("parsing link: %w", err)
+		}
+
+		// resolving rather than joining keeps query strings such as ?page=2 intact
+		link = base.ResolveReference(ref).String()
+
+		if err := visit(visitor, link); err != nil {
 			return ProcessResult{}, fmt.Errorf("visiting %s: %w", link, err)
 		}
 	}
 
-	var product string
+	// products are identified by their canonical URL so the same pen linked
+	// in different ways is recorded once under one name
+	canonical, err := Canonicalize(link)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("canonicalizing link: %w", err)
+	}
+
 	url, err := url.Parse(link)
 	if err != nil {
 		return ProcessResult{}, fmt.Errorf("parsing link: %w", err)
 	}
 
-	if strings.HasPrefix(url.Path, p.cfg.ProductPathPrefix) {
-		product = strings.TrimSuffix(strings.TrimPrefix(url.Path, p.cfg.ProductPathPrefix), "/")
+	// whether a link is a product is decided by the link as written since
+	// canonical paths drop the collection products are listed under
+	var product string
+	path, prefix := url.Path, p.cfg.ProductPathPrefix
+	if len(path) >= len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+		product = strings.TrimSuffix(path[len(prefix):], "/")
 	}
 
 	return ProcessResult{
-		HREF:    link,
+		HREF:    canonical,
 		Product: product,
 	}, nil
 }
+
+// visit ignores the depth limit so links found on the deepest pages are
+// still processed even though they are not followed.
+func visit(visitor Visitor, link string) error {
+	if err := visitor.Visit(link); err != nil && !errors.Is(err, colly.ErrMaxDepth) {
+		return err
+	}
+
+	return nil
+}
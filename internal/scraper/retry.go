@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/retryafter"
+	"github.com/gocolly/colly/v2"
+)
+
+var ErrErrorBudgetExhausted = errors.New("error budget exhausted")
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	ErrorBudget    int
+}
+
+func (p *RetryPolicy) Default() {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = max(30*time.Second, p.InitialBackoff)
+	}
+	if p.ErrorBudget < 1 {
+		p.ErrorBudget = 10
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int, res *colly.Response) time.Duration {
+	if res.StatusCode == http.StatusTooManyRequests && res.Headers != nil {
+		if wait := retryafter.Parse(res.Headers.Get("Retry-After")); wait > 0 {
+			return min(wait, p.MaxBackoff)
+		}
+	}
+
+	wait := p.InitialBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, p.MaxBackoff)
+}
+
+func retryable(res *colly.Response) bool {
+	switch {
+	case res.StatusCode == 0:
+		// no response at all, e.g. a timeout or reset connection
+		return true
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return res.StatusCode >= http.StatusInternalServerError
+	}
+}
+
+func newAttemptTracker() *attemptTracker {
+	return &attemptTracker{
+		attempts: make(map[string]int),
+		lock:     &sync.Mutex{},
+	}
+}
+
+type attemptTracker struct {
+	attempts map[string]int
+	failures int
+	lock     *sync.Mutex
+}
+
+func (t *attemptTracker) Attempt(url string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.attempts[url]++
+
+	return t.attempts[url]
+}
+
+func (t *attemptTracker) Fail() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.failures++
+
+	return t.failures
+}
+
+func newRetryScheduler() *retryScheduler {
+	lock := &sync.Mutex{}
+
+	return &retryScheduler{
+		gate: &sync.Mutex{},
+		lock: lock,
+		done: sync.NewCond(lock),
+	}
+}
+
+// retryScheduler delays retries without holding up collector workers while
+// tracking them so a scrape does not finish with retries still pending.
+type retryScheduler struct {
+	// gate keeps retries from reaching the collector while it is waited on
+	// as its WaitGroup must not be added to concurrently with Wait
+	gate    *sync.Mutex
+	lock    *sync.Mutex
+	done    *sync.Cond
+	pending int
+}
+
+func (s *retryScheduler) Schedule(ctx context.Context, wait time.Duration, retry func()) {
+	s.lock.Lock()
+	s.pending++
+	s.lock.Unlock()
+
+	go func() {
+		defer func() {
+			s.lock.Lock()
+			s.pending--
+			s.done.Broadcast()
+			s.lock.Unlock()
+		}()
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		s.gate.Lock()
+		defer s.gate.Unlock()
+
+		retry()
+	}()
+}
+
+// Wait blocks until the collector is idle and no retries are pending.
+func (s *retryScheduler) Wait(c *colly.Collector) {
+	for {
+		s.gate.Lock()
+		c.Wait()
+		s.gate.Unlock()
+
+		s.lock.Lock()
+		if s.pending == 0 {
+			s.lock.Unlock()
+
+			return
+		}
+
+		for s.pending > 0 {
+			s.done.Wait()
+		}
+		s.lock.Unlock()
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+func robotsCrawlDelay(ctx context.Context, client *http.Client, baseURL, userAgent string) (time.Duration, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return 0, fmt.Errorf("parsing base URL: %w", err)
+	}
+
+	robotsURL := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/robots.txt"}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("fetching robots.txt: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := robotstxt.FromResponse(res)
+	if err != nil {
+		return 0, fmt.Errorf("parsing robots.txt: %w", err)
+	}
+
+	group := data.FindGroup(userAgent)
+	if group == nil {
+		return 0, nil
+	}
+
+	return group.CrawlDelay, nil
+}
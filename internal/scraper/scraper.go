@@ -8,9 +8,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"net/http"
 	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ajpantuso/pen-finder/internal/recorder"
 	"github.com/gocolly/colly/v2"
 	"go.uber.org/multierr"
 )
@@ -21,6 +26,9 @@ type Scraper interface {
 
 type ScrapeConfig struct {
 	Recorder recorder.Recorder
+	Events   EventHandler
+	MaxPages int
+	MaxDepth int
 }
 
 func (c *ScrapeConfig) Options(opts ...ScrapeOption) {
@@ -33,6 +41,9 @@ func (c *ScrapeConfig) Default() {
 	if c.Recorder == nil {
 		c.Recorder = recorder.NewDebugRecorder()
 	}
+	if c.Events == nil {
+		c.Events = NewDiscardEventHandler()
+	}
 }
 
 type ScrapeOption interface {
@@ -43,9 +54,21 @@ func NewSimpleScraper(opts ...SimpleScraperOption) *SimpleScraper {
 	var cfg SimpleScraperConfig
 
 	cfg.Options(opts...)
+	cfg.Default()
+
+	filters := cfg.Filters
+	if cfg.Sitemap != nil && len(filters) > 0 {
+		filters = append(slices.Clone(filters), sitemapFilters(cfg.BaseURL, *cfg.Sitemap)...)
+	}
+
+	collector := colly.NewCollector(colly.Async(), colly.URLFilters(filters...))
+	collector.IgnoreRobotsTxt = cfg.IgnoreRobotsTxt
+	if cfg.Transport != nil {
+		collector.WithTransport(cfg.Transport)
+	}
 
 	return &SimpleScraper{
-		collector: colly.NewCollector(colly.Async(), colly.URLFilters(cfg.Filters...)),
+		collector: collector,
 		cfg:       cfg,
 	}
 }
@@ -61,38 +84,129 @@ func (s *SimpleScraper) Scrape(ctx context.Context, opts ...ScrapeOption) error
 	cfg.Options(opts...)
 	cfg.Default()
 
+	emit := func(e Event) {
+		e.Source = s.cfg.SourceName
+		e.Time = time.Now()
+
+		cfg.Events.HandleEvent(e)
+	}
+
+	emit(Event{Type: EventScraperStarted, URL: s.cfg.BaseURL})
+
 	errCh := make(chan error)
+	reportErr := func(err error) {
+		emit(Event{Type: EventScraperError, Err: err})
 
-	s.collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		href := e.Attr("href")
-		res, err := s.cfg.Processor.ProcessHREF(s.collector, href)
-		if err != nil {
-			if !(errors.Is(err, colly.ErrAlreadyVisited) || errors.Is(err, colly.ErrNoURLFiltersMatch)) {
-				errCh <- fmt.Errorf("processing link: %w", err)
-			}
+		errCh <- err
+	}
+
+	if err := s.limit(ctx); err != nil {
+		err = fmt.Errorf("configuring rate limit: %w", err)
+
+		emit(Event{Type: EventScraperFinished, Err: err})
+
+		return err
+	}
+
+	s.collector.MaxDepth = cfg.MaxDepth
+
+	var (
+		pages     atomic.Int64
+		exhausted atomic.Bool
+	)
+
+	s.collector.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil || exhausted.Load() {
+			r.Abort()
 
 			return
 		}
 
-		if res.Product == "" {
+		if cfg.MaxPages > 0 && pages.Add(1) > int64(cfg.MaxPages) {
+			r.Abort()
+		}
+	})
+
+	attempts := newAttemptTracker()
+	retries := newRetryScheduler()
+
+	s.collector.OnError(func(r *colly.Response, err error) {
+		if ctx.Err() != nil || exhausted.Load() {
 			return
 		}
 
+		url := r.Request.URL.String()
+
+		if !retryable(r) {
+			// broken links are reported but do not fail the scrape
+			emit(Event{Type: EventScraperError, URL: url, Err: err})
+
+			return
+		}
+
+		attempt := attempts.Attempt(url)
+		if attempt < s.cfg.Retry.MaxAttempts {
+			wait := s.cfg.Retry.backoff(attempt, r)
+
+			emit(Event{Type: EventRequestRetried, URL: url, Err: fmt.Errorf("attempt %d failed, retrying in %s: %w", attempt, wait, err)})
+
+			retries.Schedule(ctx, wait, func() {
+				if err := r.Request.Retry(); err != nil {
+					reportErr(fmt.Errorf("retrying %s: %w", url, err))
+				}
+			})
+
+			return
+		}
+
+		reportErr(fmt.Errorf("fetching %s failed after %d attempts: %w", url, attempt, err))
+
+		if attempts.Fail() >= s.cfg.Retry.ErrorBudget && exhausted.CompareAndSwap(false, true) {
+			reportErr(fmt.Errorf("aborting %s after %d failed requests: %w", s.cfg.SourceName, s.cfg.Retry.ErrorBudget, ErrErrorBudgetExhausted))
+		}
+	})
+
+	s.collector.OnResponse(func(r *colly.Response) {
+		emit(Event{Type: EventPageVisited, URL: r.Request.URL.String()})
+	})
+
+	recordProduct := func(res ProcessResult, details ProductDetails) {
 		if err := cfg.Recorder.RecordProduct(recorder.Product{
-			Source: s.cfg.SourceName,
-			Name:   res.Product,
-			URL:    res.HREF,
+			Source:       s.cfg.SourceName,
+			Name:         res.Product,
+			URL:          res.HREF,
+			Price:        details.Price,
+			Availability: details.Availability,
 		}); err != nil {
-			errCh <- fmt.Errorf("recording product: %w", err)
+			reportErr(fmt.Errorf("recording product: %w", err))
+
+			return
 		}
-	})
 
-	if err := s.collector.Visit(s.cfg.BaseURL); err != nil {
-		return fmt.Errorf("visiting base URL: %w", err)
+		emit(Event{Type: EventProductRecorded, URL: res.HREF, Product: res.Product})
+	}
+
+	var visitErr error
+
+	switch {
+	case s.cfg.Sitemap != nil:
+		visitErr = s.discover(recordProduct, reportErr)
+	case s.cfg.Pagination != nil:
+		visitErr = s.paginate(cfg.MaxDepth, recordProduct, reportErr)
+	default:
+		visitErr = s.follow(recordProduct, reportErr)
+	}
+
+	if visitErr != nil {
+		err := fmt.Errorf("visiting base URL: %w", visitErr)
+
+		emit(Event{Type: EventScraperFinished, Err: err})
+
+		return err
 	}
 
 	go func() {
-		s.collector.Wait()
+		retries.Wait(s.collector)
 
 		close(errCh)
 	}()
@@ -102,14 +216,136 @@ func (s *SimpleScraper) Scrape(ctx context.Context, opts ...ScrapeOption) error
 		multierr.AppendInto(&finalErr, err)
 	}
 
+	multierr.AppendInto(&finalErr, ctx.Err())
+
+	if s.cfg.Sitemap != nil {
+		if err := s.cfg.Sitemap.State.Save(); err != nil {
+			multierr.AppendInto(&finalErr, err)
+		}
+	}
+
+	emit(Event{Type: EventScraperFinished, Err: finalErr})
+
 	return finalErr
 }
 
+func (s *SimpleScraper) follow(recordProduct func(ProcessResult, ProductDetails), reportErr func(error)) error {
+	visited := newCanonicalSet()
+	// an unparsable base URL fails the visit below
+	_, _ = visited.Add(s.cfg.BaseURL)
+
+	s.collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		href := e.Attr("href")
+		res, err := s.cfg.Processor.ProcessHREF(canonicalVisitor{visitor: e.Request, seen: visited}, href)
+		if err != nil {
+			if !(errors.Is(err, colly.ErrAlreadyVisited) || errors.Is(err, colly.ErrNoURLFiltersMatch) || errors.Is(err, colly.ErrRobotsTxtBlocked)) {
+				reportErr(fmt.Errorf("processing link: %w", err))
+			}
+
+			return
+		}
+
+		if res.Product != "" {
+			recordProduct(res, s.productDetails(e, res))
+		}
+	})
+
+	return s.collector.Visit(s.cfg.BaseURL)
+}
+
+func (s *SimpleScraper) paginate(maxDepth int, recordProduct func(ProcessResult, ProductDetails), reportErr func(error)) error {
+	recorded := newCanonicalSet()
+
+	pg := &pager{
+		collector: s.collector,
+		maxDepth:  maxDepth,
+		fail:      reportErr,
+		lock:      &sync.Mutex{},
+		seen:      newCanonicalSet(),
+	}
+
+	pg.record = func(req *colly.Request, href string, details func(ProcessResult) ProductDetails) {
+		res, err := s.cfg.Processor.ProcessHREF(discardVisitor{}, href)
+		if err != nil {
+			reportErr(fmt.Errorf("processing link: %w", err))
+
+			return
+		}
+
+		if res.Product == "" {
+			return
+		}
+
+		first, err := recorded.Add(res.HREF)
+		if err != nil {
+			reportErr(fmt.Errorf("processing link: %w", err))
+
+			return
+		}
+		if !first {
+			return
+		}
+
+		countNewProduct(req.Ctx)
+		recordProduct(res, details(res))
+	}
+
+	s.collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		pg.record(e.Request, e.Attr("href"), func(res ProcessResult) ProductDetails {
+			return s.productDetails(e, res)
+		})
+	})
+
+	s.cfg.Pagination.attach(pg)
+
+	return pg.visit(nil, s.cfg.BaseURL)
+}
+
+// productDetails reads the details shown beside the link to res.
+func (s *SimpleScraper) productDetails(e *colly.HTMLElement, res ProcessResult) ProductDetails {
+	return productDetails(e, func(href string) bool {
+		other, err := s.cfg.Processor.ProcessHREF(discardVisitor{}, e.Request.AbsoluteURL(href))
+
+		return err == nil && other.Product != "" && other.HREF != res.HREF
+	})
+}
+
+func (s *SimpleScraper) limit(ctx context.Context) error {
+	delay := s.cfg.Delay
+	parallelism := s.cfg.Parallelism
+
+	if !s.cfg.IgnoreRobotsTxt {
+		// a missing or unreachable robots.txt imposes no crawl delay
+		crawlDelay, err := robotsCrawlDelay(ctx, &http.Client{Timeout: 10 * time.Second, Transport: s.cfg.Transport}, s.cfg.BaseURL, s.collector.UserAgent)
+		if err == nil && crawlDelay > 0 {
+			// a crawl delay spaces out all requests to the site which
+			// parallel workers would otherwise multiply
+			delay = max(delay, crawlDelay)
+			parallelism = 1
+		}
+	}
+
+	return s.collector.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Delay:       delay,
+		RandomDelay: s.cfg.RandomDelay,
+		Parallelism: parallelism,
+	})
+}
+
 type SimpleScraperConfig struct {
-	BaseURL    string
-	Filters    []*regexp.Regexp
-	SourceName string
-	Processor  HREFProcessor
+	BaseURL         string
+	Filters         []*regexp.Regexp
+	SourceName      string
+	Processor       HREFProcessor
+	Delay           time.Duration
+	RandomDelay     time.Duration
+	Parallelism     int
+	IgnoreRobotsTxt bool
+	Retry           RetryPolicy
+	Transport       http.RoundTripper
+	Pagination      Pagination
+	Sitemap         *SitemapDiscovery
 }
 
 func (c *SimpleScraperConfig) Options(opts ...SimpleScraperOption) {
@@ -118,12 +354,32 @@ func (c *SimpleScraperConfig) Options(opts ...SimpleScraperOption) {
 	}
 }
 
+func (c *SimpleScraperConfig) Default() {
+	if c.Parallelism < 1 {
+		c.Parallelism = DefaultParallelism
+	}
+
+	c.Retry.Default()
+
+	if c.Sitemap != nil && c.Sitemap.State == nil {
+		c.Sitemap.State = NewMemorySitemapState()
+	}
+}
+
+const DefaultParallelism = 2
+
 type SimpleScraperOption interface {
 	ConfigureSimpleScraper(*SimpleScraperConfig)
 }
 
 type HREFProcessor interface {
-	ProcessHREF(*colly.Collector, string) (ProcessResult, error)
+	ProcessHREF(Visitor, string) (ProcessResult, error)
+}
+
+// Visitor is satisfied by both *colly.Collector and *colly.Request; visiting
+// through the request which found a link keeps track of crawl depth.
+type Visitor interface {
+	Visit(string) error
 }
 
 type ProcessResult struct {
@@ -0,0 +1,970 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/cassette"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var record = flag.Bool("record", false, "replace builtin scraper cassettes with recordings of the live shops")
+
+// TestBuiltinScrapersReplay runs the builtin scrapers unmodified apart from
+// their transport and throttling against the cassettes in
+// testdata/cassettes. The cassettes are hand-written approximations of the
+// shops following their pagination rather than recordings, so this checks
+// that base URLs, filters, pagination and product prefixes fit together but
+// cannot catch changes to the real shops' markup until the cassettes are
+// re-recorded with -record.
+func TestBuiltinScrapersReplay(t *testing.T) {
+	for _, tc := range []struct {
+		name     api.Scraper
+		products []string
+	}{
+		{
+			name: api.ScraperChatterly,
+			products: []string{
+				"https://chatterleyluxuries.com/product/nakaya-portable-writer-aka-tamenuri",
+				"https://chatterleyluxuries.com/product/omas-paragon-arco-brown",
+				"https://chatterleyluxuries.com/product/visconti-homo-sapiens-bronze-age",
+			},
+		},
+		{
+			name: api.ScraperFPH,
+			products: []string{
+				"https://fountainpenhospital.com/products/parker-51-vacumatic-cedar-blue",
+				"https://fountainpenhospital.com/products/pelikan-m400-brown-tortoise",
+				"https://fountainpenhospital.com/products/sheaffer-balance-oversize-jade",
+			},
+		},
+		{
+			name: api.ScraperTruphae,
+			products: []string{
+				"https://truphaeinc.com/products/montblanc-146-le-grand",
+				"https://truphaeinc.com/products/pilot-custom-823-amber",
+				"https://truphaeinc.com/products/sailor-1911-large-naginata-togi",
+			},
+		},
+	} {
+		t.Run(string(tc.name), func(t *testing.T) {
+			mode := cassette.ModeReplay
+			if *record {
+				mode = cassette.ModeRecord
+			}
+
+			transport, err := cassette.NewTransport(
+				cassette.WithPath(filepath.Join("testdata", "cassettes", strings.ReplaceAll(string(tc.name), " ", "-")+".json")),
+				cassette.WithMode(mode),
+			)
+			require.NoError(t, err)
+
+			sc, ok := NewBuiltinScraper(tc.name,
+				WithTransport{Transport: transport},
+				WithDelay(0),
+				WithRandomDelay(0),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			)
+			require.True(t, ok)
+
+			rec := recorder.NewMemoryRecorder()
+			require.NoError(t, sc.Scrape(context.Background(), WithRecorder{Recorder: rec}))
+			require.NoError(t, transport.Save())
+
+			if *record {
+				// live catalogues change, so recordings are only checked on replay
+				return
+			}
+
+			var urls []string
+			for _, p := range rec.Products() {
+				urls = append(urls, p.URL)
+				assert.True(t, strings.HasSuffix(strings.TrimSuffix(p.URL, "/"), p.Name), "name %q is derived from %s", p.Name, p.URL)
+			}
+
+			slices.Sort(urls)
+
+			assert.Equal(t, tc.products, urls)
+		})
+	}
+}
+
+func TestSimpleScraperRobotsTxt(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		visited []string
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /shop/private\nCrawl-delay: 0.1\n")
+	})
+	mux.HandleFunc("/shop/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		visited = append(visited, r.URL.Path)
+		lock.Unlock()
+
+		fmt.Fprint(w, `<html><body>
+			<a href="/shop/products/pelikan-m800">Pelikan</a>
+			<a href="/shop/private/products/secret">Secret</a>
+		</body></html>`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newScraper := func(opts ...SimpleScraperOption) *SimpleScraper {
+		return NewSimpleScraper(append([]SimpleScraperOption{
+			WithBaseURL(ts.URL + "/shop/"),
+			WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/shop/.*`)},
+			WithSourceName("test"),
+			WithProcessor{Processor: NewSimpleProcessor(
+				WithBaseURL(ts.URL),
+				WithProductPathPrefix("/shop/products/"),
+			)},
+		}, opts...)...)
+	}
+
+	t.Run("respects robots.txt", func(t *testing.T) {
+		visited = nil
+		rec := recorder.NewMemoryRecorder()
+
+		require.NoError(t, newScraper().Scrape(context.Background(), WithRecorder{Recorder: rec}))
+
+		assert.NotContains(t, visited, "/shop/private/products/secret")
+		assert.Equal(t, []recorder.Product{{
+			Source: "test",
+			Name:   "pelikan-m800",
+			URL:    ts.URL + "/shop/products/pelikan-m800",
+		}}, rec.Products())
+	})
+
+	t.Run("robots.txt can be ignored", func(t *testing.T) {
+		visited = nil
+
+		require.NoError(t, newScraper(WithIgnoreRobotsTxt(true)).Scrape(context.Background(), WithRecorder{Recorder: recorder.NewMemoryRecorder()}))
+
+		assert.Contains(t, visited, "/shop/private/products/secret")
+	})
+}
+
+func TestSimpleScraperCrawlDelayParallelism(t *testing.T) {
+	for name, tc := range map[string]struct {
+		robots   string
+		parallel bool
+	}{
+		"crawl delay serializes requests": {robots: "User-agent: *\nCrawl-delay: 0.01\n"},
+		"no crawl delay":                  {robots: "User-agent: *\nAllow: /\n", parallel: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var inFlight, peak atomic.Int32
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+				fmt.Fprint(w, tc.robots)
+			})
+			mux.HandleFunc("/shop/", func(w http.ResponseWriter, _ *http.Request) {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+
+				for {
+					old := peak.Load()
+					if current <= old || peak.CompareAndSwap(old, current) {
+						break
+					}
+				}
+
+				time.Sleep(50 * time.Millisecond)
+
+				fmt.Fprint(w, `<html><body>
+					<a href="/shop/a">A</a>
+					<a href="/shop/b">B</a>
+					<a href="/shop/c">C</a>
+					<a href="/shop/d">D</a>
+				</body></html>`)
+			})
+
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+
+			scraper := NewSimpleScraper(
+				WithBaseURL(ts.URL+"/shop/"),
+				WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/shop/.*`)},
+				WithSourceName("test"),
+				WithProcessor{Processor: NewSimpleProcessor(WithBaseURL(ts.URL))},
+				WithParallelism(4),
+			)
+
+			require.NoError(t, scraper.Scrape(context.Background(), WithRecorder{Recorder: recorder.NewMemoryRecorder()}))
+
+			if tc.parallel {
+				assert.Greater(t, peak.Load(), int32(1))
+			} else {
+				assert.Equal(t, int32(1), peak.Load())
+			}
+		})
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "User-agent: pen-finder\nCrawl-delay: 5\n\nUser-agent: *\nCrawl-delay: 1\n")
+	}))
+	defer ts.Close()
+
+	delay, err := robotsCrawlDelay(context.Background(), ts.Client(), ts.URL+"/collections/pens", "pen-finder")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, delay)
+
+	delay, err = robotsCrawlDelay(context.Background(), ts.Client(), ts.URL, "other")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestSimpleScraperRetries(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		attempts = make(map[string]int)
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shop/", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<html><body>
+			<a href="/shop/products/flaky">Flaky</a>
+			<a href="/shop/products/busy">Busy</a>
+			<a href="/shop/products/missing">Missing</a>
+		</body></html>`)
+	})
+	mux.HandleFunc("/shop/products/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		lock.Unlock()
+
+		switch r.URL.Path {
+		case "/shop/products/flaky":
+			if attempt < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+		case "/shop/products/busy":
+			if attempt < 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+
+				return
+			}
+		case "/shop/products/missing":
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		fmt.Fprint(w, `<html></html>`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newScraper := func(policy RetryPolicy) *SimpleScraper {
+		return NewSimpleScraper(
+			WithBaseURL(ts.URL+"/shop/"),
+			WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/shop/.*`)},
+			WithSourceName("test"),
+			WithIgnoreRobotsTxt(true),
+			WithRetryPolicy(policy),
+			WithProcessor{Processor: NewSimpleProcessor(
+				WithBaseURL(ts.URL),
+				WithProductPathPrefix("/shop/products/"),
+			)},
+		)
+	}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		attempts = make(map[string]int)
+
+		require.NoError(t, newScraper(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}).
+			Scrape(context.Background(), WithRecorder{Recorder: recorder.NewMemoryRecorder()}))
+
+		assert.Equal(t, 3, attempts["/shop/products/flaky"])
+		assert.Equal(t, 2, attempts["/shop/products/busy"])
+		assert.Equal(t, 1, attempts["/shop/products/missing"], "client errors are not retried")
+	})
+
+	t.Run("error budget aborts the scrape", func(t *testing.T) {
+		attempts = make(map[string]int)
+
+		err := newScraper(RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond, ErrorBudget: 1}).
+			Scrape(context.Background(), WithRecorder{Recorder: recorder.NewMemoryRecorder()})
+
+		assert.ErrorIs(t, err, ErrErrorBudgetExhausted)
+	})
+
+	t.Run("pending retries end with the context", func(t *testing.T) {
+		attempts = make(map[string]int)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		err := newScraper(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}).
+			Scrape(ctx, WithRecorder{Recorder: recorder.NewMemoryRecorder()})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Second, "the scrape does not sit out the backoff")
+		assert.Equal(t, 1, attempts["/shop/products/flaky"])
+	})
+}
+
+func TestSimpleScraperPagination(t *testing.T) {
+	const pages = 3
+
+	var (
+		lock     sync.Mutex
+		requests []string
+	)
+
+	products := func(page int) []string {
+		if page < 1 || page > pages {
+			return nil
+		}
+
+		return []string{fmt.Sprintf("/shop/products/pen-%d-a", page), fmt.Sprintf("/shop/products/pen-%d-b", page)}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shop/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		lock.Unlock()
+
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+
+		fmt.Fprint(w, `<html><body>`)
+		for _, href := range products(page) {
+			// the same product linked twice with a fragment is recorded once
+			fmt.Fprintf(w, `<a href="%s">Pen</a><a href="%s#reviews">Reviews</a>`, href, href)
+		}
+		// sort permutations of the listing are not followed
+		fmt.Fprintf(w, `<a href="/shop/?sort=price&page=%d">Sort</a>`, page)
+		if page < pages {
+			fmt.Fprintf(w, `<a rel="next" href="/shop/?page=%d&utm_source=listing">Next</a>`, page+1)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	})
+	mux.HandleFunc("/api/products", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		lock.Unlock()
+
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page)
+
+		items := make([]map[string]string, 0, 2)
+		for _, href := range products(page) {
+			items = append(items, map[string]string{"url": href})
+		}
+
+		var cursor string
+		if page < pages {
+			cursor = fmt.Sprint(page + 1)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"products": items, "next_cursor": cursor},
+		}))
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name       string
+		baseURL    string
+		pagination Pagination
+		maxDepth   int
+		requests   []string
+		products   int
+	}{
+		{
+			name:       "next link",
+			baseURL:    "/shop/",
+			pagination: NextLinkPagination{},
+			requests:   []string{"/shop/", "/shop/?page=2", "/shop/?page=3"},
+			products:   6,
+		},
+		{
+			name:       "page number",
+			baseURL:    "/shop/",
+			pagination: PageNumberPagination{},
+			requests:   []string{"/shop/", "/shop/?page=2", "/shop/?page=3", "/shop/?page=4"},
+			products:   6,
+		},
+		{
+			name:       "page number limit",
+			baseURL:    "/shop/",
+			pagination: PageNumberPagination{MaxPages: 2},
+			requests:   []string{"/shop/", "/shop/?page=2"},
+			products:   4,
+		},
+		{
+			name:       "depth limit",
+			baseURL:    "/shop/",
+			pagination: NextLinkPagination{},
+			maxDepth:   2,
+			requests:   []string{"/shop/", "/shop/?page=2"},
+			products:   4,
+		},
+		{
+			name:    "json cursor",
+			baseURL: "/api/products",
+			pagination: JSONCursorPagination{
+				ItemsField:  "data.products",
+				CursorField: "data.next_cursor",
+			},
+			requests: []string{"/api/products", "/api/products?cursor=2", "/api/products?cursor=3"},
+			products: 6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = nil
+
+			rec := recorder.NewMemoryRecorder()
+			require.NoError(t, NewSimpleScraper(
+				WithBaseURL(ts.URL+tc.baseURL),
+				WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/(shop|api)/.*`)},
+				WithSourceName("test"),
+				WithIgnoreRobotsTxt(true),
+				WithPagination{Pagination: tc.pagination},
+				WithProcessor{Processor: NewSimpleProcessor(
+					WithBaseURL(ts.URL),
+					WithProductPathPrefix("/shop/products/"),
+				)},
+			).Scrape(context.Background(), WithRecorder{Recorder: rec}, WithMaxDepth(tc.maxDepth)))
+
+			assert.ElementsMatch(t, tc.requests, requests, "product pages and listing variants are not visited")
+			assert.Len(t, rec.Products(), tc.products)
+		})
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	for in, expected := range map[string]string{
+		"HTTPS://Shop.example:443/pens?page=2#top":          "https://shop.example/pens?page=2",
+		"https://shop.example/pens?utm_source=x&page=2&b=1": "https://shop.example/pens?b=1&page=2",
+		"http://shop.example:80/pens?page=":                 "http://shop.example/pens",
+		"http://shop.example:8080/pens?page=2&page=3":       "http://shop.example:8080/pens?page=2&page=3",
+	} {
+		actual, err := normalizeURL(in)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, in)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for in, expected := range map[string]string{
+		"https://shop.example/products/foo":                          "https://shop.example/products/foo",
+		"https://shop.example/products/foo/":                         "https://shop.example/products/foo",
+		"https://Shop.Example/Products/Foo?variant=123":              "https://shop.example/Products/Foo",
+		"https://shop.example/collections/x/products/foo?_pos=1":     "https://shop.example/products/foo",
+		"https://shop.example/collections/x/products/foo#details":    "https://shop.example/products/foo",
+		"https://shop.example/collections/x?utm_medium=email&page=2": "https://shop.example/collections/x?page=2",
+		"https://shop.example/product/foo/?fbclid=abc":               "https://shop.example/product/foo",
+		"https://shop.example/":                                      "https://shop.example/",
+	} {
+		actual, err := Canonicalize(in)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, in)
+	}
+}
+
+func TestCanonicalKey(t *testing.T) {
+	for in, expected := range map[string]string{
+		"https://shop.example/products/foo":                         "https://shop.example/products/foo",
+		"https://Shop.Example/Products/Foo?variant=123":             "https://shop.example/products/foo",
+		"https://shop.example/Collections/X/Products/Foo/?_pos=1":   "https://shop.example/products/foo",
+		"https://shop.example/collections/x?utm_medium=email&q=Ink": "https://shop.example/collections/x?q=Ink",
+	} {
+		actual, err := CanonicalKey(in)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, in)
+	}
+}
+
+func TestSimpleProcessorProducts(t *testing.T) {
+	for name, tc := range map[string]struct {
+		prefix   string
+		href     string
+		expected ProcessResult
+	}{
+		"collection scoped link": {
+			prefix:   "/collections/pens/products/",
+			href:     "/collections/pens/products/Pelikan-M800/",
+			expected: ProcessResult{HREF: "https://shop.example/products/Pelikan-M800", Product: "Pelikan-M800"},
+		},
+		"prefix matched ignoring case": {
+			prefix:   "/collections/pens/products/",
+			href:     "/Collections/Pens/products/pelikan-m800?variant=1",
+			expected: ProcessResult{HREF: "https://shop.example/products/pelikan-m800", Product: "pelikan-m800"},
+		},
+		"link outside the collection": {
+			prefix:   "/collections/pens/products/",
+			href:     "/products/pelikan-m800",
+			expected: ProcessResult{HREF: "https://shop.example/products/pelikan-m800"},
+		},
+		"collection scoped link outside the prefix": {
+			prefix:   "/products/",
+			href:     "https://shop.example/collections/pens/products/pelikan-m800?variant=1",
+			expected: ProcessResult{HREF: "https://shop.example/products/pelikan-m800"},
+		},
+		"listing": {
+			prefix:   "/collections/pens/products/",
+			href:     "/collections/pens?page=2",
+			expected: ProcessResult{HREF: "https://shop.example/collections/pens?page=2"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var visited []string
+
+			res, err := NewSimpleProcessor(
+				WithBaseURL("https://shop.example"),
+				WithProductPathPrefix(tc.prefix),
+			).ProcessHREF(visitorFunc(func(link string) error {
+				visited = append(visited, link)
+
+				return nil
+			}), tc.href)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, res)
+			assert.Len(t, visited, 1, "the link is visited as written")
+		})
+	}
+}
+
+type visitorFunc func(string) error
+
+func (f visitorFunc) Visit(link string) error { return f(link) }
+
+func TestSimpleScraperDeduplicatesProducts(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		visited []string
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/collections/pens", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<html><body>
+			<a href="/collections/pens/products/Pelikan-M800">Pelikan</a>
+			<a href="/collections/pens/products/Pelikan-M800/">Pelikan</a>
+			<a href="/collections/pens/products/pelikan-m800?variant=123">Pelikan Green</a>
+			<a href="/collections/pens/products/Pelikan-M800?utm_source=newsletter#reviews">Reviews</a>
+			<a href="/products/sailor-1911">You may also like</a>
+		</body></html>`)
+	})
+	mux.HandleFunc("/collections/pens/products/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		visited = append(visited, r.URL.RequestURI())
+		lock.Unlock()
+
+		fmt.Fprint(w, `<html></html>`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for name, pagination := range map[string]Pagination{
+		"following links": nil,
+		"paginating":      PageNumberPagination{MaxPages: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			visited = nil
+
+			rec := recorder.NewMemoryRecorder()
+			require.NoError(t, NewSimpleScraper(
+				WithBaseURL(ts.URL+"/collections/pens"),
+				WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/collections/pens.*`)},
+				WithSourceName("test"),
+				WithIgnoreRobotsTxt(true),
+				WithPagination{Pagination: pagination},
+				WithProcessor{Processor: NewSimpleProcessor(
+					WithBaseURL(ts.URL),
+					WithProductPathPrefix("/collections/pens/products/"),
+				)},
+			).Scrape(context.Background(), WithRecorder{Recorder: rec}))
+
+			assert.Equal(t, []recorder.Product{{
+				Source: "test",
+				Name:   "Pelikan-M800",
+				URL:    ts.URL + "/products/Pelikan-M800",
+			}}, rec.Products(), "products outside the collection are not recorded and the case of paths is kept")
+			assert.LessOrEqual(t, len(visited), 1, "variants of a product are visited at most once")
+		})
+	}
+}
+
+func TestSimpleScraperSitemap(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		visited  []string
+		lastmods = map[string]string{
+			"pelikan-m800": "2024-03-01",
+			"sailor-1911":  "2024-03-02T10:00:00+09:00",
+			"pilot-823":    "",
+		}
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://%s/sitemap_products_1.xml.gz</loc></sitemap>
+</sitemapindex>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap_products_1.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		var buf bytes.Buffer
+		fmt.Fprint(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://`+r.Host+`/pages/about</loc></url>`)
+		for _, handle := range []string{"pelikan-m800", "pilot-823", "sailor-1911"} {
+			fmt.Fprintf(&buf, "\n  <url><loc>http://%s/products/%s</loc><lastmod>%s</lastmod></url>", r.Host, handle, lastmods[handle])
+		}
+		fmt.Fprint(&buf, "\n</urlset>")
+
+		w.Header().Set("Content-Type", "application/x-gzip")
+
+		zw := gzip.NewWriter(w)
+		_, err := zw.Write(buf.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+	})
+	mux.HandleFunc("/products/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		visited = append(visited, r.URL.Path)
+		lock.Unlock()
+
+		fmt.Fprint(w, `<html></html>`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	statePath := filepath.Join(t.TempDir(), "sitemap.json")
+
+	scrape := func(t *testing.T) []recorder.Product {
+		t.Helper()
+
+		visited = nil
+
+		state, err := NewFileSitemapState(statePath)
+		require.NoError(t, err)
+
+		rec := recorder.NewMemoryRecorder()
+		require.NoError(t, NewSimpleScraper(
+			WithBaseURL(ts.URL+"/collections/all"),
+			// sitemaps on the shop's host are fetched without a filter
+			WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/products/.*`)},
+			WithSourceName("test"),
+			WithIgnoreRobotsTxt(true),
+			// shopify sitemaps list products outside the collection
+			WithSitemap{Sitemap: SitemapDiscovery{ProductPathPrefix: "/products/", State: state}},
+			WithProcessor{Processor: NewSimpleProcessor(
+				WithBaseURL(ts.URL),
+				WithProductPathPrefix("/collections/all/products/"),
+			)},
+		).Scrape(context.Background(), WithRecorder{Recorder: rec}))
+
+		return rec.Products()
+	}
+
+	t.Run("first run visits every product", func(t *testing.T) {
+		products := scrape(t)
+
+		assert.Len(t, products, 3)
+		assert.ElementsMatch(t, []string{"/products/pelikan-m800", "/products/pilot-823", "/products/sailor-1911"}, visited)
+	})
+
+	t.Run("unchanged products are recorded without a visit", func(t *testing.T) {
+		lock.Lock()
+		lastmods["sailor-1911"] = "2024-04-01T08:30Z"
+		lock.Unlock()
+
+		products := scrape(t)
+
+		assert.ElementsMatch(t, []recorder.Product{
+			{Source: "test", Name: "pelikan-m800", URL: ts.URL + "/products/pelikan-m800"},
+			{Source: "test", Name: "pilot-823", URL: ts.URL + "/products/pilot-823"},
+			{Source: "test", Name: "sailor-1911", URL: ts.URL + "/products/sailor-1911"},
+		}, products)
+		assert.ElementsMatch(t, []string{"/products/pilot-823", "/products/sailor-1911"}, visited, "products without a lastmod are always visited")
+	})
+}
+
+func TestFeedScraper(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		items = []string{
+			`<item><guid isPermaLink="false">fpn-1001</guid><title>WTS: Pelikan M800 Green Stripe</title><link>https://forum.example/topic/1001-pelikan/?utm_source=rss</link></item>`,
+			`<item><title>WTS: Sailor 1911 Large</title><link>https://forum.example/topic/1002-sailor/</link></item>`,
+		}
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, _ *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Classifieds</title>%s</channel></rss>`, strings.Join(items, ""))
+	})
+	mux.HandleFunc("/atom", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Marketplace</title>
+  <entry>
+    <id>tag:market.example,2024:listing-7</id>
+    <title>Nakaya Portable Writer</title>
+    <link rel="replies" href="https://market.example/listing/7#comments"/>
+    <link rel="alternate" href="https://market.example/listing/7"/>
+  </entry>
+</feed>`)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	statePath := filepath.Join(t.TempDir(), "feed.json")
+
+	scrape := func(t *testing.T, feeds ...string) ([]recorder.Product, error) {
+		t.Helper()
+
+		state, err := NewFileFeedState(statePath)
+		require.NoError(t, err)
+
+		urls := make([]string, 0, len(feeds))
+		for _, feed := range feeds {
+			urls = append(urls, ts.URL+feed)
+		}
+
+		rec := recorder.NewMemoryRecorder()
+		err = NewFeedScraper(
+			WithFeedURLs(urls),
+			WithSourceName("classifieds"),
+			WithFeedState{State: state},
+		).Scrape(context.Background(), WithRecorder{Recorder: rec})
+
+		return rec.Products(), err
+	}
+
+	t.Run("entries are recorded", func(t *testing.T) {
+		products, err := scrape(t, "/rss", "/atom")
+		require.NoError(t, err)
+
+		assert.Equal(t, []recorder.Product{
+			{Source: "classifieds", Name: "WTS: Pelikan M800 Green Stripe", URL: "https://forum.example/topic/1001-pelikan"},
+			{Source: "classifieds", Name: "WTS: Sailor 1911 Large", URL: "https://forum.example/topic/1002-sailor"},
+			{Source: "classifieds", Name: "Nakaya Portable Writer", URL: "https://market.example/listing/7"},
+		}, products)
+	})
+
+	t.Run("seen entries are skipped", func(t *testing.T) {
+		lock.Lock()
+		items = append(items, `<item><guid>fpn-1003</guid><title>WTS: Pilot Custom 823</title><link>https://forum.example/topic/1003-pilot/</link></item>`)
+		lock.Unlock()
+
+		products, err := scrape(t, "/rss", "/atom")
+		require.NoError(t, err)
+
+		assert.Equal(t, []recorder.Product{
+			{Source: "classifieds", Name: "WTS: Pilot Custom 823", URL: "https://forum.example/topic/1003-pilot"},
+		}, products)
+	})
+
+	t.Run("listed entries outlive the retention", func(t *testing.T) {
+		state, err := NewFileFeedState(statePath, WithFeedRetention(time.Hour))
+		require.NoError(t, err)
+
+		state.seen["fpn-1001"] = time.Now().Add(-2 * time.Hour)
+		state.seen["fpn-0001"] = time.Now().Add(-2 * time.Hour)
+
+		rec := recorder.NewMemoryRecorder()
+		require.NoError(t, NewFeedScraper(
+			WithFeedURLs{ts.URL + "/rss"},
+			WithSourceName("classifieds"),
+			WithFeedState{State: state},
+		).Scrape(context.Background(), WithRecorder{Recorder: rec}))
+		assert.Empty(t, rec.Products())
+
+		saved, err := NewFileFeedState(statePath)
+		require.NoError(t, err)
+		assert.True(t, saved.Seen("fpn-1001"), "entries still listed are kept")
+		assert.False(t, saved.Seen("fpn-0001"), "entries no longer listed are pruned")
+	})
+
+	t.Run("failing feeds do not block others", func(t *testing.T) {
+		require.NoError(t, os.Remove(statePath))
+
+		products, err := scrape(t, "/missing", "/atom")
+		assert.Error(t, err)
+		assert.Len(t, products, 1)
+	})
+}
+
+func TestFeedStatePrune(t *testing.T) {
+	state := NewMemoryFeedState(WithFeedRetention(time.Hour), WithMaxFeedEntries(2))
+
+	for _, guid := range []string{"expired", "oldest", "older", "newest"} {
+		state.MarkSeen(guid)
+	}
+
+	now := time.Now()
+	state.seen["expired"] = now.Add(-2 * time.Hour)
+	state.seen["oldest"] = now.Add(-30 * time.Minute)
+	state.seen["older"] = now.Add(-10 * time.Minute)
+
+	require.NoError(t, state.Save())
+
+	assert.False(t, state.Seen("expired"), "entries beyond the retention are pruned")
+	assert.False(t, state.Seen("oldest"), "the least recently seen entries are pruned beyond the maximum")
+	assert.True(t, state.Seen("older"))
+	assert.True(t, state.Seen("newest"))
+}
+
+func TestSimpleScraperProductDetails(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shop/", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<html><body>
+			<header><a href="/cart">Cart $0.00</a></header>
+			<div class="grid">
+				<div class="card">
+					<a href="/shop/products/pelikan-m800"><img src="m800.jpg"></a>
+					<h3><a href="/shop/products/pelikan-m800">Pelikan M800</a></h3>
+					<span class="regular">$1,150.00</span> <span class="sale">$980.00</span>
+					<a href="/cart/add?id=1">Add to cart</a>
+				</div>
+				<div class="card">
+					<h3><a href="/shop/products/sailor-1911">Sailor 1911</a></h3>
+					<span>$240</span> <span class="badge">Sold out</span>
+				</div>
+				<div class="card">
+					<h3><a href="/shop/products/mystery-pen">Mystery Pen</a></h3>
+				</div>
+			</div>
+		</body></html>`)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	rec := recorder.NewMemoryRecorder()
+	require.NoError(t, NewSimpleScraper(
+		WithBaseURL(ts.URL+"/shop/"),
+		WithFilters{regexp.MustCompile(regexp.QuoteMeta(ts.URL) + `/shop/.*`)},
+		WithSourceName("test"),
+		WithIgnoreRobotsTxt(true),
+		WithPagination{Pagination: NextLinkPagination{}},
+		WithProcessor{Processor: NewSimpleProcessor(
+			WithBaseURL(ts.URL),
+			WithProductPathPrefix("/shop/products/"),
+		)},
+	).Scrape(context.Background(), WithRecorder{Recorder: rec}))
+
+	products := rec.Products()
+	slices.SortFunc(products, func(a, b recorder.Product) int { return strings.Compare(a.Name, b.Name) })
+
+	assert.Equal(t, []recorder.Product{
+		{Source: "test", Name: "mystery-pen", URL: ts.URL + "/shop/products/mystery-pen"},
+		{Source: "test", Name: "pelikan-m800", URL: ts.URL + "/shop/products/pelikan-m800", Price: 980, Availability: recorder.AvailabilityInStock},
+		{Source: "test", Name: "sailor-1911", URL: ts.URL + "/shop/products/sailor-1911", Price: 240, Availability: recorder.AvailabilitySoldOut},
+	}, products)
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	breakers := NewCircuitBreakers(WithFailureThreshold(2), WithCooldown(50*time.Millisecond))
+
+	var (
+		calls int
+		fail  = true
+	)
+
+	sc := breakers.Wrap("shop", scrapeFunc(func(context.Context) error {
+		calls++
+		if fail {
+			return fmt.Errorf("shop is down")
+		}
+
+		return nil
+	}))
+
+	var skipped []Event
+	events := WithEventHandler{Handler: EventHandlerFunc(func(e Event) {
+		if e.Type == EventScraperSkipped {
+			skipped = append(skipped, e)
+		}
+	})}
+
+	ctx := context.Background()
+
+	require.Error(t, sc.Scrape(ctx, events))
+	require.Error(t, sc.Scrape(ctx, events))
+	assert.Equal(t, CircuitOpen, breakers.Health()[0].State)
+	assert.Equal(t, 2, breakers.Health()[0].ConsecutiveFailures)
+
+	require.ErrorIs(t, sc.Scrape(ctx, events), ErrCircuitOpen)
+	assert.Equal(t, 2, calls, "open circuits skip the scraper")
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "shop", skipped[0].Source)
+
+	time.Sleep(60 * time.Millisecond)
+
+	assert.Equal(t, CircuitHalfOpen, breakers.Health()[0].State, "an elapsed cool-down is reported before the probe")
+
+	require.Error(t, sc.Scrape(ctx, events))
+	assert.Equal(t, 3, calls, "the cool-down allows a probe")
+	assert.Equal(t, CircuitOpen, breakers.Health()[0].State, "a failed probe reopens the circuit")
+
+	time.Sleep(60 * time.Millisecond)
+
+	fail = false
+
+	require.NoError(t, sc.Scrape(ctx, events))
+	assert.Equal(t, SourceHealth{Source: "shop", State: CircuitClosed, LastError: "shop is down", LastFailure: breakers.Health()[0].LastFailure}, breakers.Health()[0])
+}
+
+type scrapeFunc func(context.Context) error
+
+func (f scrapeFunc) Scrape(ctx context.Context, _ ...ScrapeOption) error {
+	return f(ctx)
+}
@@ -0,0 +1,318 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// SitemapDiscovery finds products through the sitemaps a shop publishes
+// rather than its listing pages. Only products which are new or whose
+// lastmod changed since they were last visited are visited; the others are
+// recorded from the sitemap alone. Products listed without a lastmod are
+// always visited.
+type SitemapDiscovery struct {
+	// URLs of sitemaps or sitemap indexes. Defaults to /sitemap.xml on the
+	// host of the scraper's base URL. Sitemaps on that host or listed here
+	// are fetched regardless of the scraper's filters while the products
+	// they list must match them.
+	URLs []string
+	// ProductPathPrefix of the products listed in the sitemaps defaults to
+	// the one of the scraper's processor. Shopify sitemaps list products
+	// under /products/ rather than the collection a scraper is limited to.
+	ProductPathPrefix string
+	// State remembers lastmod dates between runs. Without it every product
+	// in the sitemaps is visited.
+	State SitemapState
+}
+
+// SitemapState stores the lastmod of visited products keyed by canonical URL.
+type SitemapState interface {
+	Lastmod(url string) (time.Time, bool)
+	SetLastmod(url string, lastmod time.Time)
+	Save() error
+}
+
+const (
+	ctxSitemapKind    = "sitemapKind"
+	ctxSitemapLastmod = "sitemapLastmod"
+
+	sitemapKindSitemap = "sitemap"
+	sitemapKindProduct = "product"
+)
+
+func (s *SimpleScraper) discover(recordProduct func(ProcessResult, ProductDetails), reportErr func(error)) error {
+	discovery := s.cfg.Sitemap
+
+	sitemaps := discovery.URLs
+	if len(sitemaps) < 1 {
+		base, err := url.Parse(s.cfg.BaseURL)
+		if err != nil {
+			return fmt.Errorf("parsing base URL: %w", err)
+		}
+
+		sitemaps = []string{(&url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	processor := s.cfg.Processor
+	if discovery.ProductPathPrefix != "" {
+		processor = NewSimpleProcessor(WithBaseURL(s.cfg.BaseURL), WithProductPathPrefix(discovery.ProductPathPrefix))
+	}
+
+	seen := newCanonicalSet()
+
+	visit := func(link, kind string, lastmod time.Time) error {
+		if first, err := seen.Add(link); err != nil || !first {
+			return err
+		}
+
+		ctx := colly.NewContext()
+		ctx.Put(ctxSitemapKind, kind)
+		ctx.Put(ctxSitemapLastmod, lastmod)
+
+		if err := s.collector.Request("GET", link, nil, ctx, nil); err != nil && !errors.Is(err, colly.ErrAlreadyVisited) {
+			return fmt.Errorf("visiting %s: %w", link, err)
+		}
+
+		return nil
+	}
+
+	s.collector.OnResponse(func(r *colly.Response) {
+		switch r.Ctx.Get(ctxSitemapKind) {
+		case sitemapKindSitemap:
+			doc, err := parseSitemap(r.Body)
+			if err != nil {
+				reportErr(fmt.Errorf("parsing sitemap %s: %w", r.Request.URL, err))
+
+				return
+			}
+
+			for _, entry := range doc.Sitemaps {
+				if err := visit(entry.Loc, sitemapKindSitemap, time.Time{}); err != nil {
+					reportErr(err)
+				}
+			}
+
+			for _, entry := range doc.URLs {
+				res, err := processor.ProcessHREF(discardVisitor{}, entry.Loc)
+				if err != nil {
+					reportErr(fmt.Errorf("processing link: %w", err))
+
+					continue
+				}
+				if res.Product == "" {
+					continue
+				}
+
+				lastmod := entry.lastmod()
+				// without a lastmod there is no telling whether the product changed
+				if known, ok := discovery.State.Lastmod(res.HREF); ok && !lastmod.IsZero() && !lastmod.After(known) {
+					// unchanged products are still listed so they are
+					// recorded as seen without fetching them again
+					if s.matchesFilters(entry.Loc) {
+						recordProduct(res, ProductDetails{})
+					}
+
+					continue
+				}
+
+				if err := visit(entry.Loc, sitemapKindProduct, lastmod); err != nil && !errors.Is(err, colly.ErrNoURLFiltersMatch) {
+					reportErr(err)
+				}
+			}
+		case sitemapKindProduct:
+			res, err := processor.ProcessHREF(discardVisitor{}, r.Request.URL.String())
+			if err != nil {
+				reportErr(fmt.Errorf("processing link: %w", err))
+
+				return
+			}
+
+			recordProduct(res, ProductDetails{})
+
+			lastmod, _ := r.Ctx.GetAny(ctxSitemapLastmod).(time.Time)
+			discovery.State.SetLastmod(res.HREF, lastmod)
+		}
+	})
+
+	var errs []error
+	for _, sitemap := range sitemaps {
+		if err := visit(sitemap, sitemapKindSitemap, time.Time{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// matchesFilters mirrors the URL filters of the collector for links which
+// are not requested.
+func (s *SimpleScraper) matchesFilters(link string) bool {
+	if len(s.cfg.Filters) < 1 {
+		return true
+	}
+
+	return slices.ContainsFunc(s.cfg.Filters, func(re *regexp.Regexp) bool {
+		return re.MatchString(link)
+	})
+}
+
+// sitemapFilters match the sitemaps discovery may fetch, i.e. the
+// configured ones and any sitemap on the host of baseURL.
+func sitemapFilters(baseURL string, discovery SitemapDiscovery) []*regexp.Regexp {
+	var filters []*regexp.Regexp
+
+	if base, err := url.Parse(baseURL); err == nil && base.Host != "" {
+		host := regexp.QuoteMeta(base.Scheme + "://" + base.Host)
+		filters = append(filters, regexp.MustCompile(`^`+host+`/sitemap[^/]*\.xml(\.gz)?(\?.*)?$`))
+	}
+
+	for _, u := range discovery.URLs {
+		filters = append(filters, regexp.MustCompile(`^`+regexp.QuoteMeta(u)+`$`))
+	}
+
+	return filters
+}
+
+// sitemapDocument decodes both <urlset> sitemaps and <sitemapindex> indexes.
+type sitemapDocument struct {
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+	URLs     []sitemapEntry `xml:"url"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod"`
+}
+
+// lastmod parses the W3C datetime subset allowed by the sitemap protocol.
+// Missing or malformed dates are treated as unknown.
+func (e sitemapEntry) lastmod() time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly} {
+		if t, err := time.Parse(layout, strings.TrimSpace(e.Lastmod)); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func parseSitemap(body []byte) (sitemapDocument, error) {
+	// .xml.gz sitemaps are served as gzip files rather than gzip encoded
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return sitemapDocument{}, fmt.Errorf("decompressing: %w", err)
+		}
+		defer zr.Close()
+
+		if body, err = io.ReadAll(zr); err != nil {
+			return sitemapDocument{}, fmt.Errorf("decompressing: %w", err)
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return sitemapDocument{}, fmt.Errorf("decoding: %w", err)
+	}
+
+	for i := range doc.Sitemaps {
+		doc.Sitemaps[i].Loc = strings.TrimSpace(doc.Sitemaps[i].Loc)
+	}
+	for i := range doc.URLs {
+		doc.URLs[i].Loc = strings.TrimSpace(doc.URLs[i].Loc)
+	}
+
+	return doc, nil
+}
+
+func NewMemorySitemapState() *MemorySitemapState {
+	return &MemorySitemapState{
+		lock:     &sync.RWMutex{},
+		lastmods: make(map[string]time.Time),
+	}
+}
+
+type MemorySitemapState struct {
+	lock     *sync.RWMutex
+	lastmods map[string]time.Time
+}
+
+func (s *MemorySitemapState) Lastmod(url string) (time.Time, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	t, ok := s.lastmods[url]
+
+	return t, ok
+}
+
+func (s *MemorySitemapState) SetLastmod(url string, lastmod time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastmods[url] = lastmod
+}
+
+func (s *MemorySitemapState) Save() error {
+	return nil
+}
+
+// NewFileSitemapState loads state previously saved to path. A missing file
+// yields an empty state.
+func NewFileSitemapState(path string) (*FileSitemapState, error) {
+	s := &FileSitemapState{
+		MemorySitemapState: NewMemorySitemapState(),
+		path:               path,
+	}
+
+	if err := readJSONFile(path, &s.lastmods); err != nil {
+		return nil, fmt.Errorf("loading sitemap state: %w", err)
+	}
+
+	return s, nil
+}
+
+// DefaultSitemapStateDir is where sitemap state is kept unless configured
+// otherwise. Losing it only means every product is visited once more.
+func DefaultSitemapStateDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "pen-finder", "sitemap"), nil
+}
+
+type FileSitemapState struct {
+	*MemorySitemapState
+	path string
+}
+
+func (s *FileSitemapState) Save() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if err := writeJSONFile(s.path, s.lastmods); err != nil {
+		return fmt.Errorf("saving sitemap state: %w", err)
+	}
+
+	return nil
+}
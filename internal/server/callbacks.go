@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const callbackDeliveryTimeout = 10 * time.Minute
+
+func (s *DefaultServer) validateCallbackURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: parsing callback URL: %w", ErrInvalidRunRequest, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: callback URL must be an absolute http or https URL", ErrInvalidRunRequest)
+	}
+
+	if err := s.cfg.Webhooks.CheckURL(u); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRunRequest, err)
+	}
+
+	return nil
+}
+
+func (s *DefaultServer) addCallback(id uuid.UUID, d webhook.Delivery) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.callbacks[id] = append(s.callbacks[id], d)
+}
+
+func (s *DefaultServer) notifyCallbacks(id uuid.UUID) {
+	s.lock.Lock()
+	deliveries := s.callbacks[id]
+	delete(s.callbacks, id)
+	s.lock.Unlock()
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	entry, ok := s.cfg.Cache.Get(id)
+	if !ok {
+		return
+	}
+
+	for _, d := range deliveries {
+		d.Payload = entry.Response()
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), callbackDeliveryTimeout)
+			defer cancel()
+
+			if err := s.cfg.Webhooks.Send(ctx, d); err != nil {
+				s.cfg.Logger.Error(err, "delivering run callback", "runID", id)
+			}
+		}()
+	}
+}
@@ -0,0 +1,306 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/fakeshop"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndToEnd(t *testing.T) {
+	shops := map[api.Scraper]*fakeshop.Shop{
+		api.ScraperTruphae:   newBuiltinShop(api.ScraperTruphae, fakeshop.WithProducts(25), fakeshop.WithPageSize(10)),
+		api.ScraperChatterly: newBuiltinShop(api.ScraperChatterly, fakeshop.WithProducts(12), fakeshop.WithPageSize(5)),
+		api.ScraperFPH:       newBuiltinShop(api.ScraperFPH, fakeshop.WithProducts(7), fakeshop.WithPageSize(3)),
+	}
+	for _, shop := range shops {
+		defer shop.Close()
+	}
+
+	rec := recorder.NewMemoryRecorder()
+	srv := newShopServer(shops, rec, scraper.RetryPolicy{})
+
+	run := runToCompletion(t, srv, api.PostRunRequest{})
+	assert.Equal(t, api.RunStatusSuccess, run.Status)
+	assert.Equal(t, map[api.Scraper]api.ScraperResult{
+		api.ScraperTruphae:   api.ScraperResultSuccess,
+		api.ScraperChatterly: api.ScraperResultSuccess,
+		api.ScraperFPH:       api.ScraperResultSuccess,
+	}, run.Results)
+
+	var expected []string
+	for _, shop := range shops {
+		for _, p := range shop.Products() {
+			expected = append(expected, p.URL)
+		}
+	}
+
+	assert.ElementsMatch(t, expected, productURLs(rec.Products()), "every product reaches the recorders")
+
+	res := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/products?limit=500", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var products api.GetProductsResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &products))
+
+	var cataloged []string
+	for _, p := range products.Products {
+		cataloged = append(cataloged, p.URL)
+	}
+
+	assert.ElementsMatch(t, expected, cataloged, "every product reaches the catalog")
+}
+
+func TestEndToEndFeed(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><item><guid>1001</guid><title>WTS: Pelikan M800</title><link>https://forum.example/topic/1001</link></item></channel></rss>`)
+	}))
+	defer feed.Close()
+
+	const name api.Scraper = "classifieds"
+
+	rec := recorder.NewMemoryRecorder()
+	srv := NewDefaultServer(
+		WithRunner{Runner: scraper.NewParallelRunner()},
+		WithRecorder{Recorder: rec},
+		WithScrapers([]api.Scraper{name}),
+		WithFeedScraperOptions{name: {
+			scraper.WithFeedURLs{feed.URL},
+			scraper.WithSourceName(name),
+		}},
+	)
+
+	run := runToCompletion(t, srv, api.PostRunRequest{Scrapers: []api.Scraper{name}})
+	assert.Equal(t, api.RunStatusSuccess, run.Status)
+	assert.Equal(t, map[api.Scraper]api.ScraperResult{name: api.ScraperResultSuccess}, run.Results)
+	assert.Equal(t, []string{"https://forum.example/topic/1001"}, productURLs(rec.Products()))
+}
+
+func TestEndToEndFaults(t *testing.T) {
+	retry := scraper.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		ErrorBudget:    5,
+	}
+
+	t.Run("transient listing faults are retried", func(t *testing.T) {
+		shop := newBuiltinShop(api.ScraperTruphae,
+			fakeshop.WithProducts(6),
+			fakeshop.WithPageSize(4),
+			fakeshop.WithFaults{
+				Latency:         5 * time.Millisecond,
+				TooManyRequests: 1,
+				ServerErrors:    1,
+				BrokenLinks:     2,
+			},
+		)
+		defer shop.Close()
+
+		rec := recorder.NewMemoryRecorder()
+		srv := newShopServer(map[api.Scraper]*fakeshop.Shop{api.ScraperTruphae: shop}, rec, retry)
+
+		run := runToCompletion(t, srv, api.PostRunRequest{Scrapers: []api.Scraper{api.ScraperTruphae}})
+		assert.Equal(t, api.RunStatusSuccess, run.Status)
+
+		for page := 1; page <= 2; page++ {
+			assert.Equal(t, 3, shop.Requests(shop.PagePath(page)), "page %d is fetched until it succeeds", page)
+		}
+
+		recorded := productURLs(rec.Products())
+		for _, p := range shop.Products() {
+			assert.Contains(t, recorded, p.URL)
+		}
+	})
+
+	t.Run("transient product faults are retried", func(t *testing.T) {
+		shop := newBuiltinShop(api.ScraperTruphae,
+			fakeshop.WithProducts(6),
+			fakeshop.WithPageSize(4),
+			fakeshop.WithFaults{
+				Latency:         5 * time.Millisecond,
+				TooManyRequests: 1,
+				ServerErrors:    1,
+				BrokenLinks:     2,
+			},
+		)
+		defer shop.Close()
+
+		rec := recorder.NewMemoryRecorder()
+		// product pages are only fetched when following links rather than paginating
+		srv := newShopServer(map[api.Scraper]*fakeshop.Shop{api.ScraperTruphae: shop}, rec, retry, scraper.WithPagination{})
+
+		run := runToCompletion(t, srv, api.PostRunRequest{Scrapers: []api.Scraper{api.ScraperTruphae}})
+		assert.Equal(t, api.RunStatusSuccess, run.Status, "broken links do not fail the run")
+
+		for _, p := range shop.Products() {
+			assert.Equal(t, 3, shop.Requests(shop.ProductPathPrefix()+p.Slug), "%s is fetched until it succeeds", p.Slug)
+		}
+
+		// broken links are recorded too as the links themselves look like products
+		recorded := productURLs(rec.Products())
+		for _, p := range shop.Products() {
+			assert.Contains(t, recorded, p.URL)
+		}
+	})
+
+	t.Run("persistent faults fail the run", func(t *testing.T) {
+		for _, name := range scraper.BuiltinNames() {
+			shop := newBuiltinShop(name,
+				fakeshop.WithProducts(2),
+				fakeshop.WithFaults{ServerErrors: retry.MaxAttempts},
+			)
+			defer shop.Close()
+
+			srv := newShopServer(map[api.Scraper]*fakeshop.Shop{name: shop}, recorder.NewMemoryRecorder(), retry)
+
+			run := runToCompletion(t, srv, api.PostRunRequest{Scrapers: []api.Scraper{name}})
+			assert.Equal(t, api.RunStatusFailed, run.Status, name)
+			assert.Equal(t, map[api.Scraper]api.ScraperResult{name: api.ScraperResultFailed}, run.Results, name)
+		}
+	})
+}
+
+// builtinShops lay out fake shops like the shops the builtin scrapers
+// crawl and render links with the shop's URL which is rewritten to the fake
+// shop by shopTransport.
+var builtinShops = map[api.Scraper][]fakeshop.Option{
+	api.ScraperChatterly: {
+		fakeshop.WithPublicURL("https://chatterleyluxuries.com"),
+		fakeshop.WithLayout(fakeshop.LayoutWooCommerce),
+		fakeshop.WithCollectionPath("/product-category/pens/consignments/"),
+	},
+	api.ScraperFPH: {
+		fakeshop.WithPublicURL("https://fountainpenhospital.com"),
+		fakeshop.WithLayout(fakeshop.LayoutShopify),
+		fakeshop.WithCollectionPath("/collections/back-room-1"),
+	},
+	api.ScraperTruphae: {
+		fakeshop.WithPublicURL("https://truphaeinc.com"),
+		fakeshop.WithLayout(fakeshop.LayoutShopify),
+		fakeshop.WithCollectionPath("/collections/pre-owned-pens"),
+	},
+}
+
+func newBuiltinShop(name api.Scraper, opts ...fakeshop.Option) *fakeshop.Shop {
+	return fakeshop.NewShop(append(slices.Clone(builtinShops[name]), opts...)...)
+}
+
+// newShopServer runs the builtin scrapers as configured against fake shops
+// so runs exercise the real runner, scrapers, filters, pagination and
+// product prefixes without touching the network. Only the retry policy and
+// extra options are added.
+func newShopServer(shops map[api.Scraper]*fakeshop.Shop, rec recorder.Recorder, retry scraper.RetryPolicy, extra ...scraper.SimpleScraperOption) *DefaultServer {
+	names := make([]api.Scraper, 0, len(shops))
+	opts := make(WithScraperOptions)
+
+	for name, shop := range shops {
+		public, err := url.Parse(shop.CollectionURL())
+		if err != nil {
+			panic(err)
+		}
+
+		target, err := url.Parse(shop.URL())
+		if err != nil {
+			panic(err)
+		}
+
+		names = append(names, name)
+		opts[name] = append([]scraper.SimpleScraperOption{
+			scraper.WithTransport{Transport: shopTransport{host: public.Host, shop: target}},
+			scraper.WithRetryPolicy(retry),
+		}, extra...)
+	}
+
+	slices.Sort(names)
+
+	return NewDefaultServer(
+		WithRunner{Runner: scraper.NewParallelRunner()},
+		WithRecorder{Recorder: rec},
+		WithScrapers(names),
+		opts,
+	)
+}
+
+// shopTransport sends requests for the host of a builtin scraper to its
+// fake shop and refuses any other host.
+type shopTransport struct {
+	host string
+	shop *url.URL
+}
+
+func (t shopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return nil, fmt.Errorf("unexpected request to %s", req.URL)
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme, out.URL.Host, out.Host = t.shop.Scheme, t.shop.Host, ""
+
+	res, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	// links are resolved against the response's request which must keep
+	// the host of the shop
+	res.Request = req
+
+	return res, nil
+}
+
+func runToCompletion(t *testing.T, srv *DefaultServer, req api.PostRunRequest) api.GetRunResponse {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	res := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/run/", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+
+	var created api.PostRunResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+	require.NotEqual(t, uuid.Nil, created.RunID)
+
+	var run api.GetRunResponse
+
+	require.Eventually(t, func() bool {
+		res := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/run/"+created.RunID.String(), nil))
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &run))
+
+		return run.Status.Terminal()
+	}, 30*time.Second, 10*time.Millisecond)
+
+	return run
+}
+
+func productURLs(products []recorder.Product) []string {
+	urls := make([]string, 0, len(products))
+	for _, p := range products {
+		urls = append(urls, p.URL)
+	}
+
+	return urls
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request body")
+
+type idempotencyEntry struct {
+	digest   [sha256.Size]byte
+	response api.PostRunResponse
+	expires  time.Time
+}
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		window:  window,
+		entries: make(map[string]idempotencyEntry),
+		lock:    &sync.Mutex{},
+		now:     time.Now,
+	}
+}
+
+type idempotencyStore struct {
+	window  time.Duration
+	entries map[string]idempotencyEntry
+	lock    *sync.Mutex
+	now     func() time.Time
+}
+
+func (s *idempotencyStore) Do(key string, req api.PostRunRequest, create func() (api.PostRunResponse, error)) (api.PostRunResponse, bool, error) {
+	digest, err := requestDigest(req)
+	if err != nil {
+		return api.PostRunResponse{}, false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	if entry, ok := s.entries[key]; ok {
+		if entry.digest != digest {
+			return api.PostRunResponse{}, false, ErrIdempotencyKeyReused
+		}
+
+		return entry.response, true, nil
+	}
+
+	// failed requests are not remembered so they can be retried with the same key
+	res, err := create()
+	if err != nil {
+		return api.PostRunResponse{}, false, err
+	}
+
+	s.entries[key] = idempotencyEntry{
+		digest:   digest,
+		response: res,
+		expires:  now.Add(s.window),
+	}
+
+	return res, false, nil
+}
+
+func (s *idempotencyStore) prune(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func requestDigest(req api.PostRunRequest) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("encoding request: %w", err)
+	}
+
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ajpantuso/pen-finder/internal/auth"
+)
+
+type Authenticator interface {
+	Authenticate(string) (auth.Token, error)
+}
+
+func (s *DefaultServer) authorize(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	if s.cfg.Authenticator == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pen-finder"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		token, err := s.cfg.Authenticator.Authenticate(secret)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pen-finder", error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		if err != nil {
+			s.cfg.Logger.Error(err, "authenticating request")
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if !token.Role.Allows(role) {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		next(w, r.WithContext(auth.WithToken(r.Context(), token)))
+	}
+}
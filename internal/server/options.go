@@ -7,7 +7,11 @@ package server
 import (
 	"time"
 
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/catalog"
 	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/ajpantuso/pen-finder/internal/webhook"
 	"github.com/go-logr/logr"
 )
 
@@ -29,6 +33,18 @@ func (w WithCertFile) ConfigureDefaultServer(c *DefaultServerConfig) {
 	c.CertFile = string(w)
 }
 
+type WithClientCAFile string
+
+func (w WithClientCAFile) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.ClientCAFile = string(w)
+}
+
+type WithInsecureHTTP bool
+
+func (w WithInsecureHTTP) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.InsecureHTTP = bool(w)
+}
+
 type WithRunTimeout time.Duration
 
 func (w WithRunTimeout) ConfigureDefaultServer(c *DefaultServerConfig) {
@@ -52,3 +68,99 @@ type WithRecorder struct {
 func (w WithRecorder) ConfigureDefaultServer(c *DefaultServerConfig) {
 	c.Recorder = w.Recorder
 }
+
+type WithCatalog struct {
+	Catalog catalog.Catalog
+}
+
+func (w WithCatalog) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Catalog = w.Catalog
+}
+
+type WithRunner struct {
+	Runner scraper.Runner
+}
+
+func (w WithRunner) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Runner = w.Runner
+}
+
+type WithScrapers []api.Scraper
+
+func (w WithScrapers) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Scrapers = append([]api.Scraper{}, w...)
+}
+
+type WithReloader struct {
+	Reloader Reloader
+}
+
+func (w WithReloader) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Reloader = w.Reloader
+}
+
+type WithAuthenticator struct {
+	Authenticator Authenticator
+}
+
+func (w WithAuthenticator) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Authenticator = w.Authenticator
+}
+
+type WithMaxConcurrentRuns int
+
+func (w WithMaxConcurrentRuns) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.MaxConcurrentRuns = int(w)
+}
+
+type WithMaxQueuedRuns int
+
+func (w WithMaxQueuedRuns) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.MaxQueuedRuns = int(w)
+}
+
+type WithIdempotencyWindow time.Duration
+
+func (w WithIdempotencyWindow) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.IdempotencyWindow = time.Duration(w)
+}
+
+type WithNotifiers []webhook.Delivery
+
+func (w WithNotifiers) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Notifiers = append([]webhook.Delivery{}, w...)
+}
+
+type WithWebhookSender struct {
+	Sender *webhook.Sender
+}
+
+func (w WithWebhookSender) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.Webhooks = w.Sender
+}
+
+type WithMaxRunTimeout time.Duration
+
+func (w WithMaxRunTimeout) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.MaxRunTimeout = time.Duration(w)
+}
+
+type WithScraperOptions map[api.Scraper][]scraper.SimpleScraperOption
+
+func (w WithScraperOptions) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.ScraperOptions = w
+}
+
+type WithFeedScraperOptions map[api.Scraper][]scraper.FeedScraperOption
+
+func (w WithFeedScraperOptions) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.FeedOptions = w
+}
+
+type WithCircuitBreakers struct {
+	Breakers *scraper.CircuitBreakers
+}
+
+func (w WithCircuitBreakers) ConfigureDefaultServer(c *DefaultServerConfig) {
+	c.CircuitBreakers = w.Breakers
+}
@@ -14,12 +14,30 @@ import (
 
 type RunCache interface {
 	Get(uuid.UUID) (RunCacheEntry, bool)
+	Register(RunCacheEntry)
 	Upsert(uuid.UUID, api.RunStatus)
+	SetResults(uuid.UUID, map[api.Scraper]api.ScraperResult)
+	List() []RunCacheEntry
 }
 
 type RunCacheEntry struct {
+	ID          uuid.UUID
 	Status      api.RunStatus
 	LastUpdated time.Time
+	Scrapers    []api.Scraper
+	Options     api.RunOptions
+	Results     map[api.Scraper]api.ScraperResult
+}
+
+func (e RunCacheEntry) Response() api.GetRunResponse {
+	return api.GetRunResponse{
+		ID:          e.ID,
+		Status:      e.Status,
+		LastUpdated: e.LastUpdated,
+		Scrapers:    e.Scrapers,
+		Results:     e.Results,
+		RunOptions:  e.Options,
+	}
 }
 
 func NewThreadSafeRunCache() *ThreadSafeRunCache {
@@ -43,16 +61,56 @@ func (c *ThreadSafeRunCache) Get(id uuid.UUID) (RunCacheEntry, bool) {
 	return entry, ok
 }
 
+func (c *ThreadSafeRunCache) Register(entry RunCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry.LastUpdated = time.Now()
+
+	c.data[entry.ID] = entry
+}
+
 func (c *ThreadSafeRunCache) Upsert(id uuid.UUID, status api.RunStatus) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	if entry, ok := c.data[id]; ok && entry.Status == status {
+	entry, ok := c.data[id]
+	if ok && entry.Status == status {
 		return
 	}
 
-	c.data[id] = RunCacheEntry{
-		Status:      status,
-		LastUpdated: time.Now(),
+	entry.ID = id
+	entry.Status = status
+	entry.LastUpdated = time.Now()
+
+	c.data[id] = entry
+}
+
+// SetResults replaces the results of an existing entry leaving every other
+// field as is. Unknown runs are ignored.
+func (c *ThreadSafeRunCache) SetResults(id uuid.UUID, results map[api.Scraper]api.ScraperResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.data[id]
+	if !ok {
+		return
 	}
+
+	entry.Results = results
+	entry.LastUpdated = time.Now()
+
+	c.data[id] = entry
+}
+
+func (c *ThreadSafeRunCache) List() []RunCacheEntry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entries := make([]RunCacheEntry, 0, len(c.data))
+	for _, entry := range c.data {
+		entries = append(entries, entry)
+	}
+
+	return entries
 }
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadSafeRunCacheSetResults(t *testing.T) {
+	cache := NewThreadSafeRunCache()
+	results := map[api.Scraper]api.ScraperResult{api.ScraperFPH: api.ScraperResultSuccess}
+
+	unknown := uuid.New()
+	cache.SetResults(unknown, results)
+
+	_, ok := cache.Get(unknown)
+	assert.False(t, ok, "results alone do not create entries")
+
+	id := uuid.New()
+	cache.Register(RunCacheEntry{ID: id, Status: api.RunStatusInProgress, Scrapers: []api.Scraper{api.ScraperFPH}})
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+
+		cache.Upsert(id, api.RunStatusCancelled)
+	}()
+	go func() {
+		defer wg.Done()
+
+		cache.SetResults(id, results)
+	}()
+	wg.Wait()
+
+	entry, ok := cache.Get(id)
+	require.True(t, ok)
+	assert.Equal(t, api.RunStatusCancelled, entry.Status, "setting results keeps concurrent status updates")
+	assert.Equal(t, results, entry.Results)
+	assert.Equal(t, []api.Scraper{api.ScraperFPH}, entry.Scrapers)
+}
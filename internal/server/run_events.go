@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/google/uuid"
+)
+
+const (
+	maxRunEventHistory = 1000
+	subscriberBuffer   = 64
+	runEventRetention  = 5 * time.Minute
+	runEventKeepAlive  = 15 * time.Second
+)
+
+func writeRunEvent(w io.Writer, event api.RunEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+
+	return err
+}
+
+func newRunEventBroker(runID uuid.UUID) *runEventBroker {
+	return &runEventBroker{
+		runID:       runID,
+		subscribers: make(map[chan api.RunEvent]struct{}),
+		lock:        &sync.Mutex{},
+	}
+}
+
+type runEventBroker struct {
+	runID       uuid.UUID
+	nextID      uint64
+	history     []api.RunEvent
+	subscribers map[chan api.RunEvent]struct{}
+	closed      bool
+	lock        *sync.Mutex
+}
+
+func (b *runEventBroker) HandleEvent(e scraper.Event) {
+	event := api.RunEvent{
+		Type:    api.RunEventType(e.Type),
+		Source:  e.Source,
+		URL:     e.URL,
+		Product: e.Product,
+		Time:    e.Time,
+	}
+	if e.Err != nil {
+		event.Error = e.Err.Error()
+	}
+
+	b.Publish(event)
+}
+
+func (b *runEventBroker) Publish(event api.RunEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	event.ID = b.nextID
+	event.RunID = b.runID
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > maxRunEventHistory {
+		b.history = b.history[len(b.history)-maxRunEventHistory:]
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- event:
+		default:
+			// drop subscribers which cannot keep up rather than stall scraping
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+func (b *runEventBroker) Finish(status api.RunStatus) {
+	b.Publish(api.RunEvent{
+		Type:   api.RunEventRunFinished,
+		Status: status,
+	})
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closed = true
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub)
+	}
+}
+
+// Finished reports whether the run finished and no more events follow.
+func (b *runEventBroker) Finished() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.closed
+}
+
+// Subscribe returns the retained events after lastID along with a channel of
+// later events. The channel is closed when the run finishes or when the
+// subscriber falls too far behind in which case it should subscribe again.
+func (b *runEventBroker) Subscribe(lastID uint64) ([]api.RunEvent, <-chan api.RunEvent, func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var history []api.RunEvent
+	for _, event := range b.history {
+		if event.ID > lastID {
+			history = append(history, event)
+		}
+	}
+
+	sub := make(chan api.RunEvent, subscriberBuffer)
+	if b.closed {
+		close(sub)
+
+		return history, sub, func() {}
+	}
+
+	b.subscribers[sub] = struct{}{}
+
+	return history, sub, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEventBrokerReplay(t *testing.T) {
+	b := newRunEventBroker(uuid.New())
+
+	for range maxRunEventHistory + 5 {
+		b.Publish(api.RunEvent{Type: api.RunEventPageVisited})
+	}
+
+	history, _, unsubscribe := b.Subscribe(0)
+	unsubscribe()
+
+	require.Len(t, history, maxRunEventHistory, "history is bounded")
+	assert.Equal(t, uint64(6), history[0].ID)
+
+	history, _, unsubscribe = b.Subscribe(maxRunEventHistory + 3)
+	unsubscribe()
+
+	require.Len(t, history, 2, "only events after the last seen one are replayed")
+	assert.Equal(t, uint64(maxRunEventHistory+4), history[0].ID)
+}
+
+func TestRunEventBrokerSlowSubscriber(t *testing.T) {
+	b := newRunEventBroker(uuid.New())
+
+	_, events, unsubscribe := b.Subscribe(0)
+	defer unsubscribe()
+
+	for range subscriberBuffer + 1 {
+		b.Publish(api.RunEvent{Type: api.RunEventPageVisited})
+	}
+
+	var lastID uint64
+	for event := range events {
+		lastID = event.ID
+	}
+
+	assert.Equal(t, uint64(subscriberBuffer), lastID, "buffered events are delivered before the channel closes")
+	assert.False(t, b.Finished())
+
+	b.Finish(api.RunStatusSuccess)
+	assert.True(t, b.Finished())
+
+	history, events, _ := b.Subscribe(lastID)
+	require.Len(t, history, 2)
+	assert.Equal(t, api.RunEventRunFinished, history[1].Type)
+
+	_, open := <-events
+	assert.False(t, open)
+}
+
+func TestRunEventsStream(t *testing.T) {
+	srv := NewDefaultServer()
+	srv.eventRetention = 50 * time.Millisecond
+
+	runID := uuid.New()
+	srv.cfg.Cache.Register(RunCacheEntry{ID: runID, Status: api.RunStatusInProgress})
+	srv.trackRunEvents(runID)
+
+	broker, ok := srv.runEvents(runID)
+	require.True(t, ok)
+
+	for _, typ := range []api.RunEventType{api.RunEventScraperStarted, api.RunEventPageVisited, api.RunEventProductRecorded} {
+		broker.Publish(api.RunEvent{Type: typ})
+	}
+
+	srv.finishRun(runID, api.RunStatusSuccess)
+
+	stream := func(lastEventID string) (int, []api.RunEvent) {
+		req := httptest.NewRequest(http.MethodGet, "/run/"+runID.String()+"/events", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		res := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(res, req)
+
+		return res.Code, readRunEvents(t, res.Body)
+	}
+
+	code, events := stream("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []uint64{1, 2, 3, 4}, eventIDs(events), "finished runs are replayed in full")
+
+	_, events = stream("2")
+	assert.Equal(t, []uint64{3, 4}, eventIDs(events))
+	assert.Equal(t, api.RunEventRunFinished, events[1].Type)
+	assert.Equal(t, api.RunStatusSuccess, events[1].Status)
+
+	code, _ = stream("latest")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	require.Eventually(t, func() bool {
+		_, ok := srv.runEvents(runID)
+
+		return !ok
+	}, time.Second, 10*time.Millisecond, "streams are dropped after the retention period")
+
+	_, events = stream("")
+	require.Len(t, events, 1, "expired streams only report the outcome")
+	assert.Equal(t, api.RunEventRunFinished, events[0].Type)
+	assert.Equal(t, api.RunStatusSuccess, events[0].Status)
+}
+
+func TestRunEventsStreamResumesDroppedSubscriber(t *testing.T) {
+	srv := NewDefaultServer()
+
+	runID := uuid.New()
+	srv.cfg.Cache.Register(RunCacheEntry{ID: runID, Status: api.RunStatusInProgress})
+	srv.trackRunEvents(runID)
+
+	broker, ok := srv.runEvents(runID)
+	require.True(t, ok)
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		res := &streamRecorder{ResponseRecorder: httptest.NewRecorder(), body: pw}
+		srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/run/"+runID.String()+"/events", nil))
+		pw.Close()
+	}()
+
+	require.Eventually(t, func() bool {
+		broker.lock.Lock()
+		defer broker.lock.Unlock()
+
+		return len(broker.subscribers) == 1
+	}, time.Second, time.Millisecond)
+
+	// nothing reads the stream until the broker dropped it for falling behind
+	total := subscriberBuffer + 10
+	for range total {
+		broker.Publish(api.RunEvent{Type: api.RunEventPageVisited})
+	}
+
+	broker.Finish(api.RunStatusSuccess)
+
+	events := readRunEvents(t, pr)
+
+	expected := make([]uint64, 0, total+1)
+	for id := range uint64(total + 1) {
+		expected = append(expected, id+1)
+	}
+
+	assert.Equal(t, expected, eventIDs(events), "no events are lost")
+	assert.Equal(t, api.RunEventRunFinished, events[len(events)-1].Type)
+}
+
+// streamRecorder sends the body through a pipe so that writes block until
+// the test reads them.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	body io.Writer
+}
+
+func (r *streamRecorder) Write(p []byte) (int, error) {
+	return r.body.Write(p)
+}
+
+func (r *streamRecorder) WriteString(s string) (int, error) {
+	return r.body.Write([]byte(s))
+}
+
+func readRunEvents(t *testing.T, body io.Reader) []api.RunEvent {
+	t.Helper()
+
+	var events []api.RunEvent
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event api.RunEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+
+		events = append(events, event)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return events
+}
+
+func eventIDs(events []api.RunEvent) []uint64 {
+	ids := make([]uint64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
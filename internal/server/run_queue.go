@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/google/uuid"
+)
+
+var ErrQueueFull = errors.New("run queue is full")
+
+type admission int
+
+const (
+	admissionStarted admission = iota
+	admissionQueued
+	admissionCoalesced
+	// admissionWidened coalesces into a queued run which may have gained
+	// scrapers from the request.
+	admissionWidened
+)
+
+type pendingRun struct {
+	id       uuid.UUID
+	scrapers []api.Scraper
+	options  api.RunOptions
+	// ctx is cancelled to cancel the run whether it is still queued, being
+	// handed from the queue to a worker or already running.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func newRunQueue(maxRunning, maxQueued int) *runQueue {
+	return &runQueue{
+		maxRunning: maxRunning,
+		maxQueued:  maxQueued,
+		running:    make(map[uuid.UUID]*pendingRun),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// runQueue admits runs while making sure a scraper is never part of two
+// runs at once. Requests are coalesced into a queued or running run with
+// the same options when possible and otherwise wait behind the runs they
+// overlap with.
+type runQueue struct {
+	maxRunning int
+	maxQueued  int
+	running    map[uuid.UUID]*pendingRun
+	pending    []*pendingRun
+	lock       *sync.Mutex
+}
+
+// Admit starts, queues or coalesces a run request. admitted is called under
+// the queue lock with the resulting run so that it is tracked before it can
+// be started, finished or cancelled.
+func (q *runQueue) Admit(scrapers []api.Scraper, options api.RunOptions, admitted func(pendingRun, admission)) (pendingRun, admission, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	run, result, err := q.admit(scrapers, options)
+	if err == nil && admitted != nil {
+		admitted(run, result)
+	}
+
+	return run, result, err
+}
+
+func (q *runQueue) admit(scrapers []api.Scraper, options api.RunOptions) (pendingRun, admission, error) {
+	for _, r := range q.running {
+		if len(scrapers) > 0 && containsAll(r.scrapers, scrapers) && reflect.DeepEqual(r.options, options) {
+			return r.clone(), admissionCoalesced, nil
+		}
+	}
+
+	for _, p := range q.pending {
+		if !overlaps(p.scrapers, scrapers) || !reflect.DeepEqual(p.options, options) {
+			continue
+		}
+
+		for _, s := range scrapers {
+			if !slices.Contains(p.scrapers, s) {
+				p.scrapers = append(p.scrapers, s)
+			}
+		}
+
+		return p.clone(), admissionWidened, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	run := &pendingRun{
+		id:       uuid.New(),
+		scrapers: slices.Clone(scrapers),
+		options:  options,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if len(q.running) < q.maxRunning && !q.blocked(run, q.pending) {
+		q.running[run.id] = run
+
+		return run.clone(), admissionStarted, nil
+	}
+
+	if len(q.pending) >= q.maxQueued {
+		cancel(nil)
+
+		return pendingRun{}, 0, ErrQueueFull
+	}
+
+	q.pending = append(q.pending, run)
+
+	return run.clone(), admissionQueued, nil
+}
+
+// Done releases a finished run and returns the queued runs which may start
+// in its place.
+func (q *runQueue) Done(id uuid.UUID) []pendingRun {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.running, id)
+
+	return q.next()
+}
+
+// Remove drops a queued run. Runs which were waiting behind it and may
+// now start are returned.
+func (q *runQueue) Remove(id uuid.UUID) ([]pendingRun, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	idx := slices.IndexFunc(q.pending, func(p *pendingRun) bool { return p.id == id })
+	if idx < 0 {
+		return nil, false
+	}
+
+	q.pending = slices.Delete(q.pending, idx, idx+1)
+
+	return q.next(), true
+}
+
+// next starts queued runs in order as long as there is capacity. A run does
+// not overtake an earlier queued run sharing one of its scrapers.
+func (q *runQueue) next() []pendingRun {
+	var (
+		started []pendingRun
+		waiting []*pendingRun
+		skipped []*pendingRun
+	)
+
+	for _, p := range q.pending {
+		if len(q.running) >= q.maxRunning || q.blocked(p, skipped) {
+			waiting = append(waiting, p)
+			skipped = append(skipped, p)
+
+			continue
+		}
+
+		q.running[p.id] = p
+		started = append(started, p.clone())
+	}
+
+	q.pending = waiting
+
+	return started
+}
+
+// blocked reports whether run shares a scraper with a running run or one of
+// the given queued runs.
+func (q *runQueue) blocked(run *pendingRun, queued []*pendingRun) bool {
+	for _, r := range q.running {
+		if overlaps(r.scrapers, run.scrapers) {
+			return true
+		}
+	}
+
+	return slices.ContainsFunc(queued, func(p *pendingRun) bool {
+		return overlaps(p.scrapers, run.scrapers)
+	})
+}
+
+func (p *pendingRun) clone() pendingRun {
+	return pendingRun{
+		id:       p.id,
+		scrapers: slices.Clone(p.scrapers),
+		options:  p.options,
+		ctx:      p.ctx,
+		cancel:   p.cancel,
+	}
+}
+
+func overlaps(a, b []api.Scraper) bool {
+	return slices.ContainsFunc(a, func(s api.Scraper) bool {
+		return slices.Contains(b, s)
+	})
+}
+
+func containsAll(a, b []api.Scraper) bool {
+	return !slices.ContainsFunc(b, func(s api.Scraper) bool {
+		return !slices.Contains(a, s)
+	})
+}
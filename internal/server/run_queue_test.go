@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"testing"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQueue(t *testing.T) {
+	q := newRunQueue(1, 1)
+
+	first, admitted, err := q.Admit([]api.Scraper{api.ScraperFPH}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionStarted, admitted)
+
+	running, admitted, err := q.Admit([]api.Scraper{api.ScraperFPH}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionCoalesced, admitted, "requests covered by a running run are coalesced into it")
+	assert.Equal(t, first.id, running.id)
+
+	queued, admitted, err := q.Admit([]api.Scraper{api.ScraperFPH, api.ScraperTruphae}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionQueued, admitted)
+	assert.NotEqual(t, first.id, queued.id)
+
+	coalesced, admitted, err := q.Admit([]api.Scraper{api.ScraperTruphae}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionWidened, admitted)
+	assert.Equal(t, queued.id, coalesced.id)
+	assert.ElementsMatch(t, []api.Scraper{api.ScraperFPH, api.ScraperTruphae}, coalesced.scrapers)
+
+	_, _, err = q.Admit([]api.Scraper{api.ScraperFPH}, api.RunOptions{DryRun: true}, nil)
+	assert.ErrorIs(t, err, ErrQueueFull, "runs with different options must not be coalesced")
+
+	_, _, err = q.Admit([]api.Scraper{api.ScraperChatterly}, api.RunOptions{}, nil)
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	next := q.Done(first.id)
+	require.Len(t, next, 1)
+	assert.Equal(t, queued.id, next[0].id)
+	assert.ElementsMatch(t, []api.Scraper{api.ScraperFPH, api.ScraperTruphae}, next[0].scrapers)
+
+	assert.Empty(t, q.Done(queued.id))
+}
+
+func TestRunQueueWaitsForOverlappingRuns(t *testing.T) {
+	q := newRunQueue(2, 3)
+	dryRun := api.RunOptions{DryRun: true}
+
+	a, admitted, err := q.Admit([]api.Scraper{api.ScraperFPH, api.ScraperTruphae}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, admissionStarted, admitted)
+
+	b, admitted, err := q.Admit([]api.Scraper{api.ScraperFPH}, dryRun, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionQueued, admitted, "a scraper never runs twice at once even with capacity left")
+
+	c, admitted, err := q.Admit([]api.Scraper{api.ScraperChatterly}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionStarted, admitted)
+
+	d, admitted, err := q.Admit([]api.Scraper{api.ScraperTruphae}, dryRun, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionQueued, admitted)
+
+	e, admitted, err := q.Admit([]api.Scraper{api.ScraperTruphae, api.ScraperChatterly}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admissionQueued, admitted)
+
+	assert.Empty(t, q.Done(c.id), "queued runs still overlap the running one")
+
+	started := q.Done(a.id)
+	require.Len(t, started, 2)
+	assert.Equal(t, b.id, started[0].id)
+	assert.Equal(t, d.id, started[1].id)
+
+	assert.Empty(t, q.Done(b.id), "queued runs do not overtake earlier ones sharing a scraper")
+
+	started = q.Done(d.id)
+	require.Len(t, started, 1)
+	assert.Equal(t, e.id, started[0].id)
+}
+
+func TestRunQueueAdmitted(t *testing.T) {
+	q := newRunQueue(1, 1)
+
+	var tracked []admission
+
+	track := func(_ pendingRun, admitted admission) {
+		tracked = append(tracked, admitted)
+	}
+
+	_, _, err := q.Admit([]api.Scraper{api.ScraperFPH}, api.RunOptions{}, track)
+	require.NoError(t, err)
+	_, _, err = q.Admit([]api.Scraper{api.ScraperTruphae}, api.RunOptions{}, track)
+	require.NoError(t, err)
+	_, _, err = q.Admit([]api.Scraper{api.ScraperChatterly}, api.RunOptions{}, track)
+	require.ErrorIs(t, err, ErrQueueFull)
+
+	assert.Equal(t, []admission{admissionStarted, admissionQueued}, tracked, "rejected runs are not tracked")
+}
+
+func TestRunQueueRemove(t *testing.T) {
+	q := newRunQueue(1, 2)
+
+	first, _, err := q.Admit([]api.Scraper{api.ScraperFPH}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+
+	queued, admitted, err := q.Admit([]api.Scraper{api.ScraperTruphae}, api.RunOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, admissionQueued, admitted)
+
+	_, removed := q.Remove(queued.id)
+	assert.True(t, removed)
+	_, removed = q.Remove(queued.id)
+	assert.False(t, removed)
+
+	assert.Empty(t, q.Done(first.id))
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+)
+
+func newRunResults() *runResults {
+	return &runResults{
+		results: make(map[api.Scraper]api.ScraperResult),
+		lock:    &sync.Mutex{},
+	}
+}
+
+type runResults struct {
+	results map[api.Scraper]api.ScraperResult
+	lock    *sync.Mutex
+}
+
+func (r *runResults) Wrap(name api.Scraper, s scraper.Scraper) scraper.Scraper {
+	return &resultScraper{
+		name:    name,
+		scraper: s,
+		results: r,
+	}
+}
+
+func (r *runResults) Results() map[api.Scraper]api.ScraperResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return maps.Clone(r.results)
+}
+
+func (r *runResults) set(name api.Scraper, result api.ScraperResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.results[name] = result
+}
+
+type resultScraper struct {
+	name    api.Scraper
+	scraper scraper.Scraper
+	results *runResults
+}
+
+func (s *resultScraper) Scrape(ctx context.Context, opts ...scraper.ScrapeOption) error {
+	err := s.scraper.Scrape(ctx, opts...)
+
+	switch {
+	case errors.Is(err, scraper.ErrCircuitOpen):
+		// skipping an unhealthy source does not fail the rest of the run
+		s.results.set(s.name, api.ScraperResultSkipped)
+
+		return nil
+	case err != nil:
+		s.results.set(s.name, api.ScraperResultFailed)
+	default:
+		s.results.set(s.name, api.ScraperResultSuccess)
+	}
+
+	return err
+}
@@ -6,16 +6,31 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math"
 	"net/http"
-	"regexp"
+	"net/url"
+	"os"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/auth"
+	"github.com/ajpantuso/pen-finder/internal/catalog"
+	"github.com/ajpantuso/pen-finder/internal/certwatcher"
 	"github.com/ajpantuso/pen-finder/internal/recorder"
 	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/ajpantuso/pen-finder/internal/webhook"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 )
@@ -30,29 +45,158 @@ func NewDefaultServer(opts ...DefaultServerOption) *DefaultServer {
 	cfg.Options(opts...)
 	cfg.Default()
 
-	return &DefaultServer{
-		cfg: cfg,
+	srv := &DefaultServer{
+		cfg:            cfg,
+		cancels:        make(map[uuid.UUID]context.CancelCauseFunc),
+		events:         make(map[uuid.UUID]*runEventBroker),
+		eventRetention: runEventRetention,
+		callbacks:      make(map[uuid.UUID][]webhook.Delivery),
+		lock:           &sync.Mutex{},
+		scraperConfig:  &atomic.Pointer[ScraperConfig]{},
+		queue:          newRunQueue(cfg.MaxConcurrentRuns, cfg.MaxQueuedRuns),
+		idempotency:    newIdempotencyStore(cfg.IdempotencyWindow),
 	}
+
+	names := cfg.Scrapers
+	if names == nil {
+		names = scraper.BuiltinNames()
+	}
+
+	srv.SetScraperConfig(ScraperConfig{
+		Names:       names,
+		Options:     cfg.ScraperOptions,
+		FeedOptions: cfg.FeedOptions,
+	})
+
+	return srv
 }
 
 type DefaultServer struct {
-	cfg DefaultServerConfig
+	cfg            DefaultServerConfig
+	cancels        map[uuid.UUID]context.CancelCauseFunc
+	events         map[uuid.UUID]*runEventBroker
+	eventRetention time.Duration
+	callbacks      map[uuid.UUID][]webhook.Delivery
+	lock           *sync.Mutex
+	scraperConfig  *atomic.Pointer[ScraperConfig]
+	queue          *runQueue
+	idempotency    *idempotencyStore
 }
 
-func (s *DefaultServer) Serve(ctx context.Context) error {
+// ScraperConfig is the set of scrapers available to runs. It is replaced as
+// a whole so that a run never mixes names and options of two
+// configurations.
+type ScraperConfig struct {
+	// Names of the enabled builtin scrapers and feeds.
+	Names   []api.Scraper
+	Options map[api.Scraper][]scraper.SimpleScraperOption
+	// FeedOptions configure feeds each of which runs as a scraper named
+	// after it.
+	FeedOptions map[api.Scraper][]scraper.FeedScraperOption
+}
+
+func (s *DefaultServer) SetScraperConfig(cfg ScraperConfig) {
+	snapshot := ScraperConfig{
+		Names:       slices.Clone(cfg.Names),
+		Options:     maps.Clone(cfg.Options),
+		FeedOptions: maps.Clone(cfg.FeedOptions),
+	}
+	if snapshot.Names == nil {
+		snapshot.Names = []api.Scraper{}
+	}
+
+	s.scraperConfig.Store(&snapshot)
+}
+
+func (s *DefaultServer) newScrapers(cfg *ScraperConfig, names []api.Scraper, results *runResults) []scraper.Scraper {
+	result := make([]scraper.Scraper, 0, len(names))
+	for _, name := range names {
+		var sc scraper.Scraper
+
+		if builtin, ok := scraper.NewBuiltinScraper(name, cfg.Options[name]...); ok {
+			sc = builtin
+		} else if feedOpts, ok := cfg.FeedOptions[name]; ok {
+			sc = scraper.NewFeedScraper(feedOpts...)
+		} else {
+			continue
+		}
+
+		result = append(result, results.Wrap(name, s.cfg.CircuitBreakers.Wrap(string(name), sc)))
+	}
+
+	return result
+}
+
+var (
+	errRunCancelled      = errors.New("run cancelled")
+	ErrInvalidRunRequest = errors.New("invalid run request")
+)
+
+func (s *DefaultServer) Handler() http.Handler {
 	handler := http.NewServeMux()
-	handler.HandleFunc("GET /run/{id}", s.handleGetRun)
-	handler.HandleFunc("POST /run/", s.handleRunRequest)
+	handler.HandleFunc("GET /run/", s.authorize(auth.RoleReader, s.handleListRuns))
+	handler.HandleFunc("GET /run/{id}", s.authorize(auth.RoleReader, s.handleGetRun))
+	handler.HandleFunc("POST /run/", s.authorize(auth.RoleOperator, s.handleRunRequest))
+	handler.HandleFunc("GET /run/{id}/events", s.authorize(auth.RoleReader, s.handleRunEvents))
+	handler.HandleFunc("POST /run/{id}/cancel", s.authorize(auth.RoleOperator, s.handleCancelRun))
+	handler.HandleFunc("GET /products", s.authorize(auth.RoleReader, s.handleGetProducts))
+	handler.HandleFunc("GET /health/scrapers", s.authorize(auth.RoleReader, s.handleScraperHealth))
+	handler.HandleFunc("POST /admin/reload", s.authorize(auth.RoleOperator, s.handleReload))
+
+	return handler
+}
+
+func (s *DefaultServer) Serve(ctx context.Context) error {
+	if s.cfg.Authenticator == nil {
+		s.cfg.Logger.Info("authentication is disabled; any client can start runs")
+	}
+
+	if s.cfg.InsecureHTTP {
+		s.cfg.Logger.Info("serving plaintext HTTP", "bindAddr", s.cfg.BindAddr)
+
+		srv := &http.Server{
+			Addr:    s.cfg.BindAddr,
+			Handler: s.Handler(),
+		}
+
+		return s.serve(ctx, srv, srv.ListenAndServe)
+	}
+
+	watcher, err := certwatcher.NewCertWatcher(
+		certwatcher.WithCertFile(s.cfg.CertFile),
+		certwatcher.WithKeyFile(s.cfg.KeyFile),
+		certwatcher.WithLogger{Logger: s.cfg.Logger},
+	)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	tlsCfg, err := s.tlsConfig(watcher)
+	if err != nil {
+		return err
+	}
 
 	srv := &http.Server{
-		Addr:    s.cfg.BindAddr,
-		Handler: handler,
+		Addr:      s.cfg.BindAddr,
+		Handler:   s.Handler(),
+		TLSConfig: tlsCfg,
 	}
 
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+
+	go watcher.Watch(watchCtx)
+
+	return s.serve(ctx, srv, func() error {
+		return srv.ListenAndServeTLS("", "")
+	})
+}
+
+func (s *DefaultServer) serve(ctx context.Context, srv *http.Server, listen func() error) error {
 	errCh := make(chan error)
 
 	go func() {
-		errCh <- srv.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+		errCh <- listen()
 	}()
 
 	for {
@@ -67,6 +211,32 @@ func (s *DefaultServer) Serve(ctx context.Context) error {
 	}
 }
 
+func (s *DefaultServer) tlsConfig(watcher *certwatcher.CertWatcher) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: watcher.GetCertificate,
+	}
+
+	if s.cfg.ClientCAFile == "" {
+		return tlsCfg, nil
+	}
+
+	data, err := os.ReadFile(s.cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", s.cfg.ClientCAFile)
+	}
+
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return tlsCfg, nil
+}
+
 func (s *DefaultServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -92,13 +262,7 @@ func (s *DefaultServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := api.GetRunResponse{
-		ID:          runID,
-		Status:      entry.Status,
-		LastUpdated: entry.LastUpdated,
-	}
-
-	data, err := json.Marshal(res)
+	data, err := json.Marshal(entry.Response())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 
@@ -122,89 +286,772 @@ func (s *DefaultServer) handleRunRequest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	scrapers := req.Scrapers
+	var (
+		res      api.PostRunResponse
+		replayed bool
+		err      error
+	)
 
-	runID := uuid.New()
-	res := api.PostRunResponse{
-		RunID: runID,
+	if key := r.Header.Get(api.HeaderIdempotencyKey); key != "" {
+		// keys are chosen by clients so they are scoped to the caller to
+		// keep one client from replaying or blocking another's runs
+		if token, ok := auth.TokenFrom(r.Context()); ok {
+			key = token.ID + ":" + key
+		}
+
+		res, replayed, err = s.idempotency.Do(key, req, func() (api.PostRunResponse, error) {
+			return s.startRunResponse(req)
+		})
+	} else {
+		res, err = s.startRunResponse(req)
 	}
 
-	data, err := json.Marshal(res)
+	if errors.Is(err, ErrInvalidRunRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		return
+	}
+	if errors.Is(err, ErrQueueFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(s.retryAfterSeconds()))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+
+		return
+	}
 	if err != nil {
+		s.cfg.Logger.Error(err, "starting run")
 		w.WriteHeader(http.StatusInternalServerError)
 
 		return
 	}
 
-	_, err = w.Write(data)
+	data, err := json.Marshal(res)
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if replayed {
+		w.Header().Set(api.HeaderIdempotentReplayed, "true")
+	}
+
+	if _, err := w.Write(data); err != nil {
 		s.cfg.Logger.Error(err, "writing response")
 	}
+}
+
+func (s *DefaultServer) startRunResponse(req api.PostRunRequest) (api.PostRunResponse, error) {
+	runID, err := s.StartRun(req)
+	if err != nil {
+		return api.PostRunResponse{}, err
+	}
 
-	s.cfg.Cache.Upsert(runID, api.RunStatusInProgress)
+	return api.PostRunResponse{
+		RunID: runID,
+	}, nil
+}
 
-	ctx := context.Background()
-	cancel := func() {}
+func (s *DefaultServer) StartRun(req api.PostRunRequest) (uuid.UUID, error) {
+	if err := s.validateCallbackURL(req.CallbackURL); err != nil {
+		return uuid.Nil, err
+	}
 
-	if s.cfg.RunTimeout != nil {
-		ctx, cancel = context.WithTimeout(ctx, *s.cfg.RunTimeout)
+	options, err := s.runOptions(req.RunOptions)
+	if err != nil {
+		return uuid.Nil, err
 	}
-	defer cancel()
 
-	var scrapeOpts []scraper.ScrapeOption
+	scrapers := resolveScrapers(s.scraperConfig.Load(), req.Scrapers)
+
+	// callbacks are attached while the queue is locked so a run cannot
+	// finish between admitting the request and registering its callback
+	run, admitted, err := s.queue.Admit(scrapers, options, func(run pendingRun, admitted admission) {
+		if req.CallbackURL != "" {
+			s.addCallback(run.id, webhook.Delivery{
+				URL:    req.CallbackURL,
+				Secret: req.CallbackSecret,
+			})
+		}
+
+		status := api.RunStatusInProgress
+
+		switch admitted {
+		case admissionCoalesced:
+			return
+		case admissionWidened:
+			// the queued run may now include more scrapers
+			s.cfg.Cache.Register(RunCacheEntry{
+				ID:       run.id,
+				Status:   api.RunStatusQueued,
+				Scrapers: run.scrapers,
+				Options:  run.options,
+			})
+
+			return
+		case admissionQueued:
+			status = api.RunStatusQueued
+		}
+
+		for _, d := range s.cfg.Notifiers {
+			s.addCallback(run.id, d)
+		}
+
+		s.trackRun(run.id, run.cancel)
+		s.trackRunEvents(run.id)
+		s.cfg.Cache.Register(RunCacheEntry{
+			ID:       run.id,
+			Status:   status,
+			Scrapers: run.scrapers,
+			Options:  run.options,
+		})
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	runID := run.id
+
+	switch admitted {
+	case admissionCoalesced, admissionWidened:
+		s.cfg.Logger.Info("coalesced run request into existing run", "runID", runID, "scrapers", scrapers)
+	case admissionQueued:
+		s.cfg.Logger.Info("queued run", "runID", runID, "scrapers", scrapers)
+	default:
+		s.launchRun(run)
+	}
+
+	return runID, nil
+}
+
+func (s *DefaultServer) runOptions(requested api.RunOptions) (api.RunOptions, error) {
+	options := requested
+	options.Labels = maps.Clone(requested.Labels)
+
+	switch {
+	case options.Timeout < 0:
+		return api.RunOptions{}, fmt.Errorf("%w: timeout must not be negative", ErrInvalidRunRequest)
+	case options.MaxPages < 0:
+		return api.RunOptions{}, fmt.Errorf("%w: maxPages must not be negative", ErrInvalidRunRequest)
+	case options.MaxDepth < 0:
+		return api.RunOptions{}, fmt.Errorf("%w: maxDepth must not be negative", ErrInvalidRunRequest)
+	}
+
+	for key := range options.Labels {
+		if key == "" || strings.ContainsAny(key, "=,") {
+			return api.RunOptions{}, fmt.Errorf("%w: invalid label key %q", ErrInvalidRunRequest, key)
+		}
+	}
+
+	if options.Timeout == 0 && s.cfg.RunTimeout != nil {
+		options.Timeout = api.Duration(*s.cfg.RunTimeout)
+	}
+
+	if maxTimeout := api.Duration(s.cfg.MaxRunTimeout); maxTimeout > 0 && (options.Timeout == 0 || options.Timeout > maxTimeout) {
+		options.Timeout = maxTimeout
+	}
+
+	return options, nil
+}
+
+func (s *DefaultServer) launchRun(run pendingRun) {
+	runID, scrapers := run.id, run.scrapers
+
+	s.cfg.Cache.Register(RunCacheEntry{
+		ID:       runID,
+		Status:   api.RunStatusInProgress,
+		Scrapers: scrapers,
+		Options:  run.options,
+	})
+
+	ctx := run.ctx
+	cancelTimeout := func() {}
+
+	if run.options.Timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(run.options.Timeout))
+	}
+
+	recorders := []recorder.Recorder{s.cfg.Catalog}
 	if s.cfg.Recorder != nil {
-		scrapeOpts = append(scrapeOpts, scraper.WithRecorder{Recorder: s.cfg.Recorder})
+		recorders = append(recorders, s.cfg.Recorder)
+	}
+	if run.options.DryRun {
+		recorders = nil
+	} else if beginner, ok := s.cfg.Recorder.(recorder.RunBeginner); ok {
+		beginner.BeginRun()
+	}
+
+	scrapeOpts := []scraper.ScrapeOption{
+		scraper.WithRecorder{Recorder: recorder.NewMultiRecorder(recorders...)},
+		scraper.WithMaxPages(run.options.MaxPages),
+		scraper.WithMaxDepth(run.options.MaxDepth),
+	}
+	if events, ok := s.runEvents(runID); ok {
+		scrapeOpts = append(scrapeOpts, scraper.WithEventHandler{Handler: events})
 	}
 
 	s.cfg.Logger.Info("running scrappers", "runID", runID, "scrapers", scrapers)
 	go func() {
-		if err := s.cfg.Runner.Run(ctx, scraper.WithScrapers(mapScrapers(scrapers)), scraper.WithScrapeOptions(scrapeOpts)); err != nil {
-			s.cfg.Cache.Upsert(runID, api.RunStatusFailed)
-			s.cfg.Logger.Error(err, "running scrapers")
+		defer cancelTimeout()
+		defer s.untrackRun(runID)
+
+		results := newRunResults()
+		runScrapers := s.newScrapers(s.scraperConfig.Load(), scrapers, results)
+
+		err := s.cfg.Runner.Run(ctx, scraper.WithScrapers(runScrapers), scraper.WithScrapeOptions(scrapeOpts))
+
+		s.cfg.Cache.SetResults(runID, results.Results())
+
+		if completer, ok := s.cfg.Recorder.(recorder.RunCompleter); ok && !run.options.DryRun {
+			if err := completer.CompleteRun(); err != nil {
+				s.cfg.Logger.Error(err, "completing run for recorder")
+			}
+		}
+
+		// leave the queue first so that no request is coalesced into a
+		// run which already finished
+		next := s.queue.Done(runID)
+
+		switch {
+		case errors.Is(context.Cause(ctx), errRunCancelled):
+			s.finishRun(runID, api.RunStatusCancelled)
+			s.cfg.Logger.Info("run cancelled", "runID", runID)
+		case err != nil:
+			s.finishRun(runID, api.RunStatusFailed)
+			s.cfg.Logger.Error(err, "running scrapers", "runID", runID)
+		default:
+			s.finishRun(runID, api.RunStatusSuccess)
 		}
 
-		s.cfg.Cache.Upsert(runID, api.RunStatusSuccess)
+		for _, run := range next {
+			s.launchRun(run)
+		}
 	}()
 }
 
-func mapScrapers(scrapers []api.Scraper) []scraper.Scraper {
-	if len(scrapers) < 1 {
-		return []scraper.Scraper{
-			newChatterlyScraper(),
-			newFPHScraper(),
-			newTruphaeScraper(),
+func (s *DefaultServer) retryAfterSeconds() int {
+	wait := time.Minute
+	if s.cfg.RunTimeout != nil && *s.cfg.RunTimeout > 0 {
+		wait = *s.cfg.RunTimeout
+	}
+
+	return int(math.Ceil(wait.Seconds()))
+}
+
+func resolveScrapers(cfg *ScraperConfig, requested []api.Scraper) []api.Scraper {
+	if len(requested) < 1 {
+		return slices.Clone(cfg.Names)
+	}
+
+	resolved := make([]api.Scraper, 0, len(requested))
+	for _, name := range requested {
+		if slices.Contains(cfg.Names, name) {
+			resolved = append(resolved, name)
 		}
 	}
 
-	slices.Sort(scrapers)
-	scrapers = slices.Compact(scrapers)
+	return resolved
+}
 
-	result := make([]scraper.Scraper, 0, len(scrapers))
-	for _, s := range scrapers {
-		switch s {
-		case api.ScraperChatterly:
-			result = append(result, newChatterlyScraper())
-		case api.ScraperFPH:
-			result = append(result, newFPHScraper())
-		case api.ScraperTruphae:
-			result = append(result, newTruphaeScraper())
-		default:
+func (s *DefaultServer) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	selector, err := parseLabelSelector(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	entries := slices.DeleteFunc(s.cfg.Cache.List(), func(e RunCacheEntry) bool {
+		return !e.Options.HasLabels(selector)
+	})
+
+	slices.SortFunc(entries, func(a, b RunCacheEntry) int {
+		return b.LastUpdated.Compare(a.LastUpdated)
+	})
+
+	res := api.ListRunsResponse{
+		Runs: make([]api.GetRunResponse, 0, len(entries)),
+	}
+
+	for _, entry := range entries {
+		res.Runs = append(res.Runs, entry.Response())
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err := w.Write(data); err != nil {
+		s.cfg.Logger.Error(err, "writing response")
+	}
+}
+
+func parseLabelSelector(values []string) (map[string]string, error) {
+	selector := make(map[string]string, len(values))
+
+	for _, value := range values {
+		for _, term := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(term, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("label selector %q must have the form key=value", term)
+			}
+
+			selector[key] = val
+		}
+	}
+
+	return selector, nil
+}
+
+func (s *DefaultServer) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	runID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	entry, found := s.cfg.Cache.Get(runID)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if next, removed := s.queue.Remove(runID); removed {
+		s.untrackRun(runID)
+		s.finishRun(runID, api.RunStatusCancelled)
+		s.cfg.Logger.Info("cancelled queued run", "runID", runID)
+
+		for _, run := range next {
+			s.launchRun(run)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+
+		return
+	}
+
+	if entry.Status.Terminal() || !s.cancelRun(runID) {
+		w.WriteHeader(http.StatusConflict)
+
+		return
+	}
+
+	s.cfg.Logger.Info("cancelling run", "runID", runID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *DefaultServer) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	runID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	entry, found := s.cfg.Cache.Get(runID)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	var lastID uint64
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		if lastID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	broker, ok := s.runEvents(runID)
+	if !ok {
+		// the stream has expired so only the outcome can be reported
+		if err := writeRunEvent(w, api.RunEvent{
+			Type:   api.RunEventRunFinished,
+			RunID:  runID,
+			Status: entry.Status,
+			Time:   entry.LastUpdated,
+		}); err != nil {
+			s.cfg.Logger.Error(err, "writing run event")
+		}
+		flusher.Flush()
+
+		return
+	}
+
+	write := func(events []api.RunEvent) bool {
+		for _, event := range events {
+			if err := writeRunEvent(w, event); err != nil {
+				s.cfg.Logger.Error(err, "writing run event")
+
+				return false
+			}
+
+			lastID = event.ID
+		}
+
+		flusher.Flush()
+
+		return true
+	}
+
+	history, events, unsubscribe := broker.Subscribe(lastID)
+	defer func() { unsubscribe() }()
+
+	if !write(history) {
+		return
+	}
+
+	keepAlive := time.NewTicker(runEventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case event, ok := <-events:
+			if ok {
+				if !write([]api.RunEvent{event}) {
+					return
+				}
+
+				continue
+			}
+
+			// the subscription ends when the run finishes or when this
+			// stream fell behind; either way catch up from the history so
+			// the stream always ends with the run's outcome
+			finished := broker.Finished()
+
+			unsubscribe()
+			history, events, unsubscribe = broker.Subscribe(lastID)
+
+			if !write(history) || finished {
+				return
+			}
+		}
+	}
+}
+
+func (s *DefaultServer) handleScraperHealth(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	known := make(map[api.Scraper]scraper.SourceHealth)
+	for _, health := range s.cfg.CircuitBreakers.Health() {
+		known[api.Scraper(health.Source)] = health
+	}
+
+	enabled := s.scraperConfig.Load().Names
+
+	res := api.GetScraperHealthResponse{
+		Scrapers: make([]api.ScraperHealth, 0, len(enabled)),
+	}
+
+	for _, name := range enabled {
+		health, ok := known[name]
+		if !ok {
+			health.State = scraper.CircuitClosed
+		}
+
+		entry := api.ScraperHealth{
+			Scraper:             name,
+			State:               string(health.State),
+			ConsecutiveFailures: health.ConsecutiveFailures,
+			LastError:           health.LastError,
+		}
+		if !health.LastFailure.IsZero() {
+			entry.LastFailure = &health.LastFailure
+		}
+		if health.State == scraper.CircuitOpen {
+			entry.OpenUntil = &health.OpenUntil
+		}
+
+		res.Scrapers = append(res.Scrapers, entry)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err := w.Write(data); err != nil {
+		s.cfg.Logger.Error(err, "writing response")
+	}
+}
+
+func (s *DefaultServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if s.cfg.Reloader == nil {
+		http.Error(w, "reloading is not configured", http.StatusNotImplemented)
+
+		return
+	}
+
+	if err := s.cfg.Reloader.Reload(r.Context()); err != nil {
+		s.cfg.Logger.Error(err, "reloading configuration")
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *DefaultServer) finishRun(id uuid.UUID, status api.RunStatus) {
+	s.cfg.Cache.Upsert(id, status)
+
+	s.notifyCallbacks(id)
+
+	events, ok := s.runEvents(id)
+	if !ok {
+		return
+	}
+
+	events.Finish(status)
+
+	// keep finished streams around briefly so late subscribers can replay them
+	time.AfterFunc(s.eventRetention, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		delete(s.events, id)
+	})
+}
+
+func (s *DefaultServer) trackRunEvents(id uuid.UUID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.events[id] = newRunEventBroker(id)
+}
+
+func (s *DefaultServer) runEvents(id uuid.UUID) (*runEventBroker, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	events, ok := s.events[id]
+
+	return events, ok
+}
+
+func (s *DefaultServer) trackRun(id uuid.UUID, cancel context.CancelCauseFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cancels[id] = cancel
+}
+
+func (s *DefaultServer) untrackRun(id uuid.UUID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if cancel, ok := s.cancels[id]; ok {
+		cancel(nil)
+		delete(s.cancels, id)
+	}
+}
+
+func (s *DefaultServer) cancelRun(id uuid.UUID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cancel, ok := s.cancels[id]
+	if ok {
+		cancel(errRunCancelled)
+	}
+
+	return ok
+}
+
+func (s *DefaultServer) handleGetProducts(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	query, err := parseProductQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	page, err := s.cfg.Catalog.Search(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	res := api.GetProductsResponse{
+		Products:   make([]api.Product, 0, len(page.Entries)),
+		NextCursor: page.NextCursor,
+	}
+
+	for _, entry := range page.Entries {
+		res.Products = append(res.Products, api.Product{
+			Source:       entry.Source,
+			Name:         entry.Name,
+			URL:          entry.URL,
+			Price:        entry.Price,
+			Availability: api.ProductAvailability(entry.Availability),
+			FirstSeen:    entry.FirstSeen,
+			LastSeen:     entry.LastSeen,
+		})
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err := w.Write(data); err != nil {
+		s.cfg.Logger.Error(err, "writing response")
+	}
+}
+
+func parseProductQuery(values url.Values) (catalog.Query, error) {
+	query := catalog.Query{
+		Text:    values.Get("q"),
+		Sources: values["source"],
+		Sort:    catalog.Sort(values.Get("sort")),
+		Cursor:  values.Get("cursor"),
+	}
+
+	if query.Sort != "" && !query.Sort.Valid() {
+		return catalog.Query{}, fmt.Errorf("unknown sort %q", query.Sort)
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			return catalog.Query{}, fmt.Errorf("parsing limit: %w", err)
+		}
+
+		query.Limit = limit
+	}
+
+	if raw := values.Get("firstSeenAfter"); raw != "" {
+		after, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return catalog.Query{}, fmt.Errorf("parsing firstSeenAfter: %w", err)
+		}
+
+		query.FirstSeenAfter = after
+	}
+
+	if raw := values.Get("firstSeenBefore"); raw != "" {
+		before, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return catalog.Query{}, fmt.Errorf("parsing firstSeenBefore: %w", err)
+		}
+
+		query.FirstSeenBefore = before
+	}
+
+	if raw := values.Get("firstSeenWithin"); raw != "" {
+		within, err := time.ParseDuration(raw)
+		if err != nil {
+			return catalog.Query{}, fmt.Errorf("parsing firstSeenWithin: %w", err)
+		}
+
+		query.FirstSeenAfter = time.Now().Add(-within)
+	}
+
+	for _, bound := range []struct {
+		param string
+		value *float64
+	}{
+		{param: "minPrice", value: &query.MinPrice},
+		{param: "maxPrice", value: &query.MaxPrice},
+	} {
+		raw := values.Get(bound.param)
+		if raw == "" {
 			continue
 		}
+
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil || price < 0 {
+			return catalog.Query{}, fmt.Errorf("parsing %s: must be a non-negative number", bound.param)
+		}
+
+		*bound.value = price
 	}
 
-	return result
+	for _, raw := range values["availability"] {
+		availability := api.ProductAvailability(raw)
+		if !availability.Valid() {
+			return catalog.Query{}, fmt.Errorf("unknown availability %q", raw)
+		}
+
+		query.Availability = append(query.Availability, recorder.Availability(availability))
+	}
+
+	return query, nil
 }
 
 type DefaultServerConfig struct {
-	Runner     scraper.Runner
-	BindAddr   string
-	KeyFile    string
-	CertFile   string
-	RunTimeout *time.Duration
-	Logger     logr.Logger
-	Cache      RunCache
-	Recorder   recorder.Recorder
+	Runner            scraper.Runner
+	BindAddr          string
+	KeyFile           string
+	CertFile          string
+	ClientCAFile      string
+	InsecureHTTP      bool
+	RunTimeout        *time.Duration
+	Logger            logr.Logger
+	Cache             RunCache
+	Recorder          recorder.Recorder
+	Catalog           catalog.Catalog
+	Scrapers          []api.Scraper
+	ScraperOptions    map[api.Scraper][]scraper.SimpleScraperOption
+	FeedOptions       map[api.Scraper][]scraper.FeedScraperOption
+	Reloader          Reloader
+	Authenticator     Authenticator
+	MaxConcurrentRuns int
+	// MaxQueuedRuns defaults to 10 while a negative value disables queueing.
+	MaxQueuedRuns     int
+	MaxRunTimeout     time.Duration
+	IdempotencyWindow time.Duration
+	Webhooks          *webhook.Sender
+	// Notifiers receive the results of every run like a run callback.
+	Notifiers       []webhook.Delivery
+	CircuitBreakers *scraper.CircuitBreakers
 }
 
 func (c *DefaultServerConfig) Options(opts ...DefaultServerOption) {
@@ -223,44 +1070,32 @@ func (c *DefaultServerConfig) Default() {
 	if c.Runner == nil {
 		c.Runner = scraper.NewParallelRunner()
 	}
+	if c.Catalog == nil {
+		c.Catalog = catalog.NewThreadSafeCatalog()
+	}
+	if c.MaxConcurrentRuns < 1 {
+		c.MaxConcurrentRuns = 2
+	}
+	if c.MaxQueuedRuns == 0 {
+		c.MaxQueuedRuns = 10
+	} else if c.MaxQueuedRuns < 0 {
+		c.MaxQueuedRuns = 0
+	}
+	if c.IdempotencyWindow <= 0 {
+		c.IdempotencyWindow = 24 * time.Hour
+	}
+	if c.Webhooks == nil {
+		c.Webhooks = webhook.NewSender(webhook.WithLogger{Logger: c.Logger})
+	}
+	if c.CircuitBreakers == nil {
+		c.CircuitBreakers = scraper.NewCircuitBreakers()
+	}
 }
 
-type DefaultServerOption interface {
-	ConfigureDefaultServer(*DefaultServerConfig)
+type Reloader interface {
+	Reload(context.Context) error
 }
 
-func newChatterlyScraper() *scraper.SimpleScraper {
-	return scraper.NewSimpleScraper(
-		scraper.WithBaseURL("https://chatterleyluxuries.com/product-category/pens/consignments"),
-		scraper.WithFilters{
-			regexp.MustCompile(`https://chatterleyluxuries\.com/product-category/pens/consignments.*`),
-			regexp.MustCompile(`https://chatterleyluxuries\.com/product/.*`),
-		},
-		scraper.WithSourceName("chatterly_luxuries"),
-		scraper.WithProcessor{Processor: scraper.NewSimpleProcessor(
-			scraper.WithBaseURL("https://chatterleyluxuries.com"),
-			scraper.WithProductPathPrefix("/product/"),
-		)})
-}
-
-func newFPHScraper() *scraper.SimpleScraper {
-	return scraper.NewSimpleScraper(
-		scraper.WithBaseURL("https://fountainpenhospital.com/collections/back-room-1"),
-		scraper.WithFilters{regexp.MustCompile(`https://fountainpenhospital\.com/collections/back-room-1.*`)},
-		scraper.WithSourceName("chatterly_luxuries"),
-		scraper.WithProcessor{Processor: scraper.NewSimpleProcessor(
-			scraper.WithBaseURL("https://fountainpenhospital.com"),
-			scraper.WithProductPathPrefix("/collections/back-room-1/products/"),
-		)})
-}
-
-func newTruphaeScraper() *scraper.SimpleScraper {
-	return scraper.NewSimpleScraper(
-		scraper.WithBaseURL("https://truphaeinc.com/collections/pre-owned-pens"),
-		scraper.WithFilters{regexp.MustCompile(`https://truphaeinc\.com/collections/pre-owned-pens.*`)},
-		scraper.WithSourceName("truphae"),
-		scraper.WithProcessor{Processor: scraper.NewSimpleProcessor(
-			scraper.WithBaseURL("https://truphaeinc.com/"),
-			scraper.WithProductPathPrefix("/collections/pre-owned-pens/products/"),
-		)})
+type DefaultServerOption interface {
+	ConfigureDefaultServer(*DefaultServerConfig)
 }
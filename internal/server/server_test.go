@@ -5,10 +5,24 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ajpantuso/pen-finder/api"
+	"github.com/ajpantuso/pen-finder/internal/auth"
+	"github.com/ajpantuso/pen-finder/internal/catalog"
+	"github.com/ajpantuso/pen-finder/internal/recorder"
+	"github.com/ajpantuso/pen-finder/internal/scraper"
+	"github.com/ajpantuso/pen-finder/internal/webhook"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,3 +36,463 @@ func TestScraperUnmarshalJSON(t *testing.T) {
 
 	assert.Equal(t, api.ScraperFPH, scraper)
 }
+
+func TestParseProductQuery(t *testing.T) {
+	query, err := parseProductQuery(url.Values{
+		"minPrice":     {"100"},
+		"maxPrice":     {"499.99"},
+		"availability": {"in_stock", "sold_out"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 100.0, query.MinPrice)
+	assert.Equal(t, 499.99, query.MaxPrice)
+	assert.Equal(t, []recorder.Availability{recorder.AvailabilityInStock, recorder.AvailabilitySoldOut}, query.Availability)
+
+	for name, values := range map[string]url.Values{
+		"malformed price":      {"minPrice": {"cheap"}},
+		"negative price":       {"maxPrice": {"-1"}},
+		"unknown availability": {"availability": {"backordered"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseProductQuery(values)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	store := auth.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.yaml"))
+
+	reader, _, err := store.Mint("dashboard", auth.RoleReader)
+	require.NoError(t, err)
+
+	operator, _, err := store.Mint("scheduler", auth.RoleOperator)
+	require.NoError(t, err)
+
+	srv := NewDefaultServer(WithAuthenticator{Authenticator: store})
+
+	for name, tc := range map[string]struct {
+		method string
+		token  string
+		want   int
+	}{
+		"missing token":       {method: http.MethodGet, want: http.StatusUnauthorized},
+		"unknown token":       {method: http.MethodGet, token: "pf_unknown", want: http.StatusUnauthorized},
+		"reader can list":     {method: http.MethodGet, token: reader, want: http.StatusOK},
+		"reader cannot run":   {method: http.MethodPost, token: reader, want: http.StatusForbidden},
+		"operator can list":   {method: http.MethodGet, token: operator, want: http.StatusOK},
+		"operator can cancel": {method: http.MethodPost, token: operator, want: http.StatusNotFound},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := "/run/"
+			if tc.method == http.MethodPost {
+				path = "/run/" + uuid.NewString() + "/cancel"
+			}
+
+			req := httptest.NewRequest(tc.method, path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+
+	require.NoError(t, store.Revoke(mustAuthenticate(t, store, operator).ID))
+
+	_, err = store.Authenticate(operator)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	srv := NewDefaultServer(WithRunner{Runner: runnerFunc(func(context.Context) error { return nil })})
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/run/", strings.NewReader(body))
+		req.Header.Set(api.HeaderIdempotencyKey, key)
+
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	first := post("retry-1", `{"scrapers": ["truphae"]}`)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get(api.HeaderIdempotentReplayed))
+
+	replayed := post("retry-1", `{ "scrapers":["truphae"] }`)
+	require.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get(api.HeaderIdempotentReplayed))
+	assert.JSONEq(t, first.Body.String(), replayed.Body.String())
+
+	conflict := post("retry-1", `{"scrapers": ["fountain pen hospital"]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, conflict.Code)
+
+	// a different scraper as the same one would be coalesced into the first run
+	other := post("retry-2", `{"scrapers": ["fountain pen hospital"]}`)
+	require.Equal(t, http.StatusOK, other.Code)
+	assert.Empty(t, other.Header().Get(api.HeaderIdempotentReplayed))
+	assert.NotEqual(t, first.Body.String(), other.Body.String())
+}
+
+func TestRunAdmission(t *testing.T) {
+	release := make(chan struct{})
+
+	srv := NewDefaultServer(
+		WithRunner{Runner: runnerFunc(func(ctx context.Context) error {
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})},
+		WithMaxConcurrentRuns(1),
+		WithMaxQueuedRuns(1),
+		WithRunTimeout(90*time.Second),
+	)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/run/", strings.NewReader(body)))
+
+		return rec
+	}
+
+	runID := func(res *httptest.ResponseRecorder) uuid.UUID {
+		t.Helper()
+
+		require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+
+		var created api.PostRunResponse
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+		return created.RunID
+	}
+
+	status := func(id uuid.UUID) api.RunStatus {
+		res := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/run/"+id.String(), nil))
+
+		var run api.GetRunResponse
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &run))
+
+		return run.Status
+	}
+
+	running := runID(post(`{"scrapers": ["truphae"]}`))
+	assert.Equal(t, api.RunStatusInProgress, status(running))
+
+	assert.Equal(t, running, runID(post(`{"scrapers": ["truphae"]}`)), "coalesced into the running run")
+
+	queued := runID(post(`{"scrapers": ["truphae", "fountain pen hospital"]}`))
+	assert.Equal(t, api.RunStatusQueued, status(queued))
+
+	full := post(`{"scrapers": ["chatterly luxuries"]}`)
+	assert.Equal(t, http.StatusTooManyRequests, full.Code)
+	assert.Equal(t, "90", full.Header().Get("Retry-After"))
+
+	assert.Equal(t, queued, runID(post(`{"scrapers": ["fountain pen hospital", "chatterly luxuries"]}`)), "coalesced into the queued run")
+
+	entry, ok := srv.cfg.Cache.Get(queued)
+	require.True(t, ok)
+	assert.Equal(t, api.RunStatusQueued, entry.Status)
+	assert.ElementsMatch(t, []api.Scraper{api.ScraperTruphae, api.ScraperFPH, api.ScraperChatterly}, entry.Scrapers, "the queued run reports the scrapers it gained")
+
+	cancelled := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(cancelled, httptest.NewRequest(http.MethodPost, "/run/"+queued.String()+"/cancel", nil))
+	assert.Equal(t, http.StatusAccepted, cancelled.Code)
+	assert.Equal(t, api.RunStatusCancelled, status(queued))
+
+	assert.Equal(t, http.StatusOK, post(`{"scrapers": ["chatterly luxuries"]}`).Code, "cancelling frees the queue")
+
+	close(release)
+
+	require.Eventually(t, func() bool {
+		return status(running) == api.RunStatusSuccess
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestIdempotencyKeyPerToken(t *testing.T) {
+	store := auth.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.yaml"))
+
+	ci, _, err := store.Mint("ci", auth.RoleOperator)
+	require.NoError(t, err)
+
+	cron, _, err := store.Mint("cron", auth.RoleOperator)
+	require.NoError(t, err)
+
+	srv := NewDefaultServer(
+		WithAuthenticator{Authenticator: store},
+		WithRunner{Runner: runnerFunc(func(context.Context) error { return nil })},
+	)
+
+	post := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/run/", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(api.HeaderIdempotencyKey, "nightly")
+
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	first := post(ci, `{"scrapers": ["truphae"]}`)
+	require.Equal(t, http.StatusOK, first.Code)
+
+	other := post(cron, `{"scrapers": ["fountain pen hospital"]}`)
+	require.Equal(t, http.StatusOK, other.Code, "another token's key does not conflict")
+	assert.Empty(t, other.Header().Get(api.HeaderIdempotentReplayed))
+	assert.NotEqual(t, first.Body.String(), other.Body.String())
+
+	replayed := post(ci, `{"scrapers": ["truphae"]}`)
+	require.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get(api.HeaderIdempotentReplayed))
+	assert.JSONEq(t, first.Body.String(), replayed.Body.String())
+}
+
+func TestRunCallback(t *testing.T) {
+	received := make(chan api.GetRunResponse, 4)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		if !webhook.Verify("secret", body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		var run api.GetRunResponse
+		require.NoError(t, json.Unmarshal(body, &run))
+
+		received <- run
+	}))
+	defer receiver.Close()
+
+	release := make(chan struct{})
+
+	srv := NewDefaultServer(
+		WithRunner{Runner: runnerFunc(func(context.Context) error {
+			<-release
+
+			return nil
+		})},
+		WithWebhookSender{Sender: webhook.NewSender(webhook.WithAllowPrivateNetworks(true))},
+		WithNotifiers{{URL: receiver.URL, Secret: "secret"}},
+	)
+
+	req := api.PostRunRequest{
+		CallbackURL:    receiver.URL,
+		CallbackSecret: "secret",
+	}
+
+	runID, err := srv.StartRun(req)
+	require.NoError(t, err)
+
+	coalescedID, err := srv.StartRun(req)
+	require.NoError(t, err)
+	require.Equal(t, runID, coalescedID)
+
+	close(release)
+
+	// both callbacks and the notifier which is only added once per run
+	for range 3 {
+		select {
+		case run := <-received:
+			assert.Equal(t, runID, run.ID)
+			assert.Equal(t, api.RunStatusSuccess, run.Status)
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback was not delivered")
+		}
+	}
+
+	select {
+	case <-received:
+		t.Fatal("unexpected delivery")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = srv.StartRun(api.PostRunRequest{CallbackURL: "/relative"})
+	assert.ErrorIs(t, err, ErrInvalidRunRequest)
+}
+
+func TestRunCallbackPrivateNetworks(t *testing.T) {
+	srv := NewDefaultServer(WithRunner{Runner: runnerFunc(func(context.Context) error { return nil })})
+
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/hook",
+	} {
+		_, err := srv.StartRun(api.PostRunRequest{CallbackURL: raw})
+		assert.ErrorIs(t, err, ErrInvalidRunRequest, raw)
+		assert.ErrorIs(t, err, webhook.ErrForbiddenAddress, raw)
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	runTimeout := time.Minute
+	cat := catalog.NewThreadSafeCatalog()
+
+	srv := NewDefaultServer(
+		WithRunTimeout(runTimeout),
+		WithMaxRunTimeout(5*time.Minute),
+		WithCatalog{Catalog: cat},
+		WithRunner{Runner: scrapeRunner{}},
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec
+	}
+
+	waitRun := func(id uuid.UUID) api.GetRunResponse {
+		var run api.GetRunResponse
+
+		require.Eventually(t, func() bool {
+			rec := get("/run/" + id.String())
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &run))
+
+			return run.Status.Terminal()
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return run
+	}
+
+	dryRunID, err := srv.StartRun(api.PostRunRequest{
+		Scrapers: []api.Scraper{api.ScraperTruphae},
+		RunOptions: api.RunOptions{
+			Timeout:  api.Duration(time.Hour),
+			MaxPages: 3,
+			DryRun:   true,
+			Labels:   map[string]string{"team": "ops"},
+		},
+	})
+	require.NoError(t, err)
+
+	dryRun := waitRun(dryRunID)
+	assert.Equal(t, api.RunStatusSuccess, dryRun.Status)
+	assert.Equal(t, api.Duration(5*time.Minute), dryRun.Timeout, "timeout is capped by the server")
+	assert.Equal(t, 3, dryRun.MaxPages)
+	assert.True(t, dryRun.DryRun)
+	assert.Equal(t, []api.Scraper{api.ScraperTruphae}, dryRun.Scrapers)
+
+	page, err := cat.Search(catalog.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Entries, "dry runs do not record products")
+
+	recordedID, err := srv.StartRun(api.PostRunRequest{
+		RunOptions: api.RunOptions{Labels: map[string]string{"team": "dev"}},
+	})
+	require.NoError(t, err)
+
+	recorded := waitRun(recordedID)
+	assert.Equal(t, api.Duration(runTimeout), recorded.Timeout, "server timeout applies by default")
+
+	page, err = cat.Search(catalog.Query{})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+
+	var list api.ListRunsResponse
+	require.NoError(t, json.Unmarshal(get("/run/?label=team%3Dops").Body.Bytes(), &list))
+	require.Len(t, list.Runs, 1)
+	assert.Equal(t, dryRunID, list.Runs[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, get("/run/?label=team").Code)
+
+	_, err = srv.StartRun(api.PostRunRequest{RunOptions: api.RunOptions{MaxPages: -1}})
+	assert.ErrorIs(t, err, ErrInvalidRunRequest)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breakers := scraper.NewCircuitBreakers(scraper.WithFailureThreshold(1), scraper.WithCooldown(time.Hour))
+
+	// open the circuit up front so the run never reaches the network
+	require.Error(t, breakers.Wrap(string(api.ScraperTruphae), failingScraper{io.ErrUnexpectedEOF}).Scrape(context.Background()))
+
+	srv := NewDefaultServer(
+		WithScrapers{api.ScraperTruphae},
+		WithCircuitBreakers{Breakers: breakers},
+	)
+
+	runID, err := srv.StartRun(api.PostRunRequest{})
+	require.NoError(t, err)
+
+	var run api.GetRunResponse
+	require.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run/"+runID.String(), nil))
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &run))
+
+		return run.Status.Terminal()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, api.RunStatusSuccess, run.Status, "skipped scrapers do not fail the run")
+	assert.Equal(t, map[api.Scraper]api.ScraperResult{api.ScraperTruphae: api.ScraperResultSkipped}, run.Results)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/scrapers", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var health api.GetScraperHealthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+	require.Len(t, health.Scrapers, 1)
+	assert.Equal(t, api.ScraperTruphae, health.Scrapers[0].Scraper)
+	assert.Equal(t, string(scraper.CircuitOpen), health.Scrapers[0].State)
+	assert.Equal(t, 1, health.Scrapers[0].ConsecutiveFailures)
+	assert.Equal(t, io.ErrUnexpectedEOF.Error(), health.Scrapers[0].LastError)
+	assert.NotNil(t, health.Scrapers[0].OpenUntil)
+}
+
+type failingScraper struct {
+	err error
+}
+
+func (s failingScraper) Scrape(context.Context, ...scraper.ScrapeOption) error {
+	return s.err
+}
+
+type scrapeRunner struct{}
+
+func (scrapeRunner) Run(_ context.Context, opts ...scraper.RunOption) error {
+	var runCfg scraper.RunConfig
+
+	runCfg.Options(opts...)
+
+	var cfg scraper.ScrapeConfig
+
+	cfg.Options(runCfg.ScrapeOptions...)
+	cfg.Default()
+
+	return cfg.Recorder.RecordProduct(recorder.Product{
+		Source: "test",
+		Name:   "pelikan-m800",
+		URL:    "https://example.com/products/pelikan-m800",
+	})
+}
+
+type runnerFunc func(context.Context) error
+
+func (f runnerFunc) Run(ctx context.Context, _ ...scraper.RunOption) error {
+	return f(ctx)
+}
+
+func mustAuthenticate(t *testing.T, store *auth.FileTokenStore, secret string) auth.Token {
+	t.Helper()
+
+	token, err := store.Authenticate(secret)
+	require.NoError(t, err)
+
+	return token
+}
@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := certs.NewGenerator(certs.WithDir(dir)).Generate()
+	require.NoError(t, err)
+
+	clientCA := newTestCA(t, "clients")
+	rogueCA := newTestCA(t, "rogue")
+
+	clientCAFile := filepath.Join(dir, "clients.crt")
+	require.NoError(t, os.WriteFile(clientCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCA.cert.Raw}), 0o600))
+
+	addr := freeAddr(t)
+
+	srv := NewDefaultServer(
+		WithBindAddr(addr),
+		WithCertFile(paths.CertFile),
+		WithKeyFile(paths.KeyFile),
+		WithClientCAFile(clientCAFile),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+
+	serverCAs := x509.NewCertPool()
+	data, err := os.ReadFile(paths.CAFile)
+	require.NoError(t, err)
+	require.True(t, serverCAs.AppendCertsFromPEM(data))
+
+	get := func(clientCert tls.Certificate) (*http.Response, error) {
+		client := &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    serverCAs,
+					MinVersion: tls.VersionTLS12,
+					// always present the certificate even if the server
+					// would not accept its issuer
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return &clientCert, nil
+					},
+				},
+			},
+		}
+
+		res, err := client.Get("https://" + addr + "/run/")
+		if err == nil {
+			res.Body.Close()
+		}
+
+		return res, err
+	}
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+
+		conn.Close()
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("valid certificate", func(t *testing.T) {
+		res, err := get(clientCA.issue(t, "operator"))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		_, err := get(tls.Certificate{})
+		assert.Error(t, err)
+	})
+
+	t.Run("certificate from another CA", func(t *testing.T) {
+		_, err := get(rogueCA.issue(t, "operator"))
+		assert.Error(t, err)
+	})
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	return l.Addr().String()
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ajpantuso/pen-finder/internal/retryafter"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderSignature = "X-Pen-Finder-Signature"
+	HeaderDelivery  = "X-Pen-Finder-Delivery"
+	signaturePrefix = "sha256="
+)
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func NewSender(opts ...Option) *Sender {
+	var cfg Config
+
+	cfg.Options(opts...)
+	cfg.Default()
+
+	return &Sender{
+		cfg: cfg,
+	}
+}
+
+type Sender struct {
+	cfg Config
+}
+
+type Delivery struct {
+	URL     string
+	Secret  string
+	Payload any
+}
+
+func (s *Sender) Send(ctx context.Context, d Delivery) error {
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		return fmt.Errorf("encoding payload: %w", err)
+	}
+
+	deliveryID := uuid.NewString()
+	backoff := s.cfg.InitialBackoff
+
+	var lastErr error
+
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		wait, err := s.attempt(ctx, d, deliveryID, body)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == s.cfg.MaxAttempts {
+			break
+		}
+
+		if wait <= 0 {
+			wait = backoff
+			backoff = min(backoff*2, s.cfg.MaxBackoff)
+		}
+		wait = min(wait, s.cfg.MaxBackoff)
+
+		s.cfg.Logger.Info("retrying webhook delivery", "url", d.URL, "attempt", attempt, "wait", wait, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return fmt.Errorf("delivering webhook to %q: %w", d.URL, lastErr)
+}
+
+func (s *Sender) attempt(ctx context.Context, d Delivery, deliveryID string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, &permanentError{err: fmt.Errorf("creating request: %w", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, deliveryID)
+	if d.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(d.Secret, body))
+	}
+
+	res, err := s.cfg.Client.Do(req)
+	if errors.Is(err, ErrForbiddenAddress) {
+		return 0, &permanentError{err: fmt.Errorf("sending request: %w", err)}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	switch {
+	case res.StatusCode < http.StatusMultipleChoices:
+		return 0, nil
+	case res.StatusCode == http.StatusTooManyRequests:
+		return retryafter.Parse(res.Header.Get("Retry-After")), fmt.Errorf("receiver responded with %d", res.StatusCode)
+	case res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusRequestTimeout:
+		return 0, fmt.Errorf("receiver responded with %d", res.StatusCode)
+	default:
+		return 0, &permanentError{err: fmt.Errorf("receiver responded with %d", res.StatusCode)}
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+type Config struct {
+	Client         *http.Client
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Logger         logr.Logger
+	// AllowPrivateNetworks permits deliveries to loopback, private and
+	// link-local addresses which are otherwise refused.
+	AllowPrivateNetworks bool
+}
+
+func (c *Config) Options(opts ...Option) {
+	for _, opt := range opts {
+		opt.ConfigureSender(c)
+	}
+}
+
+func (c *Config) Default() {
+	if c.Client == nil && c.AllowPrivateNetworks {
+		c.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.Client == nil {
+		c.Client = guardedClient()
+	}
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = max(time.Minute, c.InitialBackoff)
+	}
+	if c.Logger.GetSink() == nil {
+		c.Logger = logr.Discard()
+	}
+}
+
+type Option interface {
+	ConfigureSender(*Config)
+}
+
+type WithHTTPClient struct {
+	Client *http.Client
+}
+
+func (w WithHTTPClient) ConfigureSender(c *Config) {
+	c.Client = w.Client
+}
+
+type WithMaxAttempts int
+
+func (w WithMaxAttempts) ConfigureSender(c *Config) {
+	c.MaxAttempts = int(w)
+}
+
+type WithInitialBackoff time.Duration
+
+func (w WithInitialBackoff) ConfigureSender(c *Config) {
+	c.InitialBackoff = time.Duration(w)
+}
+
+type WithMaxBackoff time.Duration
+
+func (w WithMaxBackoff) ConfigureSender(c *Config) {
+	c.MaxBackoff = time.Duration(w)
+}
+
+type WithLogger struct {
+	Logger logr.Logger
+}
+
+func (w WithLogger) ConfigureSender(c *Config) {
+	c.Logger = w.Logger
+}
+
+type WithAllowPrivateNetworks bool
+
+func (w WithAllowPrivateNetworks) ConfigureSender(c *Config) {
+	c.AllowPrivateNetworks = bool(w)
+}
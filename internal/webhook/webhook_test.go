@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Andrew Pantuso <ajpantuso@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSenderRetriesUntilDelivered(t *testing.T) {
+	var attempts atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		assert.True(t, Verify("secret", body, r.Header.Get(HeaderSignature)))
+		assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(WithInitialBackoff(time.Millisecond), WithAllowPrivateNetworks(true))
+
+	require.NoError(t, sender.Send(context.Background(), Delivery{
+		URL:     receiver.URL,
+		Secret:  "secret",
+		Payload: map[string]string{"status": "success"},
+	}))
+	assert.EqualValues(t, 3, attempts.Load())
+}
+
+func TestSenderDoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(WithInitialBackoff(time.Millisecond), WithAllowPrivateNetworks(true))
+
+	assert.Error(t, sender.Send(context.Background(), Delivery{URL: receiver.URL, Payload: struct{}{}}))
+	assert.EqualValues(t, 1, attempts.Load())
+}
+
+func TestSenderRefusesPrivateNetworks(t *testing.T) {
+	var attempts atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(WithInitialBackoff(time.Millisecond))
+
+	err := sender.Send(context.Background(), Delivery{URL: receiver.URL, Payload: struct{}{}})
+	assert.ErrorIs(t, err, ErrForbiddenAddress, "resolved addresses are checked when dialing")
+	assert.Zero(t, attempts.Load())
+}
+
+func TestSenderCheckURL(t *testing.T) {
+	sender := NewSender()
+
+	for raw, allowed := range map[string]bool{
+		"https://example.com/hook":                 true,
+		"http://93.184.216.34/hook":                true,
+		"http://[2606:2800:220:1::]/hook":          true,
+		"http://localhost:8080/hook":               false,
+		"http://api.localhost/hook":                false,
+		"http://127.0.0.1/hook":                    false,
+		"http://10.1.2.3/hook":                     false,
+		"http://172.16.0.1/hook":                   false,
+		"http://192.168.1.1/hook":                  false,
+		"http://100.64.0.1/hook":                   false,
+		"http://169.254.169.254/latest/meta-data/": false,
+		"http://0.0.0.0/hook":                      false,
+		"http://[::1]/hook":                        false,
+		"http://[::ffff:127.0.0.1]/hook":           false,
+		"http://[fd00:ec2::254]/hook":              false,
+		"http://[fe80::1]/hook":                    false,
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+
+		if allowed {
+			assert.NoError(t, sender.CheckURL(u), raw)
+		} else {
+			assert.ErrorIs(t, sender.CheckURL(u), ErrForbiddenAddress, raw)
+		}
+	}
+
+	u, err := url.Parse("http://127.0.0.1/hook")
+	require.NoError(t, err)
+	assert.NoError(t, NewSender(WithAllowPrivateNetworks(true)).CheckURL(u))
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+
+	assert.True(t, Verify("secret", body, Sign("secret", body)))
+	assert.False(t, Verify("other", body, Sign("secret", body)))
+	assert.False(t, Verify("secret", []byte(`{}`), Sign("secret", body)))
+}